@@ -0,0 +1,327 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	stdnet "net"
+	"net/http"
+	"net/http/pprof"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/deixis/spine/bg"
+	"github.com/deixis/spine/config"
+	scontext "github.com/deixis/spine/context"
+	"github.com/deixis/spine/disco"
+	"github.com/deixis/spine/health"
+	"github.com/deixis/spine/log"
+	"github.com/deixis/spine/net"
+)
+
+// ErrEmptyConfig occurs when the admin server is not configured
+var ErrEmptyConfig = errors.New("missing admin config")
+
+// ErrNoToken occurs when the admin server listens on a public address without
+// a token
+var ErrNoToken = errors.New("admin token is required on non-loopback addresses")
+
+// closeTimeout is the time given to in-flight admin requests to complete
+const closeTimeout = 5 * time.Second
+
+// Config is the admin server configuration
+type Config struct {
+	// Addr is the address on which the admin server listens (host:port). The
+	// admin server is disabled when it is empty.
+	Addr string `toml:"addr"`
+	// Token is a bearer token required on all requests. It is optional only
+	// when Addr is a loopback address, since the endpoints can stop the app.
+	Token string `toml:"token"`
+}
+
+// App is the application managed by the admin server
+type App interface {
+	Service() string
+	// State returns the app state (down, up or drain)
+	State() string
+	Servers() map[string]net.Server
+	Registrations() []*disco.Registration
+	BG() *bg.Reg
+	Health() *health.Registry
+	Breakers() *scontext.Breakers
+	ConfigTree() config.Tree
+	L() log.Logger
+	Drain() bool
+	Shutdown(ctx context.Context) error
+}
+
+// leveler is implemented by loggers whose level can be changed at runtime
+type leveler interface {
+	Level() log.Level
+	SetLevel(lvl log.Level)
+}
+
+// origins is implemented by config trees made of several layers
+type origins interface {
+	Origins() map[string]string
+}
+
+// Server serves the admin endpoints
+type Server struct {
+	app    App
+	config Config
+	log    log.Logger
+	http   *http.Server
+}
+
+// New returns a new admin server configured with tree. It returns
+// ErrEmptyConfig when the admin server is disabled, and ErrNoToken when it
+// would serve a non-loopback address without a token.
+func New(tree config.Tree, app App) (*Server, error) {
+	c := Config{}
+	if err := tree.Unmarshal(&c); err != nil {
+		return nil, err
+	}
+	if c.Addr == "" {
+		return nil, ErrEmptyConfig
+	}
+	if c.Token == "" && !isLoopback(c.Addr) {
+		return nil, ErrNoToken
+	}
+
+	s := &Server{
+		app:    app,
+		config: c,
+		log:    app.L(),
+	}
+	s.http = &http.Server{Handler: s.Handler()}
+	return s, nil
+}
+
+// Handler returns the admin HTTP handler
+func (s *Server) Handler() http.Handler {
+	m := http.NewServeMux()
+	m.HandleFunc("/state", s.get(s.state))
+	m.HandleFunc("/servers", s.get(s.servers))
+	m.HandleFunc("/jobs", s.get(s.jobs))
+	m.HandleFunc("/breakers", s.get(s.breakers))
+	m.HandleFunc("/config", s.get(s.configTree))
+	m.HandleFunc("/config/origins", s.get(s.configOrigins))
+	m.HandleFunc("/log/level", s.logLevel)
+	m.HandleFunc("/health/live", s.get(s.app.Health().LivenessHandler().ServeHTTP))
+	m.HandleFunc("/health/ready", s.get(s.app.Health().ReadinessHandler().ServeHTTP))
+	m.HandleFunc("/drain", s.post(s.drain))
+	m.HandleFunc("/shutdown", s.post(s.shutdown))
+
+	m.HandleFunc("/debug/pprof/", pprof.Index)
+	m.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	m.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	m.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	m.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return s.auth(m)
+}
+
+// Start starts listening. The server runs until Close is called.
+func (s *Server) Start() error {
+	l, err := stdnet.Listen("tcp", s.config.Addr)
+	if err != nil {
+		return err
+	}
+	s.log.Trace("admin.start", "Admin server listening",
+		log.String("addr", l.Addr().String()),
+	)
+
+	go func() {
+		err := s.http.Serve(l)
+		if err != nil && err != http.ErrServerClosed {
+			s.log.Error("admin.serve_err", "Admin server error", log.Error(err))
+		}
+	}()
+	return nil
+}
+
+// Close stops the server and waits for in-flight requests to complete
+func (s *Server) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), closeTimeout)
+	defer cancel()
+	return s.http.Shutdown(ctx)
+}
+
+func (s *Server) auth(next http.Handler) http.Handler {
+	if s.config.Token == "" {
+		return next
+	}
+	expect := []byte("Bearer " + s.config.Token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := []byte(r.Header.Get("Authorization"))
+		if subtle.ConstantTimeCompare(got, expect) != 1 {
+			http.Error(w, "unauthorised", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isLoopback returns whether addr only listens on a loopback interface
+func isLoopback(addr string) bool {
+	host, _, err := stdnet.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := stdnet.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func (s *Server) get(f http.HandlerFunc) http.HandlerFunc {
+	return method(http.MethodGet, f)
+}
+
+func (s *Server) post(f http.HandlerFunc) http.HandlerFunc {
+	return method(http.MethodPost, f)
+}
+
+func method(m string, f http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != m {
+			w.Header().Set("Allow", m)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		f(w, r)
+	}
+}
+
+func (s *Server) state(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"service": s.app.Service(),
+		"state":   s.app.State(),
+	})
+}
+
+type server struct {
+	Addr string `json:"addr"`
+	Type string `json:"type"`
+}
+
+func (s *Server) servers(w http.ResponseWriter, r *http.Request) {
+	servers := []server{}
+	for addr, srv := range s.app.Servers() {
+		servers = append(servers, server{Addr: addr, Type: fmt.Sprintf("%T", srv)})
+	}
+	sort.Slice(servers, func(i, j int) bool { return servers[i].Addr < servers[j].Addr })
+
+	registrations := s.app.Registrations()
+	if registrations == nil {
+		registrations = []*disco.Registration{}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"servers":       servers,
+		"registrations": registrations,
+	})
+}
+
+func (s *Server) jobs(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"jobs":   s.app.BG().Snapshot(),
+		"groups": s.app.BG().Groups(),
+	})
+}
+
+func (s *Server) breakers(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.app.Breakers().Stats())
+}
+
+func (s *Server) configTree(w http.ResponseWriter, r *http.Request) {
+	// Decrypted values are redacted by Tree.String()
+	w.Header().Set("Content-Type", "application/toml; charset=utf-8")
+	w.Write([]byte(s.app.ConfigTree().String()))
+}
+
+func (s *Server) configOrigins(w http.ResponseWriter, r *http.Request) {
+	o, ok := s.app.ConfigTree().(origins)
+	if !ok {
+		http.Error(w, "config origins are not available", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, o.Origins())
+}
+
+func (s *Server) logLevel(w http.ResponseWriter, r *http.Request) {
+	l, ok := s.app.L().(leveler)
+	if !ok {
+		http.Error(w, "log level cannot be changed", http.StatusNotImplemented)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut, http.MethodPost:
+		name := strings.ToLower(r.FormValue("level"))
+		lvl, ok := levels[name]
+		if !ok {
+			http.Error(w, "level must be one of trace, warning, error", http.StatusBadRequest)
+			return
+		}
+		l.SetLevel(lvl)
+		s.log.Warning("admin.log.level", "Log level changed",
+			log.String("level", name),
+		)
+	default:
+		w.Header().Set("Allow", "GET, PUT, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"level": levelName(l.Level())})
+}
+
+func (s *Server) drain(w http.ResponseWriter, r *http.Request) {
+	if s.app.State() != "up" {
+		http.Error(w, "app is not up", http.StatusConflict)
+		return
+	}
+	s.log.Warning("admin.drain", "Drain requested")
+
+	// Drain blocks until all handlers are drained
+	go s.app.Drain()
+	writeJSON(w, http.StatusAccepted, map[string]string{"state": "drain"})
+}
+
+func (s *Server) shutdown(w http.ResponseWriter, r *http.Request) {
+	s.log.Warning("admin.shutdown", "Shutdown requested")
+
+	go func() {
+		if err := s.app.Shutdown(context.Background()); err != nil {
+			s.log.Error("admin.shutdown_err", "Shutdown did not complete",
+				log.Error(err),
+			)
+		}
+	}()
+	writeJSON(w, http.StatusAccepted, map[string]string{"state": "shutdown"})
+}
+
+var levels = map[string]log.Level{
+	"trace":   log.LevelTrace,
+	"warning": log.LevelWarning,
+	"error":   log.LevelError,
+}
+
+func levelName(lvl log.Level) string {
+	for name, l := range levels {
+		if l == lvl {
+			return name
+		}
+	}
+	return ""
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
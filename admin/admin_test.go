@@ -0,0 +1,212 @@
+package admin_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/deixis/spine/admin"
+	"github.com/deixis/spine/bg"
+	"github.com/deixis/spine/config"
+	scontext "github.com/deixis/spine/context"
+	"github.com/deixis/spine/disco"
+	"github.com/deixis/spine/health"
+	"github.com/deixis/spine/log"
+	"github.com/deixis/spine/log/logger"
+	"github.com/deixis/spine/net"
+	"github.com/deixis/spine/stats"
+)
+
+type server struct{}
+
+func (s *server) Serve(ctx context.Context, addr string) error { return nil }
+func (s *server) Drain()                                       {}
+
+type app struct {
+	mu       sync.Mutex
+	state    string
+	drained  chan struct{}
+	tree     config.Tree
+	log      log.Logger
+	bg       *bg.Reg
+	health   *health.Registry
+	breakers *scontext.Breakers
+}
+
+func newApp(t *testing.T, tree string) *app {
+	l, err := logger.StdOut("test", log.LevelError)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr, err := config.LoadTree(strings.NewReader(tree))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &app{
+		state:    "up",
+		drained:  make(chan struct{}, 1),
+		tree:     tr,
+		log:      l,
+		bg:       bg.NewReg("test", context.Background()),
+		health:   health.NewRegistry(),
+		breakers: scontext.NewBreakers(l, stats.NopStats()),
+	}
+}
+
+func (a *app) Service() string { return "test" }
+func (a *app) State() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.state
+}
+func (a *app) Servers() map[string]net.Server {
+	return map[string]net.Server{":8080": &server{}}
+}
+func (a *app) Registrations() []*disco.Registration {
+	return []*disco.Registration{{Name: "test", Port: 8080}}
+}
+func (a *app) BG() *bg.Reg                  { return a.bg }
+func (a *app) Health() *health.Registry     { return a.health }
+func (a *app) Breakers() *scontext.Breakers { return a.breakers }
+func (a *app) ConfigTree() config.Tree      { return a.tree }
+func (a *app) L() log.Logger                { return a.log }
+func (a *app) Drain() bool {
+	a.mu.Lock()
+	a.state = "drain"
+	a.mu.Unlock()
+	a.drained <- struct{}{}
+	return true
+}
+func (a *app) Shutdown(ctx context.Context) error { return nil }
+
+func newServer(t *testing.T, a *app) http.Handler {
+	s, err := admin.New(a.tree.Get("admin"), a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s.Handler()
+}
+
+func do(h http.Handler, method, target, token string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, nil)
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestDisabled(t *testing.T) {
+	a := newApp(t, "")
+	_, err := admin.New(a.tree.Get("admin"), a)
+	if err != admin.ErrEmptyConfig {
+		t.Errorf("expect ErrEmptyConfig, but got %v", err)
+	}
+}
+
+func TestNoToken(t *testing.T) {
+	for _, addr := range []string{":9090", "0.0.0.0:9090", "10.0.0.1:9090"} {
+		a := newApp(t, "[admin]\naddr = \""+addr+"\"")
+		_, err := admin.New(a.tree.Get("admin"), a)
+		if err != admin.ErrNoToken {
+			t.Errorf("expect ErrNoToken on %s, but got %v", addr, err)
+		}
+	}
+
+	for _, addr := range []string{"127.0.0.1:9090", "[::1]:9090", "localhost:9090"} {
+		a := newApp(t, "[admin]\naddr = \""+addr+"\"")
+		h := newServer(t, a)
+		if w := do(h, http.MethodGet, "/state", ""); w.Code != http.StatusOK {
+			t.Errorf("expect status 200 without token on %s, but got %d", addr, w.Code)
+		}
+	}
+}
+
+func TestEndpoints(t *testing.T) {
+	a := newApp(t, `
+[admin]
+addr = "127.0.0.1:0"
+token = "abc"
+`)
+	h := newServer(t, a)
+
+	if w := do(h, http.MethodGet, "/state", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("expect status 401 without token, but got %d", w.Code)
+	}
+
+	w := do(h, http.MethodGet, "/state", "abc")
+	var state map[string]string
+	json.Unmarshal(w.Body.Bytes(), &state)
+	if state["state"] != "up" {
+		t.Errorf("expect state up, but got %s", w.Body)
+	}
+
+	w = do(h, http.MethodGet, "/servers", "abc")
+	if !strings.Contains(w.Body.String(), `"addr":":8080"`) {
+		t.Errorf("expect server :8080, but got %s", w.Body)
+	}
+
+	handle, err := a.bg.Go(context.Background(), "worker", bg.RunnerFunc(
+		func(ctx context.Context) error {
+			<-ctx.Done()
+			return nil
+		},
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer handle.Cancel()
+	a.bg.Group("mail")
+	w = do(h, http.MethodGet, "/jobs", "abc")
+	var jobs struct {
+		Jobs   []bg.JobInfo    `json:"jobs"`
+		Groups []bg.GroupStats `json:"groups"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &jobs)
+	if len(jobs.Jobs) != 1 || jobs.Jobs[0].Name != "worker" || jobs.Jobs[0].Started.IsZero() {
+		t.Errorf("expect job worker, but got %s", w.Body)
+	}
+	if len(jobs.Groups) != 1 || jobs.Groups[0].Name != "mail" {
+		t.Errorf("expect group mail, but got %s", w.Body)
+	}
+
+	a.breakers.Get("foo")
+	w = do(h, http.MethodGet, "/breakers", "abc")
+	if !strings.Contains(w.Body.String(), `"state":"closed"`) {
+		t.Errorf("expect breaker foo, but got %s", w.Body)
+	}
+
+	w = do(h, http.MethodGet, "/config", "abc")
+	if !strings.Contains(w.Body.String(), "[admin]") {
+		t.Errorf("expect config tree, but got %s", w.Body)
+	}
+
+	w = do(h, http.MethodPut, "/log/level?level=trace", "abc")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"trace"`) {
+		t.Errorf("expect log level trace, but got %d %s", w.Code, w.Body)
+	}
+	w = do(h, http.MethodPut, "/log/level?level=debug", "abc")
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expect status 400 on unknown level, but got %d", w.Code)
+	}
+
+	if w := do(h, http.MethodGet, "/drain", "abc"); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expect status 405, but got %d", w.Code)
+	}
+	if w := do(h, http.MethodPost, "/drain", "abc"); w.Code != http.StatusAccepted {
+		t.Errorf("expect status 202, but got %d", w.Code)
+	}
+	<-a.drained
+	if w := do(h, http.MethodPost, "/drain", "abc"); w.Code != http.StatusConflict {
+		t.Errorf("expect status 409 when already draining, but got %d", w.Code)
+	}
+
+	if w := do(h, http.MethodGet, "/debug/pprof/", "abc"); w.Code != http.StatusOK {
+		t.Errorf("expect pprof index, but got %d", w.Code)
+	}
+}
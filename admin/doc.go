@@ -0,0 +1,26 @@
+// Package admin serves endpoints to monitor and control a running app.
+//
+// The admin server is opt-in and listens on its own address, so it keeps
+// answering while the app drains. A token is required unless the address is
+// a loopback address.
+//
+//	[admin]
+//	addr = "127.0.0.1:9090"
+//	token = "$ADMIN_TOKEN"
+//
+// Endpoints:
+//
+//	GET  /state               app state (down, up or drain)
+//	GET  /servers             registered servers and service registrations
+//	GET  /jobs                running background jobs and job groups
+//	GET  /breakers            circuit breaker state of each command
+//	GET  /config              config tree (decrypted values are redacted)
+//	GET  /config/origins      source of each config value
+//	GET  /health/live         liveness (503 when failing)
+//	GET  /health/ready        readiness (503 when failing or draining)
+//	GET  /log/level           current log level
+//	PUT  /log/level?level=x   change the log level (trace, warning, error)
+//	POST /drain               drain the app (e.g. before a deploy)
+//	POST /shutdown            gracefully shut down the app
+//	GET  /debug/pprof/        pprof profiles
+package admin
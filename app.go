@@ -12,12 +12,19 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/deixis/spine/admin"
 	"github.com/deixis/spine/bg"
 	"github.com/deixis/spine/cache"
 	acache "github.com/deixis/spine/cache/adapter"
 	"github.com/deixis/spine/config"
+	store "github.com/deixis/spine/config/adapter"
+	scontext "github.com/deixis/spine/context"
 	"github.com/deixis/spine/disco"
 	adisco "github.com/deixis/spine/disco/adapter"
+	"github.com/deixis/spine/health"
+	"github.com/deixis/spine/lifecycle"
+	"github.com/deixis/spine/lock"
+	alock "github.com/deixis/spine/lock/adapter"
 	"github.com/deixis/spine/log"
 	"github.com/deixis/spine/log/logger"
 	"github.com/deixis/spine/net"
@@ -41,6 +48,12 @@ const (
 	drain
 )
 
+var stateNames = map[uint32]string{
+	down:  "down",
+	up:    "up",
+	drain: "drain",
+}
+
 // App is the core structure for a new service
 type App struct {
 	mu     sync.Mutex
@@ -51,11 +64,13 @@ type App struct {
 	service    string
 	config     config.Config
 	configTree config.Tree
+	reloader   *config.Reloader
 	state      uint32
 	stopc      chan struct{}
 
 	servers       *net.Reg
 	registrations []*disco.Registration
+	admin         *admin.Server
 
 	// services
 	bg       *bg.Reg
@@ -67,44 +82,74 @@ type App struct {
 	schedule schedule.Scheduler
 	pubsub   pubsub.PubSub
 	stream   stream.Stream
+	lock     lock.Locker
+	health   *health.Registry
+	breakers *scontext.Breakers
 
+	components    *lifecycle.Manager
 	drainHandlers []func(context.Context)
+
+	// lockedFiles are the services which lock a file exclusively
+	lockedFiles []fileLocker
+}
+
+// fileLocker is implemented by services which lock a file exclusively while
+// they are open, such as bbolt databases. A restarted process cannot open
+// that file until this app closes it (see App.Restart).
+type fileLocker interface {
+	// LockedFile returns the path of the locked file, or an empty string when
+	// the file is not open
+	LockedFile() string
 }
 
 // New creates a new App and returns it
-func New(service string, appConfig interface{}) (*App, error) {
-	configStore, err := config.NewStore(os.Getenv("CONFIG_URI"))
+func New(service string, appConfig interface{}, o ...Option) (*App, error) {
+	sources, err := config.NewSources(os.Getenv("CONFIG_URI"))
 	if err != nil {
 		return nil, errors.Wrap(err, "error creating config store")
 	}
 
-	r, err := configStore.Load()
+	configTree, err := config.LoadSources(sources)
 	if err != nil {
 		return nil, errors.Wrap(err, "error loading load config")
 	}
-	defer r.Close()
 
-	return NewWithConfig(service, r, appConfig)
+	a, err := newWithTree(service, configTree, appConfig, o...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Reload config when a store supports it
+	for _, s := range sources {
+		if w, ok := s.Store.(store.Watcher); ok {
+			if err := a.BG().Dispatch(newConfigWatcher(a, sources, w)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return a, nil
 }
 
 // NewWithConfig creates a new App with a custom configuration
 func NewWithConfig(
-	service string, r io.Reader, appConfig interface{},
+	service string, r io.Reader, appConfig interface{}, o ...Option,
 ) (a *App, err error) {
 	configTree, err := config.LoadTree(r)
 	if err != nil {
 		return nil, errors.Wrap(err, "error loading config tree")
 	}
+	return newWithTree(service, configTree, appConfig, o...)
+}
 
-	err = configTree.Get("app").Unmarshal(appConfig)
-	if err != nil {
-		return nil, errors.Wrap(err, "annot unmarshal app config")
-	}
+func newWithTree(
+	service string, configTree config.Tree, appConfig interface{}, o ...Option,
+) (a *App, err error) {
+	opts := BuildOptions(o...)
 
 	// Build app struct
-	lock := &sync.Mutex{}
-	lock.Lock()
-	ready := sync.NewCond(lock)
+	readyLock := &sync.Mutex{}
+	readyLock.Lock()
+	ready := sync.NewCond(readyLock)
 	ctx, cancelFunc := context.WithCancel(context.Background())
 	a = &App{
 		ready:      ready,
@@ -115,16 +160,38 @@ func NewWithConfig(
 		configTree: configTree,
 	}
 
-	err = a.configTree.Unmarshal(&a.config)
-	if err != nil {
-		return nil, errors.Wrap(err, "annot unmarshal core config")
+	// Config violations are collected while the adapters are initialised with
+	// their default, so they are all reported at once
+	var violations []error
+	invalid := func(err error) bool {
+		var verr *config.ValidationError
+		if errors.As(err, &verr) {
+			violations = append(violations, verr)
+			return true
+		}
+		return false
+	}
+	err = config.JoinValidationErrors(
+		configTree.Get("app").Unmarshal(appConfig),
+		a.configTree.Unmarshal(&a.config),
+	)
+	if err != nil && !invalid(err) {
+		return nil, errors.Wrap(err, "cannot unmarshal config")
 	}
 	a.ctx = config.TreeWithContext(a.ctx, a.configTree)
+	a.reloader = config.NewReloader(a.configTree)
+	a.ctx = config.ReloaderWithContext(a.ctx, a.reloader)
 
 	// Set up services
-	a.log, err = logger.New(service, a.configTree.Get("log"))
-	if err != nil {
-		return nil, errors.Wrap(err, "error initialising logger")
+	a.log = opts.Logger
+	if a.log == nil {
+		a.log, err = logger.New(service, a.configTree.Get("log"))
+		switch {
+		case invalid(err):
+			a.log = log.NopLogger()
+		case err != nil:
+			return nil, errors.Wrap(err, "error initialising logger")
+		}
 	}
 	a.log = a.log.With(
 		log.String("service", service),
@@ -132,9 +199,19 @@ func NewWithConfig(
 		log.String("version", a.config.Version),
 		log.String("log_type", "A"),
 	)
+	for _, w := range opts.WrapLogger {
+		a.log = w(a.log)
+	}
 	a.ctx = log.WithContext(a.ctx, a.log)
+	a.reloader.Subscribe("log", a.reloadLog)
 
-	a.stats, err = astats.New(a.configTree.Get("stats"))
+	a.stats, err = opts.Stats, nil
+	if a.stats == nil {
+		a.stats, err = astats.New(a.configTree.Get("stats"))
+	}
+	if invalid(err) {
+		err = astats.ErrEmptyConfig
+	}
 	switch err {
 	case astats.ErrEmptyConfig:
 		a.stats = stats.NopStats()
@@ -146,6 +223,9 @@ func NewWithConfig(
 			"version": a.config.Version,
 		})
 		a.stats = a.stats.Log(a.log)
+		for _, w := range opts.WrapStats {
+			a.stats = w(a.stats)
+		}
 		a.ctx = stats.WithContext(a.ctx, a.stats)
 	default:
 		return nil, errors.Wrap(err, "error initialising stats")
@@ -154,55 +234,135 @@ func NewWithConfig(
 	a.bg = bg.NewReg(service, a)
 	a.ctx = bg.RegWithContext(a.ctx, a.bg)
 
-	a.tracer, err = atracing.New(
-		a.configTree.Get("tracing"),
-		tracing.WithLogger(a.log),
-		tracing.WithStats(a.stats),
-	)
+	a.health = health.NewRegistry()
+	a.ctx = health.WithContext(a.ctx, a.health)
+
+	a.breakers = scontext.NewBreakers(a.log, a.stats)
+	a.ctx = scontext.BreakersWithContext(a.ctx, a.breakers)
+
+	a.components = lifecycle.NewManager(a.log)
+
+	a.tracer, err = opts.Tracer, nil
+	if a.tracer == nil {
+		a.tracer, err = atracing.New(
+			a.configTree.Get("tracing"),
+			tracing.WithLogger(a.log),
+			tracing.WithStats(a.stats),
+		)
+	}
+	if invalid(err) {
+		err = atracing.ErrEmptyConfig
+	}
 	switch err {
 	case atracing.ErrEmptyConfig:
 		a.tracer = opentracing.GlobalTracer()
 		fallthrough
 	case nil:
+		for _, w := range opts.WrapTracer {
+			a.tracer = w(a.tracer)
+		}
 		a.ctx = tracing.WithContext(a.ctx, a.tracer)
 	default:
 		return nil, errors.Wrap(err, "error initialising tracer")
 	}
 
-	a.disco, err = adisco.New(a.configTree.Get("disco"))
+	a.disco, err = opts.Disco, nil
+	if a.disco == nil {
+		a.disco, err = adisco.New(a.configTree.Get("disco"))
+	}
+	if invalid(err) {
+		err = adisco.ErrEmptyConfig
+	}
 	switch err {
 	case adisco.ErrEmptyConfig:
 		a.disco = disco.NewLocalAgent()
 		fallthrough
 	case nil:
+		// Keep the agent elector, even when decorators hide it
+		if e, ok := a.disco.(disco.Elector); ok {
+			a.ctx = disco.ElectorWithContext(a.ctx, e)
+		}
+		for _, w := range opts.WrapDisco {
+			a.disco = w(a.disco)
+		}
 		a.ctx = disco.AgentWithContext(a.ctx, a.disco)
 	default:
 		return nil, errors.Wrap(err, "error initialising disco agent")
 	}
 
-	a.schedule, err = aschedule.New(a.configTree.Get("schedule"))
+	a.schedule, err = opts.Scheduler, nil
+	if a.schedule == nil {
+		a.schedule, err = aschedule.New(a.configTree.Get("schedule"))
+	}
+	if invalid(err) {
+		err = aschedule.ErrEmptyConfig
+	}
 	switch err {
 	case aschedule.ErrEmptyConfig:
 		a.schedule = schedule.NopScheduler()
 		fallthrough
 	case nil:
+		if l, ok := a.schedule.(fileLocker); ok {
+			a.lockedFiles = append(a.lockedFiles, l)
+		}
+		for _, w := range opts.WrapScheduler {
+			a.schedule = w(a.schedule)
+		}
 		a.ctx = schedule.SchedulerWithContext(a.ctx, a.schedule)
 	default:
 		return nil, errors.Wrap(err, "error initialising scheduler")
 	}
 
-	a.cache, err = acache.New(a.configTree.Get("cache"))
+	a.cache, err = opts.Cache, nil
+	if a.cache == nil {
+		a.cache, err = acache.New(a.configTree.Get("cache"))
+	}
+	if invalid(err) {
+		err = acache.ErrEmptyConfig
+	}
 	switch err {
 	case acache.ErrEmptyConfig:
 		a.cache = cache.NopCache()
 		fallthrough
 	case nil:
+		for _, w := range opts.WrapCache {
+			a.cache = w(a.cache)
+		}
 		a.ctx = cache.WithContext(a.ctx, a.cache)
 	default:
 		return nil, errors.Wrap(err, "error initialising cache")
 	}
 
-	a.pubsub, err = apubsub.New(a.configTree.Get("net").Get("pubsub"))
+	a.lock, err = opts.Locker, nil
+	if a.lock == nil {
+		a.lock, err = alock.New(a.configTree.Get("lock"))
+	}
+	if invalid(err) {
+		err = alock.ErrEmptyConfig
+	}
+	switch err {
+	case alock.ErrEmptyConfig:
+		a.lock = lock.NewMemory()
+		fallthrough
+	case nil:
+		if l, ok := a.lock.(fileLocker); ok {
+			a.lockedFiles = append(a.lockedFiles, l)
+		}
+		for _, w := range opts.WrapLocker {
+			a.lock = w(a.lock)
+		}
+		a.ctx = lock.WithContext(a.ctx, a.lock)
+	default:
+		return nil, errors.Wrap(err, "error initialising locker")
+	}
+
+	a.pubsub, err = opts.PubSub, nil
+	if a.pubsub == nil {
+		a.pubsub, err = apubsub.New(a.configTree.Get("net").Get("pubsub"))
+	}
+	if invalid(err) {
+		err = apubsub.ErrEmptyConfig
+	}
 	switch err {
 	case apubsub.ErrEmptyConfig:
 		a.pubsub = pubsub.NopPubSub()
@@ -212,12 +372,21 @@ func NewWithConfig(
 		a.pubsub = pubsub.Stats(a.pubsub)
 		a.pubsub = pubsub.Log(a.pubsub)
 		a.pubsub = pubsub.Recover(a.pubsub)
+		for _, w := range opts.WrapPubSub {
+			a.pubsub = w(a.pubsub)
+		}
 		a.ctx = pubsub.WithContext(a.ctx, a.pubsub)
 	default:
 		return nil, errors.Wrap(err, "error initialising net/pubsub")
 	}
 
-	a.stream, err = astream.New(a.configTree.Get("net").Get("stream"))
+	a.stream, err = opts.Stream, nil
+	if a.stream == nil {
+		a.stream, err = astream.New(a.configTree.Get("net").Get("stream"))
+	}
+	if invalid(err) {
+		err = astream.ErrEmptyConfig
+	}
 	switch err {
 	case astream.ErrEmptyConfig:
 		a.stream = stream.NopStream()
@@ -227,11 +396,30 @@ func NewWithConfig(
 		a.stream = stream.Stats(a.stream)
 		a.stream = stream.Log(a.stream)
 		a.stream = stream.Recover(a.stream)
+		for _, w := range opts.WrapStream {
+			a.stream = w(a.stream)
+		}
 		a.ctx = stream.WithContext(a.ctx, a.stream)
 	default:
 		return nil, errors.Wrap(err, "error initialising net/stream")
 	}
 
+	a.admin, err = admin.New(a.configTree.Get("admin"), a)
+	if invalid(err) {
+		err = admin.ErrEmptyConfig
+	}
+	switch err {
+	case admin.ErrEmptyConfig, nil:
+	default:
+		return nil, errors.Wrap(err, "error initialising admin server")
+	}
+
+	// Report all config violations at once
+	if err := config.JoinValidationErrors(violations...); err != nil {
+		a.close()
+		return nil, errors.Wrap(err, "cannot unmarshal config")
+	}
+
 	// Trap OS signals
 	go trapSignals(a)
 
@@ -242,9 +430,12 @@ func NewWithConfig(
 	if err := a.BG().Dispatch(a.stats); err != nil {
 		return nil, err
 	}
-	if err := a.BG().Dispatch(&hearbeat{app: a}); err != nil {
+	if _, err := a.BG().Every(a, "heartbeat", heartbeatInterval, a.heartbeat); err != nil {
 		return nil, err
 	}
+	if err := a.cache.Start(a, a); err != nil {
+		return nil, errors.Wrap(err, "error starting cache")
+	}
 	if err := a.schedule.Start(a); err != nil {
 		return nil, errors.Wrap(err, "error starting scheduler")
 	}
@@ -254,6 +445,12 @@ func NewWithConfig(
 	if err := a.stream.Start(a); err != nil {
 		return nil, errors.Wrap(err, "error starting stream")
 	}
+
+	if a.admin != nil {
+		if err := a.admin.Start(); err != nil {
+			return nil, errors.Wrap(err, "error starting admin server")
+		}
+	}
 	return a, nil
 }
 
@@ -277,6 +474,14 @@ func (a *App) Serve() error {
 		)
 	}
 
+	a.Trace("spine.serve.components", "Start components...")
+	if err := a.components.Start(a); err != nil {
+		a.Error("spine.serve.components_err", "Error starting components",
+			log.Error(err),
+		)
+		return err
+	}
+
 	a.Trace("spine.serve", "Start serving...")
 
 	err := a.servers.Serve(a)
@@ -298,6 +503,13 @@ func (a *App) Serve() error {
 	a.ready.Broadcast()
 
 	atomic.StoreUint32(&a.state, up)
+
+	// Let the parent process drain when this process has been restarted
+	if err := net.NotifyReady(); err != nil {
+		a.Error("spine.serve.notify_err", "Cannot notify parent process",
+			log.Error(err),
+		)
+	}
 	<-a.stopc
 	return nil
 }
@@ -327,8 +539,9 @@ func (a *App) Config() *config.Config {
 	return &a.config
 }
 
+// ConfigTree returns the latest version of the config tree
 func (a *App) ConfigTree() config.Tree {
-	return a.configTree
+	return a.reloader.Tree()
 }
 
 func (a *App) BG() *bg.Reg {
@@ -352,51 +565,119 @@ func (a *App) Scheduler() schedule.Scheduler {
 	return a.schedule
 }
 
+// Locker returns the locker which stores leases
+func (a *App) Locker() lock.Locker {
+	return a.lock
+}
+
+// Health returns the health check registry
+func (a *App) Health() *health.Registry {
+	return a.health
+}
+
+// Breakers returns the circuit breakers of commands
+func (a *App) Breakers() *scontext.Breakers {
+	return a.breakers
+}
+
+// State returns the app state (down, up or drain)
+func (a *App) State() string {
+	return stateNames[atomic.LoadUint32(&a.state)]
+}
+
+// Servers returns the running servers by address
+func (a *App) Servers() map[string]net.Server {
+	return a.servers.Servers()
+}
+
+// Registrations returns the services registered to service discovery
+func (a *App) Registrations() []*disco.Registration {
+	return a.registrations
+}
+
 // Drain notify all handlers to enter in draining mode. It means they are no
-// longer accepting new requests, but they can finish all in-flight requests
+// longer accepting new requests, but they can finish all in-flight requests.
+// Drain is bounded by the shutdown budget (see config.Shutdown).
 func (a *App) Drain() bool {
+	ctx, cancel := a.shutdownContext(context.Background())
+	defer cancel()
+
+	ok, err := a.drain(ctx)
+	if err != nil {
+		a.Error("spine.drain.err", "Drain did not complete",
+			log.Error(err),
+		)
+	}
+	return ok
+}
+
+func (a *App) drain(ctx context.Context) (bool, error) {
 	a.mu.Lock()
 	if !a.isState(up) {
 		a.mu.Unlock()
-		return false
+		return false, nil
 	}
 	atomic.StoreUint32(&a.state, drain)
 	a.mu.Unlock()
 
 	a.Trace("spine.drain", "Start draining...")
 
+	// Stop receiving traffic from load balancers and service discovery
+	a.health.Drain()
+
 	// Notify all handlers
 	for _, h := range a.drainHandlers {
 		h(a)
 	}
+
+	budget := a.config.Shutdown
+	s := shutdown{ctx: ctx, log: a.log}
 	// Block all new requests and drain in-flight requests
-	a.servers.Drain()
-	a.Trace("spine.drain.schedule", "Start draining schedule...")
-	a.schedule.Drain()
-	a.Trace("spine.drain.stream", "Start draining stream...")
-	a.stream.Drain()
-	a.Trace("spine.drain.pubsub", "Start draining pubsub...")
-	a.pubsub.Drain()
-	a.Trace("spine.drain.bg", "Start draining background jobs...")
-	a.bg.Drain()
+	s.phase("servers", budget.Servers, a.servers.DrainContext)
+	s.phase("jobs", budget.Jobs, func(ctx context.Context) error {
+		jobs := shutdown{ctx: ctx, log: a.log}
+		jobs.phase("schedule", 0, wait(a.schedule.Drain))
+		jobs.phase("stream", 0, wait(a.stream.Drain))
+		jobs.phase("pubsub", 0, wait(a.pubsub.Drain))
+		jobs.phase("bg", 0, a.bg.DrainContext)
+		s.errors = append(s.errors, jobs.errors...)
+		return nil
+	})
+	s.phase("components", budget.Components, a.components.Stop)
 	a.Trace("spine.drain.ok", "Drained")
-	return true
+	return true, s.err()
 }
 
 // Shutdown gracefully shuts down the server without interrupting any
 // active connections. Shutdown works by first draining all handlers, then
 // draining the main context, and finally shut down.
-// If the provided context expires before the shutdown is complete,
-// Shutdown returns the context's error, otherwise it returns any
-// error returned from closing the Server's underlying Listener(s).
-func (a *App) Shutdown() {
+//
+// Shutdown is bounded by the shutdown budget (see config.Shutdown) and by the
+// ctx deadline. Phases which do not complete in time are abandoned, and the
+// app escalates to close. In that case, Shutdown returns a *ShutdownError.
+func (a *App) Shutdown(ctx context.Context) error {
 	a.Trace("spine.shutdown", "Gracefully shutting down...")
 	a.disco.Leave(a)
-	if !a.Drain() {
+
+	ctx, cancel := a.shutdownContext(ctx)
+	defer cancel()
+	ok, err := a.drain(ctx)
+	if !ok {
 		a.Trace("spine.shutdown.abort", "Server already draining")
-		return
+		return nil
 	}
 	a.close()
+	return err
+}
+
+// shutdownContext returns a context which expires with the shutdown budget
+func (a *App) shutdownContext(
+	ctx context.Context,
+) (context.Context, context.CancelFunc) {
+	if a.config.Shutdown.Timeout > 0 {
+		return context.WithTimeout(ctx, a.config.Shutdown.Timeout)
+	}
+	return context.WithCancel(ctx)
 }
 
 // Close immediately closes the server and any in-flight request or background
@@ -411,6 +692,11 @@ func (a *App) Close() error {
 
 func (a *App) close() {
 	a.schedule.Close()
+	a.components.Stop(a)
+	a.lock.Close()
+	if a.admin != nil {
+		a.admin.Close()
+	}
 	if c, ok := a.tracer.(io.Closer); ok {
 		c.Close()
 	}
@@ -465,6 +751,16 @@ func (a *App) RegisterDrainHandler(h func(ctx context.Context)) {
 	a.drainHandlers = append(a.drainHandlers, h)
 }
 
+// RegisterComponent adds a component which is started before the app serves
+// requests, and stopped once the app has drained.
+// Components are started in dependency order (see lifecycle.DependsOn) and
+// stopped in reverse order.
+func (a *App) RegisterComponent(
+	name string, c lifecycle.Component, o ...lifecycle.Option,
+) error {
+	return a.components.Register(name, c, o...)
+}
+
 // isState checks the current app state
 func (a *App) isState(state uint32) bool {
 	return atomic.LoadUint32(&a.state) == uint32(state)
@@ -513,6 +809,9 @@ func trapSignals(app *App) {
 		syscall.SIGQUIT,
 		syscall.SIGKILL,
 	}
+	if restartSignal != nil {
+		signals = append(signals, restartSignal)
+	}
 	signal.Notify(ch, signals...)
 
 	logger := app.L()
@@ -526,13 +825,26 @@ func trapSignals(app *App) {
 
 		switch sig {
 		case syscall.SIGINT, syscall.SIGTERM:
-			app.Shutdown()
+			if err := app.Shutdown(context.Background()); err != nil {
+				logger.Error("spine.shutdown.err", "Shutdown did not complete",
+					log.Error(err),
+				)
+			}
 			signal.Stop(ch)
 			return
 		case syscall.SIGQUIT, syscall.SIGKILL:
 			app.Close()
 			signal.Stop(ch)
 			return
+		case restartSignal:
+			// Keep trapping signals, because the restart can fail
+			go func() {
+				if err := app.Restart(context.Background()); err != nil {
+					logger.Error("spine.restart.err", "Restart failed",
+						log.Error(err),
+					)
+				}
+			}()
 		default:
 			logger.Error("spine.signal.unhandled", "Unhandled signal")
 			os.Exit(128 + int(n))
@@ -2,29 +2,16 @@ package bg
 
 import (
 	"context"
-
-	scontext "github.com/deixis/spine/context"
 )
 
+// BG runs f in background with a context carrying the values, transit and
+// shipments of parent. The context is cancelled when the registry drains.
 func BG(parent context.Context, f func(ctx context.Context)) error {
-	tr := scontext.TransitFromContext(parent)
-
-	return RegFromContext(parent).Dispatch(NewTask(func() {
-		ctx, cancel := context.WithCancel(context.WithoutCancel(parent))
-		defer cancel()
-
-		if tr != nil {
-			ctx = scontext.TransitWithContext(ctx, tr)
-		} else {
-			ctx, tr = scontext.NewTransitWithContext(ctx)
-		}
-		scontext.ShipmentRange(parent, func(k string, v interface{}) bool {
-			ctx = scontext.WithShipment(ctx, k, v)
-			return true
-		})
-
+	_, err := Go(parent, "bg", RunnerFunc(func(ctx context.Context) error {
 		f(ctx)
+		return nil
 	}))
+	return err
 }
 
 // Dispatch calls `Dispatch` on the context `Registry`
@@ -10,4 +10,38 @@
 // Package bg guarantee that a dispatched job will be started even a registry
 // is being asked to drain right after. However, there is a slim chance that
 // Stop() is called before Start().
+//
+// Jobs can also implement Runner. Draining cancels their context, and the
+// handle returned by Go reports their error.
+//
+//	h, err := bg.Go(ctx, "sync", bg.RunnerFunc(func(ctx context.Context) error {
+//		return sync(ctx)
+//	}))
+//	...
+//	err = h.Wait()
+//
+// Every runs a function periodically, with an initial delay, a jitter, a
+// timeout per run and a policy for runs which overlap. Each run gets its own
+// transit.
+//
+//	_, err := bg.Every(ctx, "sync", time.Minute, sync, bg.WithJitter(5*time.Second))
+//
+// With WithLeader, the function only runs on the instance elected leader of
+// the key (see disco.RunAsLeader), and runs are cancelled when the leadership
+// is lost.
+//
+// Jobs can also be dispatched to a named group, which runs them on a bounded
+// pool of workers. Jobs wait in the group queue until a worker is free, and
+// the overflow policy (Block, Reject or DropOldest) applies once the queue
+// is full. Queued jobs are still started and stopped when the registry drains.
+//
+//	g := reg.Group("map.update", bg.WithWorkers(4), bg.WithQueue(100))
+//	err := g.Dispatch(job)
+//
+// Long running jobs, such as consumer loops, can be supervised. A supervised
+// job is restarted with an exponential backoff when it panics or reports an
+// error (see Failer), and a job which restarts too often fails the app
+// liveness.
+//
+//	err := reg.Supervise("consumer", job, bg.WithMaxRestarts(5, time.Minute))
 package bg
@@ -0,0 +1,242 @@
+package bg
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"runtime/debug"
+	"time"
+
+	scontext "github.com/deixis/spine/context"
+	"github.com/deixis/spine/disco"
+	"github.com/deixis/spine/log"
+)
+
+// ErrInterval is the error returned when a periodic job has a non-positive
+// interval or a negative delay
+var ErrInterval = errors.New("interval must be positive and delay not negative")
+
+// Overlap defines what happens when a periodic job is due while its previous
+// run is still running
+type Overlap int
+
+const (
+	// SkipIfRunning skips the run
+	SkipIfRunning Overlap = iota
+	// QueueIfRunning runs the job again as soon as the previous run returns.
+	// At most one run is queued.
+	QueueIfRunning
+)
+
+// EveryOption configures a periodic job
+type EveryOption func(*EveryOptions)
+
+// EveryOptions configure a periodic job. EveryOptions are set by the
+// EveryOption values passed to Every.
+type EveryOptions struct {
+	// Delay is the delay before the first run (the interval by default)
+	Delay time.Duration
+	// Jitter is the maximum random delay added to each wait
+	Jitter time.Duration
+	// Overlap is the policy applied when a run is due while the previous run
+	// is still running (SkipIfRunning by default)
+	Overlap Overlap
+	// Timeout is the maximum duration of a run (no timeout by default)
+	Timeout time.Duration
+	// Leader is the election key of the job. When it is set, the job only
+	// runs on the instance elected leader of the key (see disco.RunAsLeader).
+	Leader string
+}
+
+// WithDelay sets the delay before the first run
+func WithDelay(d time.Duration) EveryOption {
+	return func(o *EveryOptions) {
+		o.Delay = d
+	}
+}
+
+// WithJitter sets the maximum random delay added to each wait
+func WithJitter(d time.Duration) EveryOption {
+	return func(o *EveryOptions) {
+		o.Jitter = d
+	}
+}
+
+// WithOverlap sets the policy applied when a run is due while the previous
+// run is still running
+func WithOverlap(p Overlap) EveryOption {
+	return func(o *EveryOptions) {
+		o.Overlap = p
+	}
+}
+
+// WithRunTimeout sets the maximum duration of a run
+func WithRunTimeout(d time.Duration) EveryOption {
+	return func(o *EveryOptions) {
+		o.Timeout = d
+	}
+}
+
+// WithLeader only runs the job on the instance elected leader of key. Runs
+// are cancelled when the leadership is lost, and the context given to fn
+// carries the leadership.
+func WithLeader(key string) EveryOption {
+	return func(o *EveryOptions) {
+		o.Leader = key
+	}
+}
+
+// Every calls `Every` on the context `Registry`
+func Every(
+	ctx context.Context,
+	name string,
+	interval time.Duration,
+	fn func(ctx context.Context) error,
+	o ...EveryOption,
+) (*Handle, error) {
+	return RegFromContext(ctx).Every(ctx, name, interval, fn, o...)
+}
+
+// Every runs fn every interval until the handle is cancelled or the registry
+// drains. Each run gets its own transit, so its logs can be correlated.
+// It returns ErrInterval when interval is not positive or the delay is
+// negative.
+func (r *Reg) Every(
+	ctx context.Context,
+	name string,
+	interval time.Duration,
+	fn func(ctx context.Context) error,
+	o ...EveryOption,
+) (*Handle, error) {
+	opts := EveryOptions{
+		Delay:   interval,
+		Overlap: SkipIfRunning,
+	}
+	for _, o := range o {
+		o(&opts)
+	}
+	if interval <= 0 || opts.Delay < 0 {
+		return nil, ErrInterval
+	}
+
+	p := &periodic{
+		reg:      r,
+		name:     name,
+		interval: interval,
+		fn:       fn,
+		opts:     opts,
+	}
+	return r.Go(ctx, name, p)
+}
+
+// periodic is a runner which runs fn periodically
+type periodic struct {
+	reg      *Reg
+	name     string
+	interval time.Duration
+	fn       func(ctx context.Context) error
+	opts     EveryOptions
+}
+
+func (p *periodic) Run(ctx context.Context) error {
+	if p.opts.Leader == "" {
+		p.loop(ctx)
+		return nil
+	}
+	return disco.RunAsLeader(ctx, p.opts.Leader, "", p.loop)
+}
+
+// loop runs fn periodically until ctx is done
+func (p *periodic) loop(ctx context.Context) {
+	timer := time.NewTimer(p.opts.Delay + p.jitter())
+	defer timer.Stop()
+
+	var running chan struct{}
+	var queued bool
+	for {
+		select {
+		case <-ctx.Done():
+			if running != nil {
+				<-running
+			}
+			return
+		case <-timer.C:
+			timer.Reset(p.interval + p.jitter())
+			if running == nil {
+				running = p.start(ctx)
+				continue
+			}
+			if p.opts.Overlap == QueueIfRunning {
+				queued = true
+				continue
+			}
+			p.reg.log.Trace("bg.every.skip", "Skip run",
+				log.String("name", p.name),
+			)
+			p.reg.stats.Inc("bg.every.skip", p.tags())
+		case <-running:
+			running = nil
+			if queued {
+				queued = false
+				running = p.start(ctx)
+			}
+		}
+	}
+}
+
+// start runs fn in background and returns a channel closed when it returns
+func (p *periodic) start(parent context.Context) chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		ctx, _ := scontext.NewTransitWithContext(parent)
+		if p.opts.Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, p.opts.Timeout)
+			defer cancel()
+		}
+
+		start := time.Now()
+		err := p.run(ctx)
+		tags := p.tags()
+		tags["status"] = "ok"
+		if err != nil {
+			tags["status"] = "error"
+			fields := []log.Field{
+				log.String("name", p.name),
+				log.Error(err),
+			}
+			if perr, ok := err.(*PanicError); ok {
+				fields = append(fields, log.String("stack", string(perr.Stack)))
+			}
+			log.Warn(ctx, "bg.every.err", "Periodic job failed", fields...)
+		}
+		p.reg.stats.Timing("bg.every.run", time.Since(start), tags)
+	}()
+	return done
+}
+
+// run calls fn and recovers panics
+func (p *periodic) run(ctx context.Context) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+	return p.fn(ctx)
+}
+
+func (p *periodic) jitter() time.Duration {
+	if p.opts.Jitter <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(p.opts.Jitter)))
+}
+
+func (p *periodic) tags() map[string]string {
+	return map[string]string{
+		"service": p.reg.service,
+		"name":    p.name,
+	}
+}
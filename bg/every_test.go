@@ -0,0 +1,164 @@
+package bg_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/deixis/spine/bg"
+	scontext "github.com/deixis/spine/context"
+	"github.com/deixis/spine/disco"
+)
+
+// TestEvery tests whether a periodic job runs with a transit per run until the
+// registry drains
+func TestEvery(t *testing.T) {
+	reg := bg.NewReg("TestEvery", context.Background())
+
+	var mu sync.Mutex
+	transits := map[string]bool{}
+	h, err := reg.Every(context.Background(), "tick", time.Millisecond, func(ctx context.Context) error {
+		mu.Lock()
+		defer mu.Unlock()
+		transits[scontext.TransitFromContext(ctx).UUID()] = true
+		return nil
+	}, bg.WithDelay(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	reg.Drain()
+	select {
+	case <-h.Done():
+	default:
+		t.Fatal("expect drain to stop periodic job")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(transits) < 2 {
+		t.Errorf("expect a distinct transit per run, but got %d", len(transits))
+	}
+}
+
+// TestEveryOverlap tests whether overlapping runs are skipped or queued
+func TestEveryOverlap(t *testing.T) {
+	for _, overlap := range []bg.Overlap{bg.SkipIfRunning, bg.QueueIfRunning} {
+		reg := bg.NewReg("TestEveryOverlap", context.Background())
+
+		var running, max, runs int32
+		_, err := reg.Every(context.Background(), "slow", time.Millisecond, func(ctx context.Context) error {
+			if n := atomic.AddInt32(&running, 1); n > atomic.LoadInt32(&max) {
+				atomic.StoreInt32(&max, n)
+			}
+			atomic.AddInt32(&runs, 1)
+			time.Sleep(10 * time.Millisecond)
+			atomic.AddInt32(&running, -1)
+			return nil
+		}, bg.WithDelay(0), bg.WithOverlap(overlap))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		time.Sleep(35 * time.Millisecond)
+		reg.Drain()
+		if max != 1 {
+			t.Errorf("expect runs not to overlap, but got %d concurrent runs", max)
+		}
+		if runs < 2 || runs > 5 {
+			t.Errorf("expect 2 to 5 runs, but got %d", runs)
+		}
+	}
+}
+
+// TestEveryTimeout tests whether a run is cancelled after its timeout
+func TestEveryTimeout(t *testing.T) {
+	reg := bg.NewReg("TestEveryTimeout", context.Background())
+	defer reg.Drain()
+
+	timedOut := make(chan error, 1)
+	_, err := reg.Every(context.Background(), "hung", time.Hour, func(ctx context.Context) error {
+		<-ctx.Done()
+		timedOut <- ctx.Err()
+		return ctx.Err()
+	}, bg.WithDelay(0), bg.WithRunTimeout(time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-timedOut:
+		if err != context.DeadlineExceeded {
+			t.Errorf("expect context.DeadlineExceeded, but got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expect run to time out")
+	}
+}
+
+// TestEveryInterval tests whether invalid intervals and delays are rejected
+func TestEveryInterval(t *testing.T) {
+	reg := bg.NewReg("TestEveryInterval", context.Background())
+	defer reg.Drain()
+
+	fn := func(ctx context.Context) error { return nil }
+	if _, err := reg.Every(context.Background(), "zero", 0, fn); err != bg.ErrInterval {
+		t.Errorf("expect ErrInterval, but got %v", err)
+	}
+	if _, err := reg.Every(context.Background(), "negative", -time.Second, fn); err != bg.ErrInterval {
+		t.Errorf("expect ErrInterval, but got %v", err)
+	}
+	_, err := reg.Every(context.Background(), "delay", time.Second, fn, bg.WithDelay(-time.Second))
+	if err != bg.ErrInterval {
+		t.Errorf("expect ErrInterval, but got %v", err)
+	}
+}
+
+// TestEveryLeader tests whether a periodic job only runs on the leader, and
+// whether another instance takes over once the leader stops
+func TestEveryLeader(t *testing.T) {
+	ctx := disco.AgentWithContext(context.Background(), disco.NewLocalAgent())
+
+	var runs [2]int32
+	var notLeader int32
+	regs := make([]*bg.Reg, 2)
+	for i := range regs {
+		i := i
+		regs[i] = bg.NewReg("TestEveryLeader", ctx)
+		defer regs[i].Drain()
+		_, err := regs[i].Every(ctx, "cron", time.Millisecond, func(ctx context.Context) error {
+			if !disco.IsLeader(ctx, "cron") {
+				atomic.AddInt32(&notLeader, 1)
+			}
+			atomic.AddInt32(&runs[i], 1)
+			return nil
+		}, bg.WithDelay(0), bg.WithLeader("cron"))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	leader, follower := 0, 1
+	if atomic.LoadInt32(&runs[1]) > 0 {
+		leader, follower = 1, 0
+	}
+	if atomic.LoadInt32(&runs[leader]) == 0 || atomic.LoadInt32(&runs[follower]) != 0 {
+		t.Fatalf("expect only the leader to run, but got %d and %d runs", runs[0], runs[1])
+	}
+
+	regs[leader].Drain()
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&runs[follower]) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expect follower to take over")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if n := atomic.LoadInt32(&notLeader); n != 0 {
+		t.Errorf("expect runs to carry the leadership, but got %d runs without", n)
+	}
+}
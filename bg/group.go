@@ -0,0 +1,371 @@
+package bg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/deixis/spine/log"
+)
+
+// ErrQueueFull is the error returned when a job is dispatched to a group whose
+// workers are busy and whose queue is full
+var ErrQueueFull = errors.New("group queue is full")
+
+// Overflow defines what happens when a job is dispatched to a group whose
+// workers are busy and whose queue is full
+type Overflow int
+
+const (
+	// Block blocks Dispatch until the queue has room
+	Block Overflow = iota
+	// Reject rejects the job with ErrQueueFull
+	Reject
+	// DropOldest drops the oldest queued job to make room. The dropped job is
+	// never started.
+	DropOldest
+)
+
+var overflowNames = map[Overflow]string{
+	Block:      "block",
+	Reject:     "reject",
+	DropOldest: "drop_oldest",
+}
+
+func (o Overflow) String() string {
+	return overflowNames[o]
+}
+
+// GroupOption configures a group
+type GroupOption func(*GroupOptions)
+
+// GroupOptions configure a group. GroupOptions are set by the GroupOption
+// values passed to Reg.Group.
+type GroupOptions struct {
+	// Workers is the maximum number of jobs running concurrently (1 by default)
+	Workers int
+	// Queue is the maximum number of jobs waiting for a worker
+	Queue int
+	// Overflow is the policy applied when the queue is full
+	Overflow Overflow
+}
+
+// WithWorkers sets the maximum number of jobs running concurrently
+func WithWorkers(n int) GroupOption {
+	return func(o *GroupOptions) {
+		o.Workers = n
+	}
+}
+
+// WithQueue sets the maximum number of jobs waiting for a worker
+func WithQueue(n int) GroupOption {
+	return func(o *GroupOptions) {
+		o.Queue = n
+	}
+}
+
+// WithOverflow sets the policy applied when the queue is full
+func WithOverflow(p Overflow) GroupOption {
+	return func(o *GroupOptions) {
+		o.Overflow = p
+	}
+}
+
+// GroupStats contains the statistics of a group
+type GroupStats struct {
+	Name     string `json:"name"`
+	Workers  int    `json:"workers"`
+	Queue    int    `json:"queue"`
+	Overflow string `json:"overflow"`
+	// Running is the number of jobs running
+	Running int `json:"running"`
+	// Queued is the number of jobs waiting for a worker
+	Queued int `json:"queued"`
+	// Dropped is the number of queued jobs dropped (DropOldest)
+	Dropped uint64 `json:"dropped"`
+	// Rejected is the number of jobs rejected (Reject)
+	Rejected uint64 `json:"rejected"`
+}
+
+// Group runs jobs on a bounded pool of workers
+type Group struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+
+	name string
+	opts GroupOptions
+	reg  *Reg
+
+	queue   []queued
+	running map[Job]time.Time
+	// active is the number of workers
+	active int
+
+	drain bool
+	// idle is closed once the group has drained
+	idle chan struct{}
+
+	dropped  uint64
+	rejected uint64
+}
+
+type queued struct {
+	job Job
+	at  time.Time
+}
+
+// Group returns the named group and creates it with o when it does not exist
+func (r *Reg) Group(name string, o ...GroupOption) *Group {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if g, ok := r.groups[name]; ok {
+		return g
+	}
+
+	opts := GroupOptions{Workers: 1}
+	for _, o := range o {
+		o(&opts)
+	}
+	if opts.Workers < 1 {
+		opts.Workers = 1
+	}
+	g := &Group{
+		name:    name,
+		opts:    opts,
+		reg:     r,
+		running: map[Job]time.Time{},
+		drain:   r.drain,
+		idle:    make(chan struct{}),
+	}
+	g.cond = sync.NewCond(&g.mu)
+	if g.drain {
+		close(g.idle)
+	}
+	r.groups[name] = g
+	return g
+}
+
+// Groups returns the statistics of all groups sorted by name
+func (r *Reg) Groups() []GroupStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	l := make([]GroupStats, 0, len(r.groups))
+	for _, g := range r.groups {
+		l = append(l, g.Stats())
+	}
+	sort.Slice(l, func(i, j int) bool {
+		return l[i].Name < l[j].Name
+	})
+	return l
+}
+
+// DispatchGroup calls `Dispatch` on the named group of the context `Reg`
+func DispatchGroup(ctx context.Context, group string, j Job) error {
+	return RegFromContext(ctx).Group(group).Dispatch(j)
+}
+
+// Dispatch runs the job on a free worker, or queues it. When the queue is
+// full, the overflow policy applies.
+func (g *Group) Dispatch(j Job) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for {
+		if g.drain {
+			return ErrDrain
+		}
+		if g.has(j) {
+			return ErrDup
+		}
+
+		switch {
+		case g.active < g.opts.Workers:
+			g.active++
+			go g.run(queued{job: j, at: time.Now()})
+			return nil
+		case len(g.queue) < g.opts.Queue:
+			g.queue = append(g.queue, queued{job: j, at: time.Now()})
+			g.addStats()
+			return nil
+		}
+
+		switch g.opts.Overflow {
+		case Reject:
+			g.rejected++
+			g.reg.stats.Inc("bg.group.rejected", g.tags())
+			return ErrQueueFull
+		case DropOldest:
+			if len(g.queue) == 0 {
+				g.rejected++
+				g.reg.stats.Inc("bg.group.rejected", g.tags())
+				return ErrQueueFull
+			}
+			g.reg.log.Warning("bg.group.drop", "Drop oldest queued job",
+				log.String("group", g.name),
+				log.Type("j", g.queue[0].job),
+				log.Ptr("addr", g.queue[0].job),
+			)
+			g.dropped++
+			g.reg.stats.Inc("bg.group.dropped", g.tags())
+			g.queue = append(g.queue[1:], queued{job: j, at: time.Now()})
+			return nil
+		default:
+			g.cond.Wait()
+		}
+	}
+}
+
+// Stats returns the group statistics
+func (g *Group) Stats() GroupStats {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return GroupStats{
+		Name:     g.name,
+		Workers:  g.opts.Workers,
+		Queue:    g.opts.Queue,
+		Overflow: g.opts.Overflow.String(),
+		Running:  len(g.running),
+		Queued:   len(g.queue),
+		Dropped:  g.dropped,
+		Rejected: g.rejected,
+	}
+}
+
+// run runs q and then the queued jobs until the queue is empty
+func (g *Group) run(q queued) {
+	for {
+		g.reg.stats.Timing("bg.group.wait", time.Since(q.at), g.tags())
+
+		g.mu.Lock()
+		g.running[q.job] = time.Now()
+		drain := g.drain
+		g.mu.Unlock()
+
+		g.reg.log.Trace("bg.job.start", "Start job",
+			log.String("group", g.name),
+			log.Type("j", q.job),
+			log.Ptr("addr", q.job),
+		)
+		if drain {
+			// Jobs dequeued while draining are stopped right away
+			go q.job.Stop()
+		}
+		q.job.Start()
+		if f, ok := q.job.(Failer); ok {
+			g.reg.logFailure(q.job, f.Err())
+		}
+
+		g.mu.Lock()
+		delete(g.running, q.job)
+		if len(g.queue) == 0 {
+			g.active--
+			if g.drain && g.active == 0 {
+				close(g.idle)
+			}
+			g.cond.Broadcast()
+			g.mu.Unlock()
+			return
+		}
+		q = g.queue[0]
+		g.queue = g.queue[1:]
+		g.addStats()
+		g.cond.Broadcast()
+		g.mu.Unlock()
+	}
+}
+
+// drainContext rejects new jobs, stops running jobs and waits for queued jobs
+// to be started and stopped, until ctx is done
+func (g *Group) drainContext(ctx context.Context) error {
+	g.mu.Lock()
+	if g.drain {
+		g.mu.Unlock()
+		return nil
+	}
+	g.drain = true
+	if g.active == 0 {
+		close(g.idle)
+	}
+	g.cond.Broadcast()
+	for j := range g.running {
+		g.reg.log.Trace("bg.job.stop", "Stop job",
+			log.String("group", g.name),
+			log.Type("j", j),
+			log.Ptr("addr", j),
+		)
+		go j.Stop()
+	}
+	g.mu.Unlock()
+
+	select {
+	case <-g.idle:
+		return nil
+	case <-ctx.Done():
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	abandoned := len(g.running) + len(g.queue)
+	for j := range g.running {
+		g.reg.log.Warning("bg.job.abandon", "Abandon job",
+			log.String("group", g.name),
+			log.Type("j", j),
+			log.Ptr("addr", j),
+		)
+	}
+	for _, q := range g.queue {
+		g.reg.log.Warning("bg.job.abandon", "Abandon queued job",
+			log.String("group", g.name),
+			log.Type("j", q.job),
+			log.Ptr("addr", q.job),
+		)
+	}
+	return fmt.Errorf("%w (group %s: %d jobs abandoned): %v",
+		ErrDrainTimeout, g.name, abandoned, ctx.Err(),
+	)
+}
+
+// snapshot returns the running jobs
+func (g *Group) snapshot() []JobInfo {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	l := make([]JobInfo, 0, len(g.running))
+	for j, started := range g.running {
+		info := jobInfo(j)
+		info.Group = g.name
+		info.Started = started
+		l = append(l, info)
+	}
+	return l
+}
+
+// has returns whether j is running or queued. The caller must hold the lock.
+func (g *Group) has(j Job) bool {
+	if _, ok := g.running[j]; ok {
+		return true
+	}
+	for _, q := range g.queue {
+		if q.job == j {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *Group) addStats() {
+	g.reg.stats.Gauge("bg.group.queue", len(g.queue), g.tags())
+}
+
+func (g *Group) tags() map[string]string {
+	return map[string]string{
+		"service": g.reg.service,
+		"group":   g.name,
+	}
+}
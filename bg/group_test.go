@@ -0,0 +1,174 @@
+package bg_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/deixis/spine/bg"
+)
+
+// TestGroupWorkers tests whether a group runs at most Workers jobs at a time
+func TestGroupWorkers(t *testing.T) {
+	reg := bg.NewReg("TestGroupWorkers", context.Background())
+	g := reg.Group("map.update", bg.WithWorkers(4), bg.WithQueue(100))
+
+	var running, max int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		err := g.Dispatch(bg.NewTask(func() {
+			defer wg.Done()
+			n := atomic.AddInt32(&running, 1)
+			for {
+				m := atomic.LoadInt32(&max)
+				if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+			atomic.AddInt32(&running, -1)
+		}))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+
+	if max > 4 {
+		t.Errorf("expect at most 4 concurrent jobs, but got %d", max)
+	}
+}
+
+// TestGroupOverflow tests the overflow policies
+func TestGroupOverflow(t *testing.T) {
+	reg := bg.NewReg("TestGroupOverflow", context.Background())
+	block := make(chan struct{})
+	defer close(block)
+
+	// Reject
+	g := reg.Group("reject", bg.WithQueue(1), bg.WithOverflow(bg.Reject))
+	for i := 0; i < 2; i++ {
+		if err := g.Dispatch(bg.NewTask(func() { <-block })); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := g.Dispatch(bg.NewTask(func() {})); err != bg.ErrQueueFull {
+		t.Errorf("expect ErrQueueFull, but got %v", err)
+	}
+	if s := g.Stats(); s.Rejected != 1 || s.Queued != 1 {
+		t.Errorf("expect 1 rejected and 1 queued job, but got %+v", s)
+	}
+
+	// Drop oldest
+	g = reg.Group("drop", bg.WithQueue(1), bg.WithOverflow(bg.DropOldest))
+	for i := 0; i < 3; i++ {
+		if err := g.Dispatch(bg.NewTask(func() { <-block })); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s := g.Stats(); s.Dropped != 1 || s.Queued != 1 {
+		t.Errorf("expect 1 dropped and 1 queued job, but got %+v", s)
+	}
+
+	// Block
+	unblock := make(chan struct{})
+	g = reg.Group("block", bg.WithQueue(1))
+	for i := 0; i < 2; i++ {
+		if err := g.Dispatch(bg.NewTask(func() { <-unblock })); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dispatched := make(chan error)
+	go func() {
+		dispatched <- g.Dispatch(bg.NewTask(func() {}))
+	}()
+	select {
+	case err := <-dispatched:
+		t.Fatalf("expect Dispatch to block, but got %v", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+	close(unblock)
+	if err := <-dispatched; err != nil {
+		t.Error(err)
+	}
+
+	stats := reg.Groups()
+	if len(stats) != 3 || stats[0].Name != "block" || stats[2].Name != "reject" {
+		t.Errorf("expect groups sorted by name, but got %+v", stats)
+	}
+}
+
+// TestGroupDrain tests whether queued jobs are started and stopped on drain
+func TestGroupDrain(t *testing.T) {
+	reg := bg.NewReg("TestGroupDrain", context.Background())
+	g := reg.Group("drain", bg.WithWorkers(2), bg.WithQueue(10))
+
+	jobs := make([]*stopJob, 6)
+	for i := range jobs {
+		jobs[i] = newStopJob()
+		if err := g.Dispatch(jobs[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := reg.DrainContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, j := range jobs {
+		select {
+		case <-j.done:
+		default:
+			t.Errorf("expect job %d to be started and stopped", i)
+		}
+	}
+	if err := g.Dispatch(newStopJob()); err != bg.ErrDrain {
+		t.Errorf("expect ErrDrain, but got %v", err)
+	}
+}
+
+// TestGroupDrainTimeout tests whether a group abandons jobs which do not stop
+// before the deadline
+func TestGroupDrainTimeout(t *testing.T) {
+	reg := bg.NewReg("TestGroupDrainTimeout", context.Background())
+	block := make(chan struct{})
+	defer close(block)
+
+	g := reg.Group("hung", bg.WithQueue(1))
+	if err := g.Dispatch(bg.NewTask(func() { <-block })); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := reg.DrainContext(ctx)
+	if !errors.Is(err, bg.ErrDrainTimeout) {
+		t.Errorf("expect ErrDrainTimeout, but got %v", err)
+	}
+}
+
+// stopJob runs until it is stopped
+type stopJob struct {
+	once sync.Once
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newStopJob() *stopJob {
+	return &stopJob{
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+}
+
+func (j *stopJob) Start() {
+	<-j.stop
+	close(j.done)
+}
+
+func (j *stopJob) Stop() {
+	j.once.Do(func() { close(j.stop) })
+}
@@ -3,7 +3,10 @@ package bg
 import (
 	"context"
 	"errors"
+	"fmt"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/deixis/spine/log"
 	"github.com/deixis/spine/stats"
@@ -16,6 +19,10 @@ var ErrDrain = errors.New("registry is draining")
 // ErrDup is the error returned when a new job has already been registered
 var ErrDup = errors.New("job has already been registered")
 
+// ErrDrainTimeout is the error returned when jobs do not stop before the
+// deadline
+var ErrDrainTimeout = errors.New("jobs did not stop in time")
+
 // Job is a an interface to implement to be a background job
 type Job interface {
 	Start()
@@ -32,6 +39,7 @@ type Reg struct {
 	log     log.Logger
 	stats   stats.Stats
 	jobs    map[Job]*status
+	groups  map[string]*Group
 }
 
 // NewReg builds a new registry
@@ -42,6 +50,7 @@ func NewReg(service string, ctx context.Context) *Reg {
 		log:     log.FromContext(ctx),
 		stats:   stats.FromContext(ctx),
 		jobs:    map[Job]*status{},
+		groups:  map[string]*Group{},
 	}
 }
 
@@ -61,7 +70,7 @@ func (r *Reg) Dispatch(j Job) error {
 	}
 
 	// Add it to registry
-	s := r.register(j)
+	s := r.register(j, jobInfo(j))
 
 	go func() {
 		// Deregister itself upon completion
@@ -78,33 +87,124 @@ func (r *Reg) Dispatch(j Job) error {
 		)
 		s.started <- struct{}{}
 		j.Start()
+		if f, ok := j.(Failer); ok {
+			r.logFailure(j, f.Err())
+		}
 	}()
 
 	return nil
 }
 
-// Drain sends a Stop() signal to all registered jobs and rejects new jobs
-func (r *Reg) Drain() {
+// Jobs returns the registered jobs, including the jobs running in groups
+func (r *Reg) Jobs() []Job {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
+	l := make([]Job, 0, len(r.jobs))
+	for j := range r.jobs {
+		l = append(l, j)
+	}
+	for _, g := range r.groups {
+		g.mu.Lock()
+		for j := range g.running {
+			l = append(l, j)
+		}
+		g.mu.Unlock()
+	}
+	return l
+}
+
+// JobInfo describes a running job
+type JobInfo struct {
+	// Name is the job name, or its type for jobs dispatched with Dispatch
+	Name string `json:"name"`
+	// Group is the group running the job, if any
+	Group string `json:"group,omitempty"`
+	// Started is the time the job has been dispatched
+	Started time.Time `json:"started"`
+	// Transit is the ID of the transit which dispatched the job, if any
+	Transit string `json:"transit,omitempty"`
+}
+
+// jobInfo returns the description of a job before it is started
+func jobInfo(j Job) JobInfo {
+	if rj, ok := j.(*runJob); ok {
+		return JobInfo{Name: rj.name, Transit: rj.transit}
+	}
+	return JobInfo{Name: fmt.Sprintf("%T", j)}
+}
+
+// Snapshot returns the running jobs, including the jobs running in groups,
+// oldest first
+func (r *Reg) Snapshot() []JobInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	l := make([]JobInfo, 0, len(r.jobs))
+	for _, s := range r.jobs {
+		l = append(l, s.info)
+	}
+	for _, g := range r.groups {
+		l = append(l, g.snapshot()...)
+	}
+	sort.Slice(l, func(i, j int) bool {
+		return l[i].Started.Before(l[j].Started)
+	})
+	return l
+}
+
+// DrainTimeout is the maximum duration of Drain
+var DrainTimeout = 30 * time.Second
+
+// Drain sends a Stop() signal to all registered jobs and rejects new jobs.
+// It stops waiting for jobs after DrainTimeout (see DrainContext).
+func (r *Reg) Drain() {
+	ctx, cancel := context.WithTimeout(context.Background(), DrainTimeout)
+	defer cancel()
+	r.DrainContext(ctx)
+}
+
+// DrainContext is like Drain, but it stops waiting once ctx is done. Jobs
+// which have not stopped by then are abandoned and logged.
+func (r *Reg) DrainContext(ctx context.Context) error {
+	r.mu.Lock()
 	// Check if we are already draining
 	if r.drain {
-		return
+		r.mu.Unlock()
+		return nil
 	}
 	r.drain = true
 
-	// Build WG
-	wg := &sync.WaitGroup{}
-	wg.Add(len(r.jobs))
+	// No job can be added from now on, so the registry does not need to be
+	// locked while waiting, and it can still be inspected (e.g. Snapshot)
+	jobs := make(map[Job]*status, len(r.jobs))
+	for j, s := range r.jobs {
+		jobs[j] = s
+	}
+	groups := make([]*Group, 0, len(r.groups))
+	for _, g := range r.groups {
+		groups = append(groups, g)
+	}
+	r.mu.Unlock()
 
 	// Start draining jobs
 	r.log.Trace("bg.drain.start", "Draining registry",
-		log.Int("jobs", len(r.jobs)),
+		log.Int("jobs", len(jobs)),
 	)
-	for j, s := range r.jobs {
+	// Groups drain concurrently with jobs
+	groupErrs := make(chan error, len(groups))
+	for _, g := range groups {
+		go func(g *Group) {
+			groupErrs <- g.drainContext(ctx)
+		}(g)
+	}
+
+	done := make(map[Job]chan struct{}, len(jobs))
+	for j, s := range jobs {
+		c := make(chan struct{})
+		done[j] = c
 		go func(j Job, s *status) {
-			defer wg.Done()
+			defer close(c)
 
 			// Wait for job to be started
 			<-s.started
@@ -118,12 +218,62 @@ func (r *Reg) Drain() {
 		}(j, s)
 	}
 
-	wg.Wait()
+	var abandoned int
+	for j, c := range done {
+		select {
+		case <-c:
+			continue
+		case <-ctx.Done():
+		}
+		select {
+		case <-c:
+		default:
+			abandoned++
+			r.log.Warning("bg.job.abandon", "Abandon job",
+				log.Type("j", j),
+				log.Ptr("addr", j),
+			)
+		}
+	}
+	var err error
+	if abandoned > 0 {
+		err = fmt.Errorf("%w (%d jobs abandoned): %v",
+			ErrDrainTimeout, abandoned, ctx.Err(),
+		)
+	}
+	for range groups {
+		if gerr := <-groupErrs; gerr != nil && err == nil {
+			err = gerr
+		}
+	}
+	if err != nil {
+		return err
+	}
 	r.log.Trace("bg.drain.done", "Registry drained")
+	return nil
+}
+
+// logFailure logs the error reported by a job, with the stack trace when the
+// job panicked
+func (r *Reg) logFailure(j Job, err error) {
+	if err == nil {
+		return
+	}
+	fields := []log.Field{
+		log.Type("j", j),
+		log.Ptr("addr", j),
+		log.Error(err),
+	}
+	if perr, ok := err.(*PanicError); ok {
+		fields = append(fields, log.String("stack", string(perr.Stack)))
+	}
+	r.log.Error("bg.job.fail", "Job failed", fields...)
 }
 
-func (r *Reg) register(j Job) *status {
+func (r *Reg) register(j Job, info JobInfo) *status {
+	info.Started = time.Now()
 	s := &status{
+		info:    info,
 		started: make(chan struct{}, 1),
 	}
 	r.jobs[j] = s
@@ -145,5 +295,6 @@ func (r *Reg) addStats() {
 }
 
 type status struct {
+	info    JobInfo
 	started chan struct{}
 }
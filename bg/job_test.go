@@ -2,6 +2,7 @@ package bg_test
 
 import (
 	"context"
+	"errors"
 	"sync"
 	"testing"
 	"time"
@@ -90,6 +91,85 @@ func TestJobDraining(t *testing.T) {
 	}
 }
 
+// TestJobDrainTimeout tests whether the registry abandons jobs which do not
+// stop before the deadline
+func TestJobDrainTimeout(t *testing.T) {
+	reg := bg.NewReg("TestJobDrainTimeout", context.Background())
+
+	block := make(chan struct{})
+	defer close(block)
+	if err := reg.Dispatch(bg.NewTask(func() { <-block })); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := reg.DrainContext(ctx)
+	if !errors.Is(err, bg.ErrDrainTimeout) {
+		t.Errorf("expect ErrDrainTimeout, but got %v", err)
+	}
+}
+
+// TestJobDrainDefaultTimeout tests whether Drain abandons a job which never
+// returns
+func TestJobDrainDefaultTimeout(t *testing.T) {
+	timeout := bg.DrainTimeout
+	bg.DrainTimeout = 10 * time.Millisecond
+	defer func() { bg.DrainTimeout = timeout }()
+
+	reg := bg.NewReg("TestJobDrainDefaultTimeout", context.Background())
+	block := make(chan struct{})
+	defer close(block)
+	if err := reg.Dispatch(bg.NewTask(func() { <-block })); err != nil {
+		t.Fatal(err)
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		reg.Drain()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-time.After(time.Second):
+		t.Fatal("expect Drain to return after DrainTimeout")
+	}
+}
+
+// TestJobDrainSnapshot tests whether the registry can be inspected while it
+// waits for jobs to stop
+func TestJobDrainSnapshot(t *testing.T) {
+	reg := bg.NewReg("TestJobDrainSnapshot", context.Background())
+
+	block := make(chan struct{})
+	if err := reg.Dispatch(bg.NewTask(func() { <-block })); err != nil {
+		t.Fatal(err)
+	}
+	drained := make(chan struct{})
+	go func() {
+		reg.Drain()
+		close(drained)
+	}()
+	defer func() {
+		close(block)
+		<-drained
+	}()
+
+	snapshot := make(chan []bg.JobInfo)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		snapshot <- reg.Snapshot()
+	}()
+	select {
+	case l := <-snapshot:
+		if len(l) != 1 {
+			t.Errorf("expect 1 job being drained, but got %d", len(l))
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expect Snapshot not to block during drain")
+	}
+}
+
 type DummyJob struct {
 	mu      sync.Mutex
 	started bool          // has been started
@@ -1,10 +1,30 @@
 package bg
 
-import "time"
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// Failer is implemented by jobs which can report why they returned. Err is
+// called after Start returns.
+type Failer interface {
+	Err() error
+}
+
+// PanicError is the error reported by a job which panicked
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("job panic: %v", e.Value)
+}
 
 // Task is a background job for simple long running tasks
 type Task struct {
 	done chan struct{}
+	err  error
 	f    func()
 }
 
@@ -17,17 +37,32 @@ func NewTask(f func()) *Task {
 }
 
 func (t *Task) Start() {
+	// Discard the completion of a previous run
+	select {
+	case <-t.done:
+	default:
+	}
+	t.err = nil
 	defer func() {
-		recover()
-		t.done <- struct{}{}
+		if r := recover(); r != nil {
+			t.err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+		select {
+		case t.done <- struct{}{}:
+		default:
+		}
 	}()
 
 	t.f()
 }
 
+// Stop waits for the task to complete. The deadline is set by the registry
+// (see Reg.DrainContext).
 func (t *Task) Stop() {
-	select {
-	case <-t.done:
-	case <-time.After(time.Second * 10):
-	}
+	<-t.done
+}
+
+// Err returns the panic of the last run, if any
+func (t *Task) Err() error {
+	return t.err
 }
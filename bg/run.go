@@ -0,0 +1,138 @@
+package bg
+
+import (
+	"context"
+	"errors"
+	"runtime/debug"
+
+	scontext "github.com/deixis/spine/context"
+)
+
+// Runner is a job which runs until it is done or until its context is
+// cancelled. The context is cancelled when the registry drains.
+type Runner interface {
+	Run(ctx context.Context) error
+}
+
+// RunnerFunc is an adapter to use an ordinary function as a Runner
+type RunnerFunc func(ctx context.Context) error
+
+// Run calls f(ctx)
+func (f RunnerFunc) Run(ctx context.Context) error {
+	return f(ctx)
+}
+
+// Handle controls a job dispatched with Go
+type Handle struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error
+}
+
+// Wait waits for the job to return and returns its error
+func (h *Handle) Wait() error {
+	<-h.done
+	return h.err
+}
+
+// Done returns a channel which is closed once the job has returned
+func (h *Handle) Done() <-chan struct{} {
+	return h.done
+}
+
+// Err returns the error of the job, or nil while it is running
+func (h *Handle) Err() error {
+	select {
+	case <-h.done:
+		return h.err
+	default:
+		return nil
+	}
+}
+
+// Cancel cancels the job context. It does not wait for the job to return.
+func (h *Handle) Cancel() {
+	h.cancel()
+}
+
+// Go calls `Go` on the context `Registry`
+func Go(ctx context.Context, name string, run Runner) (*Handle, error) {
+	return RegFromContext(ctx).Go(ctx, name, run)
+}
+
+// Go dispatches run. The job context carries the values, transit and
+// shipments of ctx, but it is only cancelled by the handle or when the
+// registry drains.
+func (r *Reg) Go(ctx context.Context, name string, run Runner) (*Handle, error) {
+	j := newRunJob(ctx, name, run)
+	if err := r.Dispatch(j); err != nil {
+		j.cancel()
+		return nil, err
+	}
+	return j.handle, nil
+}
+
+// runJob adapts a Runner to a Job
+type runJob struct {
+	name    string
+	transit string
+	run     Runner
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	handle *Handle
+}
+
+func newRunJob(parent context.Context, name string, run Runner) *runJob {
+	ctx, cancel := context.WithCancel(context.WithoutCancel(parent))
+	tr := scontext.TransitFromContext(parent)
+	if tr != nil {
+		ctx = scontext.TransitWithContext(ctx, tr)
+	} else {
+		ctx, tr = scontext.NewTransitWithContext(ctx)
+	}
+	scontext.ShipmentRange(parent, func(k string, v interface{}) bool {
+		ctx = scontext.WithShipment(ctx, k, v)
+		return true
+	})
+
+	return &runJob{
+		name:    name,
+		transit: tr.UUID(),
+		run:     run,
+		ctx:     ctx,
+		cancel:  cancel,
+		handle: &Handle{
+			cancel: cancel,
+			done:   make(chan struct{}),
+		},
+	}
+}
+
+func (j *runJob) Start() {
+	defer j.cancel()
+	defer func() {
+		if r := recover(); r != nil {
+			j.handle.err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+		close(j.handle.done)
+	}()
+
+	j.handle.err = j.run.Run(j.ctx)
+}
+
+// Stop cancels the job context and waits for the job to return
+func (j *runJob) Stop() {
+	j.cancel()
+	<-j.handle.done
+}
+
+// Err returns the job error, unless the job returned because it has been
+// cancelled
+func (j *runJob) Err() error {
+	err := j.handle.Err()
+	if errors.Is(err, context.Canceled) && j.ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,94 @@
+package bg_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/deixis/spine/bg"
+	scontext "github.com/deixis/spine/context"
+)
+
+// TestGo tests whether a runner reports its error through its handle
+func TestGo(t *testing.T) {
+	reg := bg.NewReg("TestGo", context.Background())
+	errFoo := errors.New("foo")
+
+	release := make(chan struct{})
+	h, err := reg.Go(context.Background(), "foo", bg.RunnerFunc(func(ctx context.Context) error {
+		<-release
+		return errFoo
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Err(); err != nil {
+		t.Errorf("expect no error while running, but got %v", err)
+	}
+	close(release)
+	if err := h.Wait(); err != errFoo {
+		t.Errorf("expect %v, but got %v", errFoo, err)
+	}
+	if err := h.Err(); err != errFoo {
+		t.Errorf("expect %v, but got %v", errFoo, err)
+	}
+}
+
+// TestGoCancel tests whether the runner context is cancelled by its handle
+// and when the registry drains
+func TestGoCancel(t *testing.T) {
+	reg := bg.NewReg("TestGoCancel", context.Background())
+	wait := bg.RunnerFunc(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	a, err := reg.Go(context.Background(), "a", wait)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Cancel()
+	if err := a.Wait(); err != context.Canceled {
+		t.Errorf("expect context.Canceled, but got %v", err)
+	}
+
+	b, err := reg.Go(context.Background(), "b", wait)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg.Drain()
+	select {
+	case <-b.Done():
+	default:
+		t.Error("expect drain to cancel runner")
+	}
+	if _, err := reg.Go(context.Background(), "c", wait); err != bg.ErrDrain {
+		t.Errorf("expect ErrDrain, but got %v", err)
+	}
+}
+
+// TestSnapshot tests whether the snapshot lists running jobs
+func TestSnapshot(t *testing.T) {
+	reg := bg.NewReg("TestSnapshot", context.Background())
+	defer reg.Drain()
+
+	ctx, tr := scontext.NewTransitWithContext(context.Background())
+	started := make(chan struct{})
+	_, err := reg.Go(ctx, "consumer", bg.RunnerFunc(func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		return nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-started
+
+	l := reg.Snapshot()
+	if len(l) != 1 {
+		t.Fatalf("expect 1 job, but got %d", len(l))
+	}
+	if l[0].Name != "consumer" || l[0].Transit != tr.UUID() || l[0].Started.IsZero() {
+		t.Errorf("unexpected job info %+v", l[0])
+	}
+}
@@ -0,0 +1,244 @@
+package bg
+
+import (
+	"context"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/deixis/spine/health"
+	"github.com/deixis/spine/log"
+	"github.com/pkg/errors"
+)
+
+// ErrRestartStorm is the error reported to health when a supervised job
+// restarts too often
+var ErrRestartStorm = errors.New("job restarted too often")
+
+// RestartPolicy defines when a supervised job is restarted
+type RestartPolicy int
+
+const (
+	// RestartOnFailure restarts a job which panics or reports an error
+	RestartOnFailure RestartPolicy = iota
+	// RestartAlways restarts a job whenever it returns
+	RestartAlways
+	// RestartNever never restarts a job
+	RestartNever
+)
+
+// SupervisorOption configures a supervised job
+type SupervisorOption func(*SupervisorOptions)
+
+// SupervisorOptions configure a supervised job. SupervisorOptions are set by
+// the SupervisorOption values passed to Reg.Supervise.
+type SupervisorOptions struct {
+	// Restart is the restart policy (RestartOnFailure by default)
+	Restart RestartPolicy
+	// MinBackoff is the delay before the first restart (100ms by default). It
+	// doubles with each restart in the window.
+	MinBackoff time.Duration
+	// MaxBackoff is the maximum delay between restarts (30s by default)
+	MaxBackoff time.Duration
+	// MaxRestarts is the maximum number of restarts in Window (5 by default).
+	// Beyond that, the job is given up and fails the app health.
+	MaxRestarts int
+	// Window is the period over which restarts are counted (1m by default)
+	Window time.Duration
+}
+
+// WithRestart sets the restart policy
+func WithRestart(p RestartPolicy) SupervisorOption {
+	return func(o *SupervisorOptions) {
+		o.Restart = p
+	}
+}
+
+// WithBackoff sets the minimum and maximum delays between restarts
+func WithBackoff(min, max time.Duration) SupervisorOption {
+	return func(o *SupervisorOptions) {
+		o.MinBackoff = min
+		o.MaxBackoff = max
+	}
+}
+
+// WithMaxRestarts sets the maximum number of restarts in a window
+func WithMaxRestarts(n int, window time.Duration) SupervisorOption {
+	return func(o *SupervisorOptions) {
+		o.MaxRestarts = n
+		o.Window = window
+	}
+}
+
+// Supervise calls `Supervise` on the context `Registry`
+func Supervise(ctx context.Context, name string, j Job, o ...SupervisorOption) error {
+	return RegFromContext(ctx).Supervise(name, j, o...)
+}
+
+// Supervise dispatches j and restarts it according to its restart policy.
+// j must support being started again once Start has returned, like Task.
+// Single-use jobs, such as a lock.Lease, must not be supervised: restarting
+// them panics, and they are given up after MaxRestarts.
+//
+// A job which panics, or which implements Failer and reports an error, has
+// failed. When it restarts more than MaxRestarts times in Window, it is given
+// up and the liveness check "bg.<name>" fails.
+func (r *Reg) Supervise(name string, j Job, o ...SupervisorOption) error {
+	opts := SupervisorOptions{
+		Restart:     RestartOnFailure,
+		MinBackoff:  100 * time.Millisecond,
+		MaxBackoff:  30 * time.Second,
+		MaxRestarts: 5,
+		Window:      time.Minute,
+	}
+	for _, o := range o {
+		o(&opts)
+	}
+
+	s := &supervisor{
+		reg:  r,
+		name: name,
+		job:  j,
+		opts: opts,
+		stop: make(chan struct{}),
+	}
+	if err := r.Dispatch(s); err != nil {
+		return err
+	}
+	health.FromContext(r.ctx).Register("bg."+name, s.check, health.Liveness())
+	return nil
+}
+
+// supervisor is a job which runs and restarts a job
+type supervisor struct {
+	mu sync.Mutex
+
+	reg  *Reg
+	name string
+	job  Job
+	opts SupervisorOptions
+
+	running bool
+	stopped bool
+	stop    chan struct{}
+	err     error
+}
+
+func (s *supervisor) Start() {
+	var restarts []time.Time
+	for {
+		s.mu.Lock()
+		if s.stopped {
+			s.mu.Unlock()
+			return
+		}
+		s.running = true
+		s.mu.Unlock()
+
+		err := s.run()
+
+		s.mu.Lock()
+		s.running = false
+		stopped := s.stopped
+		s.mu.Unlock()
+
+		if err != nil {
+			s.reg.logFailure(s.job, err)
+		}
+		if stopped {
+			return
+		}
+		switch {
+		case s.opts.Restart == RestartNever:
+			return
+		case s.opts.Restart == RestartOnFailure && err == nil:
+			return
+		}
+
+		// Count restarts in window
+		now := time.Now()
+		for len(restarts) > 0 && now.Sub(restarts[0]) > s.opts.Window {
+			restarts = restarts[1:]
+		}
+		if len(restarts) >= s.opts.MaxRestarts {
+			s.escalate(len(restarts))
+			return
+		}
+		backoff := s.opts.MinBackoff << uint(len(restarts))
+		if backoff > s.opts.MaxBackoff || backoff <= 0 {
+			backoff = s.opts.MaxBackoff
+		}
+		restarts = append(restarts, now)
+
+		s.reg.log.Warning("bg.job.restart", "Restart job",
+			log.String("name", s.name),
+			log.Type("j", s.job),
+			log.Ptr("addr", s.job),
+			log.Duration("backoff", backoff),
+			log.Int("restarts", len(restarts)),
+		)
+		s.reg.stats.Inc("bg.job.restart", map[string]string{
+			"service": s.reg.service,
+			"name":    s.name,
+		})
+
+		select {
+		case <-time.After(backoff):
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+func (s *supervisor) Stop() {
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		return
+	}
+	s.stopped = true
+	close(s.stop)
+	running := s.running
+	s.mu.Unlock()
+
+	if running {
+		s.job.Stop()
+	}
+}
+
+// run runs the job once and returns why it returned
+func (s *supervisor) run() (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+
+	s.job.Start()
+	if f, ok := s.job.(Failer); ok {
+		return f.Err()
+	}
+	return nil
+}
+
+// escalate gives up the job and fails its health check
+func (s *supervisor) escalate(restarts int) {
+	s.reg.log.Error("bg.job.escalate", "Give up job restarting too often",
+		log.String("name", s.name),
+		log.Type("j", s.job),
+		log.Ptr("addr", s.job),
+		log.Int("restarts", restarts),
+		log.Duration("window", s.opts.Window),
+	)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = errors.Wrapf(ErrRestartStorm, "%d restarts in %s", restarts, s.opts.Window)
+}
+
+// check is the health check of the supervised job
+func (s *supervisor) check(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
@@ -0,0 +1,132 @@
+package bg_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/deixis/spine/bg"
+	"github.com/deixis/spine/health"
+)
+
+// TestSupervisorRestart tests whether a failing job is restarted until it
+// succeeds
+func TestSupervisorRestart(t *testing.T) {
+	reg := bg.NewReg("TestSupervisorRestart", context.Background())
+
+	var runs int32
+	done := make(chan struct{})
+	err := reg.Supervise("flaky", bg.NewTask(func() {
+		if atomic.AddInt32(&runs, 1) < 3 {
+			panic("boom")
+		}
+		close(done)
+	}), bg.WithBackoff(time.Millisecond, time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expect job to be restarted")
+	}
+	reg.Drain()
+	if n := atomic.LoadInt32(&runs); n != 3 {
+		t.Errorf("expect 3 runs, but got %d", n)
+	}
+}
+
+// TestSupervisorEscalate tests whether a restart storm fails the app health
+func TestSupervisorEscalate(t *testing.T) {
+	h := health.NewRegistry()
+	ctx := health.WithContext(context.Background(), h)
+	reg := bg.NewReg("TestSupervisorEscalate", ctx)
+	defer reg.Drain()
+
+	var runs int32
+	err := reg.Supervise("storm", bg.NewTask(func() {
+		atomic.AddInt32(&runs, 1)
+	}),
+		bg.WithRestart(bg.RestartAlways),
+		bg.WithBackoff(time.Millisecond, time.Millisecond),
+		bg.WithMaxRestarts(2, time.Minute),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for h.Liveness(ctx).Healthy() {
+		if time.Now().After(deadline) {
+			t.Fatal("expect restart storm to fail liveness")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if n := atomic.LoadInt32(&runs); n != 3 {
+		t.Errorf("expect 3 runs, but got %d", n)
+	}
+}
+
+// TestSupervisorStop tests whether draining stops a job waiting to restart
+func TestSupervisorStop(t *testing.T) {
+	reg := bg.NewReg("TestSupervisorStop", context.Background())
+
+	err := reg.Supervise("slow", bg.NewTask(func() {
+		panic("boom")
+	}), bg.WithBackoff(time.Hour, time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := reg.DrainContext(ctx); err != nil {
+		t.Error(err)
+	}
+}
+
+// singleUseJob is a job which cannot be started twice
+type singleUseJob struct {
+	runs int32
+	done chan struct{}
+}
+
+func (j *singleUseJob) Start() {
+	atomic.AddInt32(&j.runs, 1)
+	close(j.done)
+}
+
+func (j *singleUseJob) Stop() {}
+
+// TestSupervisorSingleUse tests whether a job which cannot be restarted is
+// given up instead of crashing the app or restarting in a tight loop
+func TestSupervisorSingleUse(t *testing.T) {
+	h := health.NewRegistry()
+	ctx := health.WithContext(context.Background(), h)
+	reg := bg.NewReg("TestSupervisorSingleUse", ctx)
+	defer reg.Drain()
+
+	j := &singleUseJob{done: make(chan struct{})}
+	err := reg.Supervise("once", j,
+		bg.WithRestart(bg.RestartAlways),
+		bg.WithBackoff(time.Millisecond, time.Millisecond),
+		bg.WithMaxRestarts(2, time.Minute),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for h.Liveness(ctx).Healthy() {
+		if time.Now().After(deadline) {
+			t.Fatal("expect single-use job to be given up")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if n := atomic.LoadInt32(&j.runs); n != 3 {
+		t.Errorf("expect 3 runs, but got %d", n)
+	}
+}
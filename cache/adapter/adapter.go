@@ -7,6 +7,7 @@ import (
 	"sync"
 
 	"github.com/deixis/spine/cache"
+	"github.com/deixis/spine/cache/adapter/groupcache"
 	"github.com/deixis/spine/cache/adapter/local"
 	"github.com/deixis/spine/config"
 )
@@ -21,6 +22,7 @@ var (
 
 func init() {
 	// Register default adapters
+	Register(groupcache.Name, groupcache.New)
 	Register(local.Name, local.New)
 }
 
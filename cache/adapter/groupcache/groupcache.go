@@ -0,0 +1,494 @@
+// Package groupcache provides an LRU cache and cache-filling library that
+// shards keys across all peers of a cluster.
+//
+// Peers are discovered with the service discovery agent and each key is owned
+// by exactly one peer, which is picked with a consistent hash. When a key is
+// missing, non-owners fetch it from its owner over HTTP, so the LoadFunc is
+// only called by the owner.
+//
+// Set and Remove are forwarded to the owner of the key, and an invalidation
+// is broadcast on pubsub, so all peers drop their copy of the key.
+//
+// Stale values and load errors are only cached by the owner of a key, which
+// also runs the background refreshes.
+//
+// e.g.
+// [cache.groupcache]
+//
+//	service = "spine.cache"
+//	addr = "127.0.0.1:3001"
+package groupcache
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/deixis/spine/bg"
+	"github.com/deixis/spine/cache"
+	"github.com/deixis/spine/cache/lru"
+	"github.com/deixis/spine/cache/singleflight"
+	"github.com/deixis/spine/config"
+	"github.com/deixis/spine/log"
+	"github.com/deixis/spine/net/http"
+	"github.com/deixis/spine/net/pubsub"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// Name is the groupcache adapter name
+const Name = "groupcache"
+
+const (
+	// hotCacheRatio is the fraction of a group capacity allocated to cache
+	// values owned by other peers
+	hotCacheRatio = 8
+)
+
+// Config is the groupcache configuration
+type Config struct {
+	// Service is the name under which peers register on service discovery
+	Service string `toml:"service" default:"spine.cache"`
+	// Addr is the address on which this peer listens to other peers (host:port)
+	Addr string `toml:"addr" validate:"required"`
+	// Replicas is the number of virtual nodes per peer on the hash ring
+	Replicas int `toml:"replicas" default:"50" validate:"min=1"`
+	// Tags are added to the service discovery registration
+	Tags []string `toml:"tags"`
+}
+
+// Cache is a distributed cache
+type Cache struct {
+	mu sync.Mutex
+
+	// id uniquely identifies this peer on invalidation messages
+	id     string
+	config Config
+	peers  *peers
+	groups map[string]*group
+	pub    pubsub.Pub
+}
+
+// New returns a new distributed cache
+func New(tree config.Tree) (cache.Cache, error) {
+	c := Config{}
+	if err := tree.Unmarshal(&c); err != nil {
+		return nil, errors.Wrap(err, "cannot unmarshal cache.groupcache config")
+	}
+
+	return &Cache{
+		id:     uuid.New().String(),
+		config: c,
+		peers:  newPeers(c.Replicas),
+		groups: make(map[string]*group),
+		pub:    pubsub.NopPubSub(),
+	}, nil
+}
+
+// Start registers the peer server and starts watching service discovery for
+// other peers
+func (c *Cache) Start(ctx context.Context, deps cache.Dependencies) error {
+	host, port, err := splitHostPort(c.config.Addr)
+	if err != nil {
+		return errors.Wrapf(err, "invalid cache.groupcache addr <%s>", c.config.Addr)
+	}
+
+	s := http.NewServer()
+	s.HandleFunc(basePath+"/{group}", http.GET, c.serveGet)
+	s.HandleFunc(basePath+"/{group}", http.PUT, c.servePut)
+	s.HandleFunc(basePath+"/{group}", http.DELETE, c.serveDelete)
+	deps.RegisterServer(c.config.Addr, &server{
+		Server:  s,
+		agent:   deps.Disco(),
+		service: c.config.Service,
+		host:    host,
+		port:    port,
+		tags:    c.config.Tags,
+	})
+
+	ps := pubsub.FromContext(ctx)
+	err = ps.Subscribe("", c.invalidationChannel(), c.handleInvalidation)
+	if err != nil {
+		return errors.Wrap(err, "cannot subscribe to cache invalidations")
+	}
+	c.pub = ps
+
+	w := &watcher{
+		ctx:     ctx,
+		agent:   deps.Disco(),
+		service: c.config.Service,
+		peers:   c.peers,
+		stop:    make(chan struct{}),
+	}
+	return bg.Dispatch(ctx, w)
+}
+
+// NewGroup creates a LRU caching namespace
+func (c *Cache) NewGroup(
+	name string, cacheBytes int64, loader cache.LoadFunc, o ...cache.GroupOption,
+) cache.Group {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	g, ok := c.groups[name]
+	if !ok {
+		g = &group{
+			name:  name,
+			opts:  cache.BuildGroupOptions(o...),
+			c:     c,
+			peers: c.peers,
+			main:  lru.New(cacheBytes),
+			hot:   lru.New(cacheBytes / hotCacheRatio),
+			load:  loader,
+
+			metrics:    cache.NewMetrics(name),
+			refreshing: map[string]bool{},
+		}
+		c.groups[name] = g
+	}
+	return g
+}
+
+// Groups returns the statistics of all groups sorted by name. The
+// statistics of a group include both the keys owned by this node and the
+// keys fetched from other peers.
+func (c *Cache) Groups() []cache.GroupStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	l := make([]cache.GroupStats, 0, len(c.groups))
+	for _, g := range c.groups {
+		l = append(l, g.metrics.Stats(g.main, g.hot))
+	}
+	sort.Slice(l, func(i, j int) bool { return l[i].Name < l[j].Name })
+	return l
+}
+
+func (c *Cache) group(name string) (*group, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	g, ok := c.groups[name]
+	return g, ok
+}
+
+// serveGet answers requests from peers for the keys owned by this node
+func (c *Cache) serveGet(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	g, ok := c.group(r.Params["group"])
+	if !ok {
+		log.Warn(ctx, "cache.groupcache.group_not_found", "Group not found",
+			log.String("group", r.Params["group"]),
+		)
+		w.Head(http.StatusNotFound)
+		return
+	}
+
+	data, err := g.getForPeer(ctx, r.HTTP.URL.Query().Get("key"))
+	if err != nil {
+		log.Warn(ctx, "cache.groupcache.load_err", "Error loading key for peer",
+			log.String("group", g.name),
+			log.Error(err),
+		)
+		w.Head(http.StatusBadGateway)
+		return
+	}
+	w.Data(http.StatusOK, contentType, ioutil.NopCloser(bytes.NewReader(data)))
+}
+
+// servePut stores a value sent by a peer for a key owned by this node
+func (c *Cache) servePut(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	g, ok := c.group(r.Params["group"])
+	if !ok {
+		w.Head(http.StatusNotFound)
+		return
+	}
+
+	q := r.HTTP.URL.Query()
+	ms, err := strconv.ParseInt(q.Get("ttl_ms"), 10, 64)
+	if err != nil {
+		w.Head(http.StatusBadRequest)
+		return
+	}
+	data, err := ioutil.ReadAll(r.HTTP.Body)
+	if err != nil {
+		w.Head(http.StatusBadRequest)
+		return
+	}
+	e, ttl := cache.NewEntry(data, time.Duration(ms)*time.Millisecond, g.opts)
+	key := q.Get("key")
+	g.fills.Write(key, func() {
+		g.main.SetWithTTL(key, e, ttl)
+	})
+	g.metrics.Store(ctx, g.main, g.hot)
+	w.Head(http.StatusNoContent)
+}
+
+// serveDelete removes a key owned by this node on behalf of a peer
+func (c *Cache) serveDelete(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	g, ok := c.group(r.Params["group"])
+	if !ok {
+		w.Head(http.StatusNotFound)
+		return
+	}
+
+	key := r.HTTP.URL.Query().Get("key")
+	g.fills.Write(key, func() {
+		g.main.Delete(key)
+	})
+	w.Head(http.StatusNoContent)
+}
+
+func (c *Cache) invalidationChannel() string {
+	return c.config.Service + ".invalidate"
+}
+
+// invalidate notifies all peers that key has changed
+func (c *Cache) invalidate(ctx context.Context, group, key string) error {
+	data, err := json.Marshal(&invalidation{Node: c.id, Group: group, Key: key})
+	if err != nil {
+		return err
+	}
+	return c.pub.Publish(ctx, c.invalidationChannel(), data)
+}
+
+// handleInvalidation drops the copy of a key owned by another peer
+func (c *Cache) handleInvalidation(ctx context.Context, data []byte) {
+	var msg invalidation
+	if err := json.Unmarshal(data, &msg); err != nil {
+		log.Warn(ctx, "cache.groupcache.invalidation_err", "Invalid message",
+			log.Error(err),
+		)
+		return
+	}
+	if msg.Node == c.id {
+		return
+	}
+	if g, ok := c.group(msg.Group); ok {
+		g.hotFills.Write(msg.Key, func() {
+			g.hot.Delete(msg.Key)
+		})
+	}
+}
+
+// invalidation is the message broadcast to all peers when a key changes
+type invalidation struct {
+	Node  string `json:"node"`
+	Group string `json:"group"`
+	Key   string `json:"key"`
+}
+
+type group struct {
+	name  string
+	opts  cache.GroupOptions
+	c     *Cache
+	peers *peers
+	// main contains the keys owned by this node
+	main *lru.Cache
+	// hot contains the keys owned by other peers that have been fetched
+	hot  *lru.Cache
+	load cache.LoadFunc
+	// loads ensures that each key is only loaded once at a time
+	loads singleflight.Group
+	// fetches ensures that each key is only fetched once at a time from peers.
+	// It is distinct from loads to avoid waiting on each other when peers
+	// disagree on the owner of a key.
+	fetches singleflight.Group
+	// fills and hotFills prevent loads and fetches from overwriting
+	// concurrent writes
+	fills    cache.Fills
+	hotFills cache.Fills
+	metrics  *cache.Metrics
+
+	mu sync.Mutex
+	// refreshing contains the stale keys being refreshed in background
+	refreshing map[string]bool
+}
+
+func (g *group) Get(ctx context.Context, key string) ([]byte, error) {
+	if e, ok := g.lookup(ctx, key); ok {
+		g.metrics.Hit(ctx)
+		return e.Data, e.Err
+	}
+	g.metrics.Miss(ctx)
+
+	if addr, ok := g.peers.pick(key); ok {
+		data, err := g.fetches.Do(ctx, key, func(ctx context.Context) (interface{}, error) {
+			if e, ok := g.lookup(ctx, key); ok {
+				return e.Data, e.Err
+			}
+			gen := g.hotFills.Begin(key)
+			data, err := fetch(ctx, addr, g.name, key)
+			g.hotFills.Commit(key, gen, func() {
+				if err == nil {
+					g.hot.SetWithTTL(key, &cache.Entry{Data: data}, g.opts.TTL)
+				}
+			})
+			if err != nil {
+				return nil, err
+			}
+			g.metrics.Store(ctx, g.main, g.hot)
+			return data, nil
+		})
+		if err == nil {
+			return data.([]byte), nil
+		}
+		if err == errPeerLoad || ctx.Err() != nil {
+			return nil, err
+		}
+		// Fallback to a local load when the owner is unreachable
+		log.Warn(ctx, "cache.groupcache.peer_err", "Error fetching key from peer",
+			log.String("group", g.name),
+			log.String("peer", addr),
+			log.Error(err),
+		)
+	}
+	return g.getLocally(ctx, key)
+}
+
+// getForPeer returns the value for key requested by another peer
+func (g *group) getForPeer(ctx context.Context, key string) ([]byte, error) {
+	if e, ok := g.lookup(ctx, key); ok {
+		g.metrics.Hit(ctx)
+		return e.Data, e.Err
+	}
+	g.metrics.Miss(ctx)
+	return g.getLocally(ctx, key)
+}
+
+// getLocally returns the value for key without ever forwarding the request
+// to another peer
+func (g *group) getLocally(ctx context.Context, key string) ([]byte, error) {
+	if e, ok := g.lookup(ctx, key); ok {
+		return e.Data, e.Err
+	}
+
+	data, err := g.loads.Do(ctx, key, func(ctx context.Context) (interface{}, error) {
+		return g.fill(ctx, key, false)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return data.([]byte), nil
+}
+
+// refresh reloads a stale key in background, while its stale value is served
+func (g *group) refresh(ctx context.Context, key string) {
+	g.mu.Lock()
+	if g.refreshing[key] {
+		g.mu.Unlock()
+		return
+	}
+	g.refreshing[key] = true
+	g.mu.Unlock()
+
+	done := func() {
+		g.mu.Lock()
+		delete(g.refreshing, key)
+		g.mu.Unlock()
+	}
+	err := bg.BG(ctx, func(ctx context.Context) {
+		defer done()
+
+		_, err := g.loads.Do(ctx, key, func(ctx context.Context) (interface{}, error) {
+			return g.fill(ctx, key, true)
+		})
+		if err != nil {
+			log.Warn(ctx, "cache.groupcache.refresh_err", "Error refreshing stale key",
+				log.String("group", g.name),
+				log.Error(err),
+			)
+		}
+	})
+	if err != nil {
+		done()
+	}
+}
+
+// fill loads key and stores it in the main cache. Errors are cached when
+// negative caching is enabled, unless a stale value is being refreshed.
+func (g *group) fill(ctx context.Context, key string, refresh bool) ([]byte, error) {
+	// The key may have been loaded while waiting for the previous load
+	if v, ok := g.main.Get(key); ok {
+		if e := v.(*cache.Entry); !e.Stale(time.Now()) {
+			return e.Data, e.Err
+		}
+	}
+
+	gen := g.fills.Begin(key)
+	start := time.Now()
+	data, err := g.load(ctx, key)
+	g.metrics.Load(ctx, time.Since(start), err)
+	if err != nil {
+		e, ttl, ok := cache.NewErrorEntry(err, g.opts)
+		g.fills.Commit(key, gen, func() {
+			if ok && !refresh {
+				g.main.SetWithTTL(key, e, ttl)
+			}
+		})
+		g.metrics.Store(ctx, g.main, g.hot)
+		return nil, err
+	}
+	e, ttl := cache.NewEntry(data, g.opts.TTL, g.opts)
+	g.fills.Commit(key, gen, func() {
+		g.main.SetWithTTL(key, e, ttl)
+	})
+	g.metrics.Store(ctx, g.main, g.hot)
+	return data, nil
+}
+
+func (g *group) Set(
+	ctx context.Context, key string, value []byte, o ...cache.EntryOption,
+) error {
+	opts := cache.BuildEntryOptions(g.opts, o...)
+	if addr, ok := g.peers.pick(key); ok {
+		if err := store(ctx, addr, g.name, key, value, opts.TTL); err != nil {
+			return errors.Wrapf(err, "cannot store key on peer <%s>", addr)
+		}
+		g.hotFills.Write(key, func() {
+			g.hot.SetWithTTL(key, &cache.Entry{Data: value}, opts.TTL)
+		})
+	} else {
+		e, ttl := cache.NewEntry(value, opts.TTL, g.opts)
+		g.fills.Write(key, func() {
+			g.main.SetWithTTL(key, e, ttl)
+		})
+	}
+	g.metrics.Store(ctx, g.main, g.hot)
+	return g.c.invalidate(ctx, g.name, key)
+}
+
+func (g *group) Remove(ctx context.Context, key string) error {
+	g.fills.Write(key, func() {
+		g.main.Delete(key)
+	})
+	g.hotFills.Write(key, func() {
+		g.hot.Delete(key)
+	})
+	if addr, ok := g.peers.pick(key); ok {
+		if err := remove(ctx, addr, g.name, key); err != nil {
+			return errors.Wrapf(err, "cannot remove key from peer <%s>", addr)
+		}
+	}
+	return g.c.invalidate(ctx, g.name, key)
+}
+
+// lookup returns the entry for key from the main or the hot cache. A stale
+// entry owned by this node is refreshed in background.
+func (g *group) lookup(ctx context.Context, key string) (*cache.Entry, bool) {
+	if v, ok := g.main.Get(key); ok {
+		e := v.(*cache.Entry)
+		if e.Stale(time.Now()) {
+			g.refresh(ctx, key)
+		}
+		return e, true
+	}
+	if v, ok := g.hot.Get(key); ok {
+		return v.(*cache.Entry), true
+	}
+	return nil, false
+}
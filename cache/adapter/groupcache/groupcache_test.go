@@ -0,0 +1,385 @@
+package groupcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	stdnet "net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/deixis/spine/cache"
+	"github.com/deixis/spine/config"
+	"github.com/deixis/spine/disco"
+	"github.com/deixis/spine/net"
+	"github.com/deixis/spine/net/pubsub"
+	"github.com/deixis/spine/net/pubsub/adapter/inmem"
+)
+
+// TestOwnership ensures that each key is loaded by exactly one peer, and
+// that all peers return the value loaded by the owner
+func TestOwnership(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	nodes := []string{"alpha", "beta"}
+	groups, loads := startPeers(ctx, t, nodes)
+
+	const keys = 64
+	for i := 0; i < keys; i++ {
+		key := strconv.Itoa(i)
+
+		var expect string
+		for _, node := range nodes {
+			v, err := groups[node].Get(ctx, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if expect == "" {
+				expect = string(v)
+			}
+			if expect != string(v) {
+				t.Errorf("expect to get %s for key %s, but got %s", expect, key, v)
+			}
+		}
+	}
+
+	var total int32
+	for _, node := range nodes {
+		n := atomic.LoadInt32(loads[node])
+		if n == 0 {
+			t.Errorf("expect node %s to own some keys", node)
+		}
+		total += n
+	}
+	if total != keys {
+		t.Errorf("expect to load %d keys, but got %d", keys, total)
+	}
+}
+
+// TestSetRemove ensures that Set and Remove are visible from all peers
+func TestSetRemove(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ps, err := inmem.New(config.NopTree())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ps.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	ctx = pubsub.WithContext(ctx, ps)
+
+	nodes := []string{"alpha", "beta"}
+	groups, _ := startPeers(ctx, t, nodes)
+
+	// Fill all peers
+	const keys = 16
+	for i := 0; i < keys; i++ {
+		for _, node := range nodes {
+			if _, err := groups[node].Get(ctx, strconv.Itoa(i)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	for i := 0; i < keys; i++ {
+		key := strconv.Itoa(i)
+		if err := groups["alpha"].Set(ctx, key, []byte("new")); err != nil {
+			t.Fatal(err)
+		}
+		for _, node := range nodes {
+			waitValue(ctx, t, groups[node], key, "new")
+		}
+
+		if err := groups["beta"].Remove(ctx, key); err != nil {
+			t.Fatal(err)
+		}
+		for _, node := range nodes {
+			waitValue(ctx, t, groups[node], key, "alpha", "beta")
+		}
+	}
+}
+
+// TestLoadRace ensures that a load in flight does not overwrite a concurrent
+// Set or Remove
+func TestLoadRace(t *testing.T) {
+	ctx := context.Background()
+
+	// The cache is not started, so this node owns all keys
+	tree, err := config.TreeFromMap(map[string]interface{}{
+		"addr": freeAddr(t),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := New(tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var loads int32
+	loading := make(chan struct{})
+	release := make(chan struct{})
+	group := c.NewGroup("foo", 1024, func(ctx context.Context, key string) ([]byte, error) {
+		if atomic.AddInt32(&loads, 1) == 1 {
+			loading <- struct{}{}
+			<-release
+		}
+		return []byte("loaded"), nil
+	})
+
+	// Remove while loading
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		group.Get(ctx, "alpha")
+	}()
+	<-loading
+	if err := group.Remove(ctx, "alpha"); err != nil {
+		t.Fatal(err)
+	}
+	release <- struct{}{}
+	<-done
+	if _, err := group.Get(ctx, "alpha"); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&loads); n != 2 {
+		t.Errorf("expect removed key to be loaded again, but got %d loads", n)
+	}
+
+	// Set while loading
+	atomic.StoreInt32(&loads, 0)
+	done = make(chan struct{})
+	go func() {
+		defer close(done)
+		group.Get(ctx, "beta")
+	}()
+	<-loading
+	if err := group.Set(ctx, "beta", []byte("set")); err != nil {
+		t.Fatal(err)
+	}
+	release <- struct{}{}
+	<-done
+	got, err := group.Get(ctx, "beta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "set" {
+		t.Errorf("expect to get set, but got %s", got)
+	}
+}
+
+// startPeers starts a cache peer for each node and waits until they all know
+// each other
+func startPeers(
+	ctx context.Context, t *testing.T, nodes []string,
+) (map[string]cache.Group, map[string]*int32) {
+	reg := &registry{instances: map[string]*disco.Instance{}}
+	groups := map[string]cache.Group{}
+	loads := map[string]*int32{}
+	for _, node := range nodes {
+		addr := freeAddr(t)
+		tree, err := config.TreeFromMap(map[string]interface{}{
+			"addr": addr,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, err := New(tree)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		d := &deps{agent: &agent{reg: reg, local: map[string]bool{}}}
+		if err := c.Start(ctx, d); err != nil {
+			t.Fatal(err)
+		}
+		go d.s.Serve(ctx, d.addr)
+		waitListening(t, addr)
+		t.Cleanup(d.s.Drain)
+
+		node := node
+		n := new(int32)
+		loads[node] = n
+		groups[node] = c.NewGroup("foo", 1<<20, func(ctx context.Context, key string) ([]byte, error) {
+			atomic.AddInt32(n, 1)
+			return []byte(node), nil
+		})
+	}
+
+	// Wait for all peers to know each other
+	for _, g := range groups {
+		waitPeers(t, g.(*group).peers, len(nodes))
+	}
+	return groups, loads
+}
+
+// waitValue waits until g returns one of the expected values for key
+func waitValue(
+	ctx context.Context, t *testing.T, g cache.Group, key string, expect ...string,
+) {
+	var got []byte
+	for i := 0; i < 100; i++ {
+		var err error
+		got, err = g.Get(ctx, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range expect {
+			if e == string(got) {
+				return
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("expect to get %v for key %s, but got %s", expect, key, got)
+}
+
+func freeAddr(t *testing.T) string {
+	l, err := stdnet.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+func waitListening(t *testing.T, addr string) {
+	for i := 0; i < 100; i++ {
+		conn, err := stdnet.Dial("tcp", addr)
+		if err == nil {
+			conn.Close()
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("server not listening on %s", addr)
+}
+
+func waitPeers(t *testing.T, p *peers, n int) {
+	for i := 0; i < 100; i++ {
+		p.mu.RLock()
+		l := len(p.instances)
+		p.mu.RUnlock()
+		if l == n {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("expect to have %d peers", n)
+}
+
+// deps implements cache.Dependencies
+type deps struct {
+	agent *agent
+	addr  string
+	s     net.Server
+}
+
+func (d *deps) Disco() disco.Agent {
+	return d.agent
+}
+
+func (d *deps) RegisterServer(addr string, s net.Server) {
+	d.addr = addr
+	d.s = s
+}
+
+// registry is a service discovery catalogue shared by multiple agents
+type registry struct {
+	mu        sync.Mutex
+	n         int
+	instances map[string]*disco.Instance
+	subs      []chan *disco.Instance
+}
+
+// agent is a minimal disco.Agent that flags the instances it has registered
+// as local
+type agent struct {
+	reg   *registry
+	local map[string]bool
+}
+
+func (a *agent) Register(ctx context.Context, r *disco.Registration) (string, error) {
+	a.reg.mu.Lock()
+	defer a.reg.mu.Unlock()
+
+	a.reg.n++
+	id := fmt.Sprintf("%s-%d", r.Name, a.reg.n)
+	inst := &disco.Instance{ID: id, Name: r.Name, Host: r.Addr, Port: r.Port}
+	a.reg.instances[id] = inst
+	a.local[id] = true
+	for _, sub := range a.reg.subs {
+		sub <- inst
+	}
+	return id, nil
+}
+
+func (a *agent) Deregister(ctx context.Context, id string) error {
+	return errors.New("not implemented")
+}
+
+func (a *agent) Services(ctx context.Context, tags ...string) (map[string]disco.Service, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (a *agent) Service(ctx context.Context, name string, tags ...string) (disco.Service, error) {
+	a.reg.mu.Lock()
+	defer a.reg.mu.Unlock()
+
+	sub := make(chan *disco.Instance, 16)
+	a.reg.subs = append(a.reg.subs, sub)
+
+	s := &service{agent: a, sub: sub}
+	for _, inst := range a.reg.instances {
+		s.instances = append(s.instances, a.instance(inst))
+	}
+	return s, nil
+}
+
+func (a *agent) Leave(ctx context.Context) {}
+
+func (a *agent) instance(inst *disco.Instance) *disco.Instance {
+	i := *inst
+	i.Local = a.local[inst.ID]
+	return &i
+}
+
+type service struct {
+	agent     *agent
+	instances []*disco.Instance
+	sub       chan *disco.Instance
+}
+
+func (s *service) Name() string                 { return "" }
+func (s *service) Instances() []*disco.Instance { return s.instances }
+func (s *service) Watch() disco.Watcher {
+	return &watcherStub{agent: s.agent, sub: s.sub, done: make(chan struct{})}
+}
+
+type watcherStub struct {
+	agent *agent
+	sub   chan *disco.Instance
+	done  chan struct{}
+}
+
+func (w *watcherStub) Next() ([]*disco.Event, error) {
+	select {
+	case inst := <-w.sub:
+		w.agent.reg.mu.Lock()
+		defer w.agent.reg.mu.Unlock()
+		return []*disco.Event{{Op: disco.Add, Instance: w.agent.instance(inst)}}, nil
+	case <-w.done:
+		return nil, disco.ErrWatcherClosed
+	}
+}
+
+func (w *watcherStub) Close() error {
+	close(w.done)
+	return nil
+}
@@ -0,0 +1,139 @@
+package groupcache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	stdhttp "net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/deixis/spine/disco"
+	"github.com/deixis/spine/log"
+	"github.com/deixis/spine/net/http"
+)
+
+const (
+	// basePath is the HTTP path prefix on which peers answer requests
+	basePath    = "/_spine/cache"
+	contentType = "application/octet-stream"
+)
+
+// errPeerLoad is returned when the owner of a key failed to load it
+var errPeerLoad = errors.New("peer failed to load key")
+
+// client is the HTTP client used to fetch keys from peers
+var client = &http.Client{PropagateContext: true}
+
+// server wraps the peer HTTP server to register it on service discovery
+// once it starts serving requests
+type server struct {
+	*http.Server
+
+	agent   disco.Agent
+	service string
+	host    string
+	port    uint16
+	tags    []string
+}
+
+func (s *server) Serve(ctx context.Context, addr string) error {
+	id, err := s.agent.Register(ctx, &disco.Registration{
+		Name: s.service,
+		Addr: s.host,
+		Port: s.port,
+		Tags: s.tags,
+	})
+	if err != nil {
+		return err
+	}
+	log.FromContext(ctx).Trace("cache.groupcache.register", "Peer registered",
+		log.String("service", s.service),
+		log.String("id", id),
+		log.String("addr", addr),
+	)
+	return s.Server.Serve(ctx, addr)
+}
+
+// fetch gets the value of key from the peer listening on addr
+func fetch(ctx context.Context, addr, group, key string) ([]byte, error) {
+	u := peerURL(addr, group, url.Values{"key": []string{key}})
+	res, err := client.Get(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusBadGateway {
+		return nil, errPeerLoad
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("peer returned status code %d", res.StatusCode)
+	}
+	return ioutil.ReadAll(res.Body)
+}
+
+// store sends the value of key to the peer listening on addr
+func store(
+	ctx context.Context, addr, group, key string, value []byte, ttl time.Duration,
+) error {
+	u := peerURL(addr, group, url.Values{
+		"key":    []string{key},
+		"ttl_ms": []string{strconv.FormatInt(int64(ttl/time.Millisecond), 10)},
+	})
+	req, err := stdhttp.NewRequest(http.PUT, u, bytes.NewReader(value))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	return do(ctx, req)
+}
+
+// remove removes key from the peer listening on addr
+func remove(ctx context.Context, addr, group, key string) error {
+	u := peerURL(addr, group, url.Values{"key": []string{key}})
+	req, err := stdhttp.NewRequest(http.DELETE, u, nil)
+	if err != nil {
+		return err
+	}
+	return do(ctx, req)
+}
+
+func do(ctx context.Context, req *stdhttp.Request) error {
+	res, err := client.Do(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("peer returned status code %d", res.StatusCode)
+	}
+	return nil
+}
+
+func peerURL(addr, group string, q url.Values) string {
+	u := url.URL{
+		Scheme:   "http",
+		Host:     addr,
+		Path:     basePath + "/" + url.PathEscape(group),
+		RawQuery: q.Encode(),
+	}
+	return u.String()
+}
+
+func splitHostPort(addr string) (string, uint16, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", 0, err
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return "", 0, err
+	}
+	return host, uint16(p), nil
+}
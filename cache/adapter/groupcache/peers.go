@@ -0,0 +1,171 @@
+package groupcache
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/deixis/spine/cache/consistenthash"
+	"github.com/deixis/spine/disco"
+	"github.com/deixis/spine/log"
+)
+
+// watchRetry is the time to wait before watching the service again after a
+// failure (e.g. the service has not been registered yet)
+const watchRetry = 5 * time.Second
+
+// peers keeps track of all cache peers and picks the owner of a key
+type peers struct {
+	mu sync.RWMutex
+
+	replicas  int
+	ring      *consistenthash.Map
+	instances map[string]*disco.Instance
+}
+
+func newPeers(replicas int) *peers {
+	return &peers{
+		replicas:  replicas,
+		ring:      consistenthash.New(replicas, nil),
+		instances: map[string]*disco.Instance{},
+	}
+}
+
+// pick returns the address of the peer which owns key. It returns false when
+// the key is owned by the local node, or when there are no peers.
+func (p *peers) pick(key string) (string, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.ring.IsEmpty() {
+		return "", false
+	}
+	addr := p.ring.Get(key)
+	for _, inst := range p.instances {
+		if inst.Local && inst.Addr() == addr {
+			return "", false
+		}
+	}
+	return addr, true
+}
+
+// set replaces all peers with the given instances
+func (p *peers) set(instances []*disco.Instance) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.instances = map[string]*disco.Instance{}
+	for _, inst := range instances {
+		p.instances[inst.ID] = inst
+	}
+	p.rebuild()
+}
+
+// apply updates peers with the given service discovery events
+func (p *peers) apply(events []*disco.Event) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, e := range events {
+		switch e.Op {
+		case disco.Add, disco.Update:
+			p.instances[e.Instance.ID] = e.Instance
+		case disco.Delete:
+			delete(p.instances, e.Instance.ID)
+		}
+	}
+	p.rebuild()
+}
+
+// rebuild builds a new hash ring from the current instances
+func (p *peers) rebuild() {
+	var addrs []string
+	for _, inst := range p.instances {
+		addrs = append(addrs, inst.Addr())
+	}
+	sort.Strings(addrs)
+
+	p.ring = consistenthash.New(p.replicas, nil)
+	p.ring.Add(addrs...)
+}
+
+// watcher is a background job that keeps peers up to date with service
+// discovery
+type watcher struct {
+	mu sync.Mutex
+
+	ctx     context.Context
+	agent   disco.Agent
+	service string
+	peers   *peers
+	stop    chan struct{}
+	w       disco.Watcher
+}
+
+func (w *watcher) Start() {
+	logger := log.FromContext(w.ctx)
+
+	for {
+		svc, err := w.agent.Service(w.ctx, w.service)
+		if err == nil {
+			w.peers.set(svc.Instances())
+			w.watch(svc)
+		} else {
+			logger.Trace("cache.groupcache.watch.retry", "Cannot fetch peers",
+				log.String("service", w.service),
+				log.Error(err),
+			)
+		}
+
+		select {
+		case <-w.stop:
+			return
+		case <-time.After(watchRetry):
+		}
+	}
+}
+
+func (w *watcher) Stop() {
+	close(w.stop)
+
+	w.mu.Lock()
+	if w.w != nil {
+		w.w.Close()
+		w.w = nil
+	}
+	w.mu.Unlock()
+}
+
+// watch blocks until the watcher fails or is closed
+func (w *watcher) watch(svc disco.Service) {
+	w.mu.Lock()
+	select {
+	case <-w.stop:
+		w.mu.Unlock()
+		return
+	default:
+	}
+	dw := svc.Watch()
+	w.w = dw
+	w.mu.Unlock()
+
+	for {
+		events, err := dw.Next()
+		if err != nil {
+			log.FromContext(w.ctx).Trace("cache.groupcache.watch.end", "Stop watching peers",
+				log.String("service", w.service),
+				log.Error(err),
+			)
+			break
+		}
+		w.peers.apply(events)
+	}
+
+	w.mu.Lock()
+	if w.w != nil {
+		w.w.Close()
+		w.w = nil
+	}
+	w.mu.Unlock()
+}
@@ -4,11 +4,16 @@ package local
 
 import (
 	"context"
+	"sort"
 	"sync"
+	"time"
 
+	"github.com/deixis/spine/bg"
 	"github.com/deixis/spine/cache"
 	"github.com/deixis/spine/cache/lru"
+	"github.com/deixis/spine/cache/singleflight"
 	"github.com/deixis/spine/config"
+	"github.com/deixis/spine/log"
 )
 
 // Name is the local cache adapter name
@@ -27,8 +32,12 @@ func New(_ config.Tree) (cache.Cache, error) {
 	}, nil
 }
 
+func (c *localCache) Start(ctx context.Context, deps cache.Dependencies) error {
+	return nil
+}
+
 func (c *localCache) NewGroup(
-	name string, cacheBytes int64, loader cache.LoadFunc,
+	name string, cacheBytes int64, loader cache.LoadFunc, o ...cache.GroupOption,
 ) cache.Group {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -36,42 +45,152 @@ func (c *localCache) NewGroup(
 	g, ok := c.groups[name]
 	if !ok {
 		g = &group{
-			lru:  lru.New(cacheBytes),
-			load: loader,
+			name:    name,
+			opts:    cache.BuildGroupOptions(o...),
+			lru:     lru.New(cacheBytes),
+			load:    loader,
+			metrics: cache.NewMetrics(name),
+
+			refreshing: map[string]bool{},
 		}
 		c.groups[name] = g
 	}
 	return g
 }
 
-type group struct {
-	mu sync.Mutex
+func (c *localCache) Groups() []cache.GroupStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	l := make([]cache.GroupStats, 0, len(c.groups))
+	for _, g := range c.groups {
+		l = append(l, g.metrics.Stats(g.lru))
+	}
+	sort.Slice(l, func(i, j int) bool { return l[i].Name < l[j].Name })
+	return l
+}
 
+type group struct {
+	name string
+	opts cache.GroupOptions
 	lru  *lru.Cache
 	load cache.LoadFunc
+	// loads ensures that each key is only loaded once at a time
+	loads singleflight.Group
+	// fills prevents loads from overwriting concurrent writes
+	fills   cache.Fills
+	metrics *cache.Metrics
+
+	mu sync.Mutex
+	// refreshing contains the stale keys being refreshed in background
+	refreshing map[string]bool
 }
 
 func (g *group) Get(ctx context.Context, key string) ([]byte, error) {
+	if e, ok := g.lookup(key); ok {
+		g.metrics.Hit(ctx)
+		if e.Stale(time.Now()) {
+			g.refresh(ctx, key)
+		}
+		return e.Data, e.Err
+	}
+	g.metrics.Miss(ctx)
+
+	data, err := g.loads.Do(ctx, key, func(ctx context.Context) (interface{}, error) {
+		return g.fill(ctx, key, false)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return data.([]byte), nil
+}
+
+// refresh reloads a stale key in background, while its stale value is served
+func (g *group) refresh(ctx context.Context, key string) {
 	g.mu.Lock()
-	defer g.mu.Unlock()
+	if g.refreshing[key] {
+		g.mu.Unlock()
+		return
+	}
+	g.refreshing[key] = true
+	g.mu.Unlock()
 
-	v, ok := g.lru.Get(key)
-	if ok {
-		return v.(*vBytes).data, nil
+	done := func() {
+		g.mu.Lock()
+		delete(g.refreshing, key)
+		g.mu.Unlock()
 	}
+	err := bg.BG(ctx, func(ctx context.Context) {
+		defer done()
 
+		_, err := g.loads.Do(ctx, key, func(ctx context.Context) (interface{}, error) {
+			return g.fill(ctx, key, true)
+		})
+		if err != nil {
+			log.Warn(ctx, "cache.local.refresh_err", "Error refreshing stale key",
+				log.String("group", g.name),
+				log.Error(err),
+			)
+		}
+	})
+	if err != nil {
+		done()
+	}
+}
+
+// fill loads key and stores it in the LRU cache. Errors are cached when
+// negative caching is enabled, unless a stale value is being refreshed.
+func (g *group) fill(ctx context.Context, key string, refresh bool) ([]byte, error) {
+	// The key may have been loaded while waiting for the previous load
+	if e, ok := g.lookup(key); ok && !e.Stale(time.Now()) {
+		return e.Data, e.Err
+	}
+
+	gen := g.fills.Begin(key)
+	start := time.Now()
 	data, err := g.load(ctx, key)
+	g.metrics.Load(ctx, time.Since(start), err)
 	if err != nil {
+		e, ttl, ok := cache.NewErrorEntry(err, g.opts)
+		g.fills.Commit(key, gen, func() {
+			if ok && !refresh {
+				g.lru.SetWithTTL(key, e, ttl)
+			}
+		})
+		g.metrics.Store(ctx, g.lru)
 		return nil, err
 	}
-	g.lru.Set(key, &vBytes{data})
+	e, ttl := cache.NewEntry(data, g.opts.TTL, g.opts)
+	g.fills.Commit(key, gen, func() {
+		g.lru.SetWithTTL(key, e, ttl)
+	})
+	g.metrics.Store(ctx, g.lru)
 	return data, nil
 }
 
-type vBytes struct {
-	data []byte
+func (g *group) lookup(key string) (*cache.Entry, bool) {
+	v, ok := g.lru.Get(key)
+	if !ok {
+		return nil, false
+	}
+	return v.(*cache.Entry), true
+}
+
+func (g *group) Set(
+	ctx context.Context, key string, value []byte, o ...cache.EntryOption,
+) error {
+	opts := cache.BuildEntryOptions(g.opts, o...)
+	e, ttl := cache.NewEntry(value, opts.TTL, g.opts)
+	g.fills.Write(key, func() {
+		g.lru.SetWithTTL(key, e, ttl)
+	})
+	g.metrics.Store(ctx, g.lru)
+	return nil
 }
 
-func (w *vBytes) Size() int {
-	return len(w.data)
+func (g *group) Remove(ctx context.Context, key string) error {
+	g.fills.Write(key, func() {
+		g.lru.Delete(key)
+	})
+	return nil
 }
@@ -2,8 +2,14 @@ package local_test
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/deixis/spine/cache"
 	"github.com/deixis/spine/cache/adapter/local"
 	"github.com/deixis/spine/config"
 )
@@ -105,3 +111,398 @@ func TestCache(t *testing.T) {
 		t.Errorf("Expect to load data once, but got %d", load)
 	}
 }
+
+// TestConcurrentLoads ensures that concurrent callers for the same key share a
+// single load, without blocking callers for other keys
+func TestConcurrentLoads(t *testing.T) {
+	ctx := context.Background()
+
+	cache, err := local.New(config.NopTree())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var loads int32
+	release := make(chan struct{})
+	group := cache.NewGroup("foo", 1024, func(ctx context.Context, key string) ([]byte, error) {
+		atomic.AddInt32(&loads, 1)
+		if key == "slow" {
+			<-release
+		}
+		return []byte(key), nil
+	})
+
+	// Start concurrent loads for a slow key
+	const callers = 8
+	var wg sync.WaitGroup
+	wg.Add(callers)
+	for i := 0; i < callers; i++ {
+		go func() {
+			defer wg.Done()
+			got, err := group.Get(ctx, "slow")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if string(got) != "slow" {
+				t.Errorf("expect to get slow, but got %s", got)
+			}
+		}()
+	}
+
+	// Other keys must not be blocked by the slow key
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if _, err := group.Get(ctx, "fast"); err != nil {
+			t.Error(err)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expect fast key to be loaded while slow key is loading")
+	}
+
+	close(release)
+	wg.Wait()
+	if n := atomic.LoadInt32(&loads); n != 2 {
+		t.Errorf("expect to load data twice, but got %d", n)
+	}
+}
+
+// TestConcurrentLoadErrors ensures that a loader error reaches every waiter
+// and that a cancelled caller does not cancel the shared load
+func TestConcurrentLoadErrors(t *testing.T) {
+	cache, err := local.New(config.NopTree())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := errors.New("load failed")
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var cancelled int32
+	var once sync.Once
+	group := cache.NewGroup("foo", 1024, func(ctx context.Context, key string) ([]byte, error) {
+		once.Do(func() { close(started) })
+		<-release
+		if ctx.Err() != nil {
+			atomic.StoreInt32(&cancelled, 1)
+		}
+		return nil, expect
+	})
+
+	// First caller gives up before the load completes
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 2)
+	go func() {
+		_, err := group.Get(ctx, "alpha")
+		errc <- err
+	}()
+	<-started
+	go func() {
+		_, err := group.Get(context.Background(), "alpha")
+		errc <- err
+	}()
+	cancel()
+	if err := <-errc; err != context.Canceled {
+		t.Errorf("expect cancelled caller to get %s, but got %v", context.Canceled, err)
+	}
+
+	close(release)
+	if err := <-errc; err != expect {
+		t.Errorf("expect waiter to get %s, but got %v", expect, err)
+	}
+	if atomic.LoadInt32(&cancelled) != 0 {
+		t.Error("expect shared load not to be cancelled")
+	}
+}
+
+// TestTTL ensures that entries expire after the group or entry TTL
+func TestTTL(t *testing.T) {
+	ctx := context.Background()
+
+	c, err := local.New(config.NopTree())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var loads int32
+	group := c.NewGroup("foo", 1024, func(ctx context.Context, key string) ([]byte, error) {
+		atomic.AddInt32(&loads, 1)
+		return []byte("bar"), nil
+	}, cache.WithTTL(20*time.Millisecond))
+
+	if _, err := group.Get(ctx, "alpha"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := group.Get(ctx, "alpha"); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&loads); n != 1 {
+		t.Errorf("expect to load data once, but got %d", n)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if _, err := group.Get(ctx, "alpha"); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&loads); n != 2 {
+		t.Errorf("expect to load data again after expiration, but got %d", n)
+	}
+
+	// Entry TTL overrides the group TTL
+	err = group.Set(ctx, "beta", []byte("baz"), cache.WithEntryTTL(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	got, err := group.Get(ctx, "beta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "baz" {
+		t.Errorf("expect to get baz, but got %s", got)
+	}
+}
+
+// TestSetRemove ensures that values can be replaced and evicted explicitly
+func TestSetRemove(t *testing.T) {
+	ctx := context.Background()
+
+	c, err := local.New(config.NopTree())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	group := c.NewGroup("foo", 1024, func(ctx context.Context, key string) ([]byte, error) {
+		return []byte("loaded"), nil
+	})
+
+	if err := group.Set(ctx, "alpha", []byte("set")); err != nil {
+		t.Fatal(err)
+	}
+	got, err := group.Get(ctx, "alpha")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "set" {
+		t.Errorf("expect to get set, but got %s", got)
+	}
+
+	if err := group.Remove(ctx, "alpha"); err != nil {
+		t.Fatal(err)
+	}
+	got, err = group.Get(ctx, "alpha")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "loaded" {
+		t.Errorf("expect to get loaded, but got %s", got)
+	}
+}
+
+// TestLoadRace ensures that a load in flight does not overwrite a concurrent
+// Set or Remove
+func TestLoadRace(t *testing.T) {
+	ctx := context.Background()
+
+	c, err := local.New(config.NopTree())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var loads int32
+	loading := make(chan struct{})
+	release := make(chan struct{})
+	group := c.NewGroup("foo", 1024, func(ctx context.Context, key string) ([]byte, error) {
+		if atomic.AddInt32(&loads, 1) == 1 {
+			loading <- struct{}{}
+			<-release
+		}
+		return []byte("loaded"), nil
+	})
+
+	// Remove while loading
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		group.Get(ctx, "alpha")
+	}()
+	<-loading
+	if err := group.Remove(ctx, "alpha"); err != nil {
+		t.Fatal(err)
+	}
+	release <- struct{}{}
+	<-done
+	if _, err := group.Get(ctx, "alpha"); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&loads); n != 2 {
+		t.Errorf("expect removed key to be loaded again, but got %d loads", n)
+	}
+
+	// Set while loading
+	atomic.StoreInt32(&loads, 0)
+	done = make(chan struct{})
+	go func() {
+		defer close(done)
+		group.Get(ctx, "beta")
+	}()
+	<-loading
+	if err := group.Set(ctx, "beta", []byte("set")); err != nil {
+		t.Fatal(err)
+	}
+	release <- struct{}{}
+	<-done
+	got, err := group.Get(ctx, "beta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "set" {
+		t.Errorf("expect to get set, but got %s", got)
+	}
+}
+
+// TestGroups ensures that group statistics are recorded
+func TestGroups(t *testing.T) {
+	ctx := context.Background()
+
+	c, err := local.New(config.NopTree())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Create groups which can hold 2 keys
+	beta := c.NewGroup("beta", 6, func(ctx context.Context, key string) ([]byte, error) {
+		if key == "err" {
+			return nil, errors.New("load error")
+		}
+		return []byte("bar"), nil
+	})
+	c.NewGroup("alpha", 6, func(ctx context.Context, key string) ([]byte, error) {
+		return []byte("bar"), nil
+	})
+
+	for _, key := range []string{"a", "a", "b", "c", "a", "err"} {
+		beta.Get(ctx, key)
+	}
+
+	groups := c.Groups()
+	if len(groups) != 2 {
+		t.Fatalf("expect to get 2 groups, but got %d", len(groups))
+	}
+	if groups[0].Name != "alpha" || groups[1].Name != "beta" {
+		t.Errorf("expect groups to be sorted by name, but got %s, %s", groups[0].Name, groups[1].Name)
+	}
+
+	expect := cache.GroupStats{
+		Name:       "beta",
+		Hits:       1,
+		Misses:     5,
+		Loads:      5,
+		LoadErrors: 1,
+		Length:     2,
+		Size:       6,
+		Capacity:   6,
+		Evictions:  2,
+		Oldest:     groups[1].Oldest,
+	}
+	if expect != groups[1] {
+		t.Errorf("expect to get %+v, but got %+v", expect, groups[1])
+	}
+	if r := groups[1].HitRatio(); r != 1.0/6.0 {
+		t.Errorf("expect hit ratio to be %f, but got %f", 1.0/6.0, r)
+	}
+}
+
+// TestStaleWhileRevalidate ensures that expired entries are served while they
+// are refreshed in background
+func TestStaleWhileRevalidate(t *testing.T) {
+	ctx := context.Background()
+
+	c, err := local.New(config.NopTree())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var loads int32
+	var fail int32
+	group := c.NewGroup("foo", 1024, func(ctx context.Context, key string) ([]byte, error) {
+		if atomic.LoadInt32(&fail) == 1 {
+			return nil, errors.New("load error")
+		}
+		n := atomic.AddInt32(&loads, 1)
+		return []byte(fmt.Sprintf("v%d", n)), nil
+	}, cache.WithTTL(20*time.Millisecond), cache.WithStaleWhileRevalidate(time.Hour))
+
+	expectValue := func(expect string) {
+		t.Helper()
+		got, err := group.Get(ctx, "alpha")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != expect {
+			t.Errorf("expect to get %s, but got %s", expect, got)
+		}
+	}
+
+	expectValue("v1")
+	time.Sleep(30 * time.Millisecond)
+
+	// A failing refresh keeps the stale value
+	atomic.StoreInt32(&fail, 1)
+	expectValue("v1")
+	time.Sleep(10 * time.Millisecond)
+	expectValue("v1")
+
+	// A successful refresh replaces the stale value
+	atomic.StoreInt32(&fail, 0)
+	expectValue("v1")
+	for i := 0; i < 100; i++ {
+		got, err := group.Get(ctx, "alpha")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) == "v2" {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("expect stale value to be refreshed")
+}
+
+// TestNegativeTTL ensures that load errors are cached
+func TestNegativeTTL(t *testing.T) {
+	ctx := context.Background()
+
+	c, err := local.New(config.NopTree())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errNotFound := errors.New("not found")
+	var loads int32
+	group := c.NewGroup("foo", 1024, func(ctx context.Context, key string) ([]byte, error) {
+		atomic.AddInt32(&loads, 1)
+		return nil, errNotFound
+	}, cache.WithNegativeTTL(20*time.Millisecond))
+
+	for i := 0; i < 3; i++ {
+		if _, err := group.Get(ctx, "alpha"); err != errNotFound {
+			t.Errorf("expect to get error %s, but got %s", errNotFound, err)
+		}
+	}
+	if n := atomic.LoadInt32(&loads); n != 1 {
+		t.Errorf("expect to load data once, but got %d", n)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if _, err := group.Get(ctx, "alpha"); err != errNotFound {
+		t.Errorf("expect to get error %s, but got %s", errNotFound, err)
+	}
+	if n := atomic.LoadInt32(&loads); n != 2 {
+		t.Errorf("expect to load data again after expiration, but got %d", n)
+	}
+}
@@ -3,33 +3,145 @@ package cache
 
 import (
 	"context"
+	"time"
 
 	"github.com/deixis/spine/contextutil"
 	"github.com/deixis/spine/disco"
+	"github.com/deixis/spine/net"
 )
 
 type Cache interface {
+	// Start does the initialisation work to bootstrap a Cache. For example,
+	// this function may start a server to answer peer requests and watch
+	// service discovery for peers.
+	Start(ctx context.Context, deps Dependencies) error
 	// NewGroup creates a LRU caching namespace with a size limit and a load
 	// function to be called when the value is mising
-	NewGroup(name string, cacheBytes int64, loader LoadFunc) Group
+	NewGroup(name string, cacheBytes int64, loader LoadFunc, o ...GroupOption) Group
+	// Groups returns the statistics of all groups sorted by name
+	Groups() []GroupStats
 }
 
 // A Group is a cache namespace
 type Group interface {
+	// Get returns the value for key and loads it when it is missing
 	Get(ctx context.Context, key string) ([]byte, error)
+	// Set stores value for key and replaces the existing one
+	Set(ctx context.Context, key string, value []byte, o ...EntryOption) error
+	// Remove evicts key from the group.
+	// If the key does not exist, no action is taken.
+	Remove(ctx context.Context, key string) error
 }
 
 // A LoadFunc loads data for a key.
 type LoadFunc func(context context.Context, key string) ([]byte, error)
 
+// GroupOption configures how we set up a group
+type GroupOption func(*GroupOptions)
+
+// GroupOptions configure a Group. GroupOptions are set by the GroupOption
+// values passed to NewGroup.
+type GroupOptions struct {
+	// TTL is the default time to live of all entries. Zero means that entries
+	// live until they are evicted.
+	TTL time.Duration
+	// Stale is how long an expired entry is still served while it is being
+	// refreshed in background. Zero means that expired entries are never
+	// served.
+	Stale time.Duration
+	// NegativeTTL is how long a load error is cached and returned without
+	// calling the LoadFunc again. Zero means that errors are not cached.
+	NegativeTTL time.Duration
+	// Decoded is the maximum number of decoded values kept in memory by a
+	// TypedGroup. Zero means that values are decoded on each Get.
+	Decoded int
+}
+
+// BuildGroupOptions builds GroupOptions with the given options applied
+func BuildGroupOptions(o ...GroupOption) GroupOptions {
+	opts := GroupOptions{}
+	for _, o := range o {
+		o(&opts)
+	}
+	return opts
+}
+
+// WithTTL sets the default time to live of all entries of a group
+func WithTTL(d time.Duration) GroupOption {
+	return func(o *GroupOptions) {
+		o.TTL = d
+	}
+}
+
+// WithStaleWhileRevalidate serves expired entries for up to d while they are
+// refreshed in background
+func WithStaleWhileRevalidate(d time.Duration) GroupOption {
+	return func(o *GroupOptions) {
+		o.Stale = d
+	}
+}
+
+// WithNegativeTTL caches load errors (e.g. not found) for d
+func WithNegativeTTL(d time.Duration) GroupOption {
+	return func(o *GroupOptions) {
+		o.NegativeTTL = d
+	}
+}
+
+// WithDecodedValues keeps up to n decoded values in memory, so a TypedGroup
+// does not decode values on each Get
+func WithDecodedValues(n int) GroupOption {
+	return func(o *GroupOptions) {
+		o.Decoded = n
+	}
+}
+
+// EntryOption configures how we store an entry
+type EntryOption func(*EntryOptions)
+
+// EntryOptions configure an entry. EntryOptions are set by the EntryOption
+// values passed to Set.
+type EntryOptions struct {
+	// TTL is the entry time to live. Zero means that the entry lives until it
+	// is evicted.
+	TTL time.Duration
+}
+
+// BuildEntryOptions builds EntryOptions for a group with the given options
+// applied
+func BuildEntryOptions(g GroupOptions, o ...EntryOption) EntryOptions {
+	opts := EntryOptions{
+		TTL: g.TTL,
+	}
+	for _, o := range o {
+		o(&opts)
+	}
+	return opts
+}
+
+// WithEntryTTL overrides the group time to live for a single entry
+func WithEntryTTL(d time.Duration) EntryOption {
+	return func(o *EntryOptions) {
+		o.TTL = d
+	}
+}
+
 // Dependencies is an interface to "inject" required services
 type Dependencies interface {
 	Disco() disco.Agent
+	RegisterServer(addr string, s net.Server)
 }
 
 // NewGroup calls `NewGroup` on the context `Cache`
-func NewGroup(ctx context.Context, name string, cacheBytes int64, loader LoadFunc) Group {
-	return FromContext(ctx).NewGroup(name, cacheBytes, loader)
+func NewGroup(
+	ctx context.Context, name string, cacheBytes int64, loader LoadFunc, o ...GroupOption,
+) Group {
+	return FromContext(ctx).NewGroup(name, cacheBytes, loader, o...)
+}
+
+// Groups calls `Groups` on the context `Cache`
+func Groups(ctx context.Context) []GroupStats {
+	return FromContext(ctx).Groups()
 }
 
 type contextKey struct{}
@@ -0,0 +1,44 @@
+package cache
+
+import "time"
+
+// Entry is a group value stored in a LRU cache
+type Entry struct {
+	Data []byte
+	// Err is the error returned by the LoadFunc when it failed
+	Err error
+	// Expires is the time after which the entry must be refreshed. A zero
+	// value means that the entry never needs to be refreshed.
+	Expires time.Time
+}
+
+// NewEntry returns an entry for data which is valid for ttl, along with the
+// time it must be kept in a LRU cache
+func NewEntry(data []byte, ttl time.Duration, o GroupOptions) (*Entry, time.Duration) {
+	if ttl <= 0 {
+		return &Entry{Data: data}, 0
+	}
+	return &Entry{Data: data, Expires: time.Now().Add(ttl)}, ttl + o.Stale
+}
+
+// NewErrorEntry returns an entry for a load error, along with the time it must
+// be kept in a LRU cache. It returns false when errors must not be cached.
+func NewErrorEntry(err error, o GroupOptions) (*Entry, time.Duration, bool) {
+	if o.NegativeTTL <= 0 {
+		return nil, 0, false
+	}
+	return &Entry{Err: err}, o.NegativeTTL, true
+}
+
+// Stale returns whether the entry has expired at time t
+func (e *Entry) Stale(t time.Time) bool {
+	return !e.Expires.IsZero() && !t.Before(e.Expires)
+}
+
+// Size returns the size of the entry in a LRU cache
+func (e *Entry) Size() int {
+	if e.Err != nil {
+		return len(e.Err.Error())
+	}
+	return len(e.Data)
+}
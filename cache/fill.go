@@ -0,0 +1,69 @@
+package cache
+
+import "sync"
+
+// Fills orders loads with writes, so that a load which completes after a
+// concurrent Set or Remove does not overwrite the newer value, or bring a
+// removed key back.
+//
+//	gen := fills.Begin(key)
+//	data, err := load(ctx, key)
+//	fills.Commit(key, gen, func() { lru.Set(key, data) })
+type Fills struct {
+	mu   sync.Mutex
+	keys map[string]*fill
+}
+
+type fill struct {
+	// loads is the number of loads in flight
+	loads int
+	// gen is incremented by each write during the loads
+	gen uint64
+}
+
+// Begin records a load of key and returns its generation. Commit must be
+// called once the load completes.
+func (f *Fills) Begin(key string) uint64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.keys == nil {
+		f.keys = map[string]*fill{}
+	}
+	s, ok := f.keys[key]
+	if !ok {
+		s = &fill{}
+		f.keys[key] = s
+	}
+	s.loads++
+	return s.gen
+}
+
+// Commit calls store unless key has been written since Begin returned gen.
+// It returns whether store has been called.
+func (f *Fills) Commit(key string, gen uint64, store func()) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	s := f.keys[key]
+	s.loads--
+	if s.loads == 0 {
+		delete(f.keys, key)
+	}
+	if s.gen != gen {
+		return false
+	}
+	store()
+	return true
+}
+
+// Write calls write and invalidates the loads of key in flight
+func (f *Fills) Write(key string, write func()) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if s, ok := f.keys[key]; ok {
+		s.gen++
+	}
+	write()
+}
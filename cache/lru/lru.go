@@ -44,6 +44,14 @@ type entry struct {
 	value        Value
 	size         int64
 	timeAccessed time.Time
+	// expires is the time after which the entry is no longer valid.
+	// A zero value means the entry never expires.
+	expires time.Time
+}
+
+// expired returns whether the entry is no longer valid at time t
+func (e *entry) expired(t time.Time) bool {
+	return !e.expires.IsZero() && !t.Before(e.expires)
 }
 
 // New creates a new empty cache with the given capacity.
@@ -65,6 +73,10 @@ func (lru *Cache) Get(key string) (v Value, ok bool) {
 	if element == nil {
 		return nil, false
 	}
+	if element.Value.(*entry).expired(time.Now()) {
+		lru.remove(element)
+		return nil, false
+	}
 	lru.moveToFront(element)
 	return element.Value.(*entry).value, true
 }
@@ -75,7 +87,7 @@ func (lru *Cache) Peek(key string) (v Value, ok bool) {
 	defer lru.mu.Unlock()
 
 	element := lru.table[key]
-	if element == nil {
+	if element == nil || element.Value.(*entry).expired(time.Now()) {
 		return nil, false
 	}
 	return element.Value.(*entry).value, true
@@ -83,13 +95,25 @@ func (lru *Cache) Peek(key string) (v Value, ok bool) {
 
 // Set sets a value in the cache.
 func (lru *Cache) Set(key string, value Value) {
+	lru.SetWithTTL(key, value, 0)
+}
+
+// SetWithTTL sets a value in the cache, which expires after ttl.
+// A zero ttl means the value never expires.
+func (lru *Cache) SetWithTTL(key string, value Value, ttl time.Duration) {
 	lru.mu.Lock()
 	defer lru.mu.Unlock()
 
+	var expires time.Time
+	if ttl > 0 {
+		expires = time.Now().Add(ttl)
+	}
+
 	if element := lru.table[key]; element != nil {
+		element.Value.(*entry).expires = expires
 		lru.updateInplace(element, value)
 	} else {
-		lru.addNew(key, value)
+		lru.addNew(key, value, expires)
 	}
 }
 
@@ -99,11 +123,15 @@ func (lru *Cache) SetIfAbsent(key string, value Value) {
 	lru.mu.Lock()
 	defer lru.mu.Unlock()
 
-	if element := lru.table[key]; element != nil {
+	element := lru.table[key]
+	if element != nil && !element.Value.(*entry).expired(time.Now()) {
 		lru.moveToFront(element)
-	} else {
-		lru.addNew(key, value)
+		return
+	}
+	if element != nil {
+		lru.remove(element)
 	}
+	lru.addNew(key, value, time.Time{})
 }
 
 // Delete removes an entry from the cache, and returns if the entry existed.
@@ -116,9 +144,7 @@ func (lru *Cache) Delete(key string) bool {
 		return false
 	}
 
-	lru.list.Remove(element)
-	delete(lru.table, key)
-	lru.size -= element.Value.(*entry).size
+	lru.remove(element)
 	return true
 }
 
@@ -243,8 +269,14 @@ func (lru *Cache) moveToFront(element *list.Element) {
 	element.Value.(*entry).timeAccessed = time.Now()
 }
 
-func (lru *Cache) addNew(key string, value Value) {
-	newEntry := &entry{key, value, int64(value.Size()), time.Now()}
+func (lru *Cache) remove(element *list.Element) {
+	lru.list.Remove(element)
+	delete(lru.table, element.Value.(*entry).key)
+	lru.size -= element.Value.(*entry).size
+}
+
+func (lru *Cache) addNew(key string, value Value, expires time.Time) {
+	newEntry := &entry{key, value, int64(value.Size()), time.Now(), expires}
 	element := lru.list.PushFront(newEntry)
 	lru.table[key] = element
 	lru.size += newEntry.size
@@ -10,12 +10,20 @@ func NopCache() Cache {
 	return &nopCache{}
 }
 
+func (c *nopCache) Start(ctx context.Context, deps Dependencies) error {
+	return nil
+}
+
 func (c *nopCache) NewGroup(
-	name string, cacheBytes int64, loader LoadFunc,
+	name string, cacheBytes int64, loader LoadFunc, o ...GroupOption,
 ) Group {
 	return &group{load: loader}
 }
 
+func (c *nopCache) Groups() []GroupStats {
+	return nil
+}
+
 type group struct {
 	load LoadFunc
 }
@@ -23,3 +31,11 @@ type group struct {
 func (g *group) Get(ctx context.Context, key string) ([]byte, error) {
 	return g.load(ctx, key)
 }
+
+func (g *group) Set(ctx context.Context, key string, value []byte, o ...EntryOption) error {
+	return nil
+}
+
+func (g *group) Remove(ctx context.Context, key string) error {
+	return nil
+}
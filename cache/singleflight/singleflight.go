@@ -0,0 +1,76 @@
+// Package singleflight provides a duplicate function call suppression
+// mechanism.
+//
+// Inspired by: https://github.com/golang/groupcache/blob/master/singleflight/singleflight.go
+package singleflight
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// call is an in-flight or completed Do call
+type call struct {
+	done chan struct{}
+	val  interface{}
+	err  error
+}
+
+// Group represents a class of work and forms a namespace in which
+// units of work can be executed with duplicate suppression.
+type Group struct {
+	mu sync.Mutex
+	m  map[string]*call
+}
+
+// Do executes and returns the results of the given function, making sure that
+// only one execution is in-flight for a given key at a time. If a duplicate
+// comes in, the duplicate caller waits for the original to complete and
+// receives the same results.
+//
+// fn is executed with a context that carries the values of ctx, but which is
+// not cancelled with it. Therefore a caller giving up does not cancel the
+// execution shared with the other callers. Do returns ctx.Err() as soon as
+// ctx is done.
+func (g *Group) Do(
+	ctx context.Context, key string, fn func(context.Context) (interface{}, error),
+) (interface{}, error) {
+	g.mu.Lock()
+	if g.m == nil {
+		g.m = make(map[string]*call)
+	}
+	c, ok := g.m[key]
+	if !ok {
+		c = &call{done: make(chan struct{})}
+		g.m[key] = c
+		go g.exec(context.WithoutCancel(ctx), key, c, fn)
+	}
+	g.mu.Unlock()
+
+	select {
+	case <-c.done:
+		return c.val, c.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (g *Group) exec(
+	ctx context.Context, key string, c *call, fn func(context.Context) (interface{}, error),
+) {
+	defer func() {
+		// fn does not run on the caller goroutine, so a panic must not crash
+		// the whole process
+		if r := recover(); r != nil {
+			c.err = fmt.Errorf("singleflight: panic in %s (%v)", key, r)
+		}
+
+		g.mu.Lock()
+		delete(g.m, key)
+		g.mu.Unlock()
+		close(c.done)
+	}()
+
+	c.val, c.err = fn(ctx)
+}
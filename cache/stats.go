@@ -0,0 +1,135 @@
+package cache
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/deixis/spine/cache/lru"
+	"github.com/deixis/spine/stats"
+)
+
+// GroupStats are the statistics of a cache group
+type GroupStats struct {
+	Name string `json:"name"`
+	// Hits is the number of Get calls served from the cache
+	Hits int64 `json:"hits"`
+	// Misses is the number of Get calls not served from the cache
+	Misses int64 `json:"misses"`
+	// Loads is the number of calls to the group LoadFunc
+	Loads int64 `json:"loads"`
+	// LoadErrors is the number of calls to the group LoadFunc that failed
+	LoadErrors int64 `json:"loadErrors"`
+	// Length is the number of entries in the cache
+	Length int64 `json:"length"`
+	// Size is the sum of the size of all entries
+	Size int64 `json:"size"`
+	// Capacity is the maximum size of the cache
+	Capacity int64 `json:"capacity"`
+	// Evictions is the number of entries evicted to free capacity
+	Evictions int64 `json:"evictions"`
+	// Oldest is the last access time of the least recently used entry
+	Oldest time.Time `json:"oldest"`
+}
+
+// HitRatio returns the fraction of Get calls served from the cache
+func (s *GroupStats) HitRatio() float64 {
+	total := s.Hits + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(total)
+}
+
+// Metrics records the activity of a group and reports it to the context
+// `Stats`. All metrics are tagged with the group name.
+type Metrics struct {
+	name string
+	tags map[string]string
+
+	hits       int64
+	misses     int64
+	loads      int64
+	loadErrors int64
+	// evictions is the number of evictions already reported to stats
+	evictions int64
+}
+
+// NewMetrics returns Metrics for the group name
+func NewMetrics(name string) *Metrics {
+	return &Metrics{
+		name: name,
+		tags: map[string]string{"group": name},
+	}
+}
+
+// Hit records a Get call served from the cache
+func (m *Metrics) Hit(ctx context.Context) {
+	atomic.AddInt64(&m.hits, 1)
+	stats.Inc(ctx, "cache.hit", m.tags)
+}
+
+// Miss records a Get call not served from the cache
+func (m *Metrics) Miss(ctx context.Context) {
+	atomic.AddInt64(&m.misses, 1)
+	stats.Inc(ctx, "cache.miss", m.tags)
+}
+
+// Load records a call to the group LoadFunc which took d
+func (m *Metrics) Load(ctx context.Context, d time.Duration, err error) {
+	atomic.AddInt64(&m.loads, 1)
+	stats.Timing(ctx, "cache.load", d, m.tags)
+	if err != nil {
+		atomic.AddInt64(&m.loadErrors, 1)
+		stats.Inc(ctx, "cache.load.err", m.tags)
+	}
+}
+
+// Store reports the size of the group caches and the evictions that
+// occurred since the last report. It should be called after each write.
+func (m *Metrics) Store(ctx context.Context, caches ...*lru.Cache) {
+	var length, size, evictions int64
+	for _, c := range caches {
+		l, s, _, e, _ := c.Stats()
+		length += l
+		size += s
+		evictions += e
+	}
+
+	s := stats.FromContext(ctx)
+	s.Gauge("cache.length", length, m.tags)
+	s.Gauge("cache.size", size, m.tags)
+
+	for {
+		reported := atomic.LoadInt64(&m.evictions)
+		if evictions <= reported {
+			break
+		}
+		if atomic.CompareAndSwapInt64(&m.evictions, reported, evictions) {
+			s.Count("cache.eviction", evictions-reported, m.tags)
+			break
+		}
+	}
+}
+
+// Stats returns the statistics of a group made of the given caches
+func (m *Metrics) Stats(caches ...*lru.Cache) GroupStats {
+	gs := GroupStats{
+		Name:       m.name,
+		Hits:       atomic.LoadInt64(&m.hits),
+		Misses:     atomic.LoadInt64(&m.misses),
+		Loads:      atomic.LoadInt64(&m.loads),
+		LoadErrors: atomic.LoadInt64(&m.loadErrors),
+	}
+	for _, c := range caches {
+		l, s, cp, e, o := c.Stats()
+		gs.Length += l
+		gs.Size += s
+		gs.Capacity += cp
+		gs.Evictions += e
+		if !o.IsZero() && (gs.Oldest.IsZero() || o.Before(gs.Oldest)) {
+			gs.Oldest = o
+		}
+	}
+	return gs
+}
@@ -0,0 +1,111 @@
+package cache
+
+import (
+	"context"
+
+	"github.com/deixis/spine/cache/lru"
+)
+
+// A TypedLoadFunc loads a value of type T for a key
+type TypedLoadFunc[T any] func(ctx context.Context, key string) (T, error)
+
+// TypedGroup is a cache namespace for values of type T. Values are encoded
+// with a Codec and stored in a Group.
+type TypedGroup[T any] struct {
+	group Group
+	codec Codec[T]
+	// decoded contains the last decoded values along with the bytes they were
+	// decoded from. It is nil when decoded values are not kept in memory.
+	decoded *lru.Cache
+}
+
+// NewTypedGroup creates a LRU caching namespace for values of type T on the
+// context `Cache`.
+//
+// When WithDecodedValues is given, decoded values are shared between callers,
+// so they must not be modified.
+func NewTypedGroup[T any](
+	ctx context.Context,
+	name string,
+	cacheBytes int64,
+	codec Codec[T],
+	loader TypedLoadFunc[T],
+	o ...GroupOption,
+) *TypedGroup[T] {
+	g := &TypedGroup[T]{codec: codec}
+	if opts := BuildGroupOptions(o...); opts.Decoded > 0 {
+		g.decoded = lru.New(int64(opts.Decoded))
+	}
+	g.group = NewGroup(ctx, name, cacheBytes, func(ctx context.Context, key string) ([]byte, error) {
+		v, err := loader(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		return codec.Encode(v)
+	}, o...)
+	return g
+}
+
+// Get returns the value for key and loads it when it is missing
+func (g *TypedGroup[T]) Get(ctx context.Context, key string) (T, error) {
+	var zero T
+
+	data, err := g.group.Get(ctx, key)
+	if err != nil {
+		return zero, err
+	}
+	if g.decoded == nil {
+		return g.codec.Decode(data)
+	}
+
+	// Group adapters return the bytes they hold, so the decoded value is only
+	// reused as long as the group still holds the same bytes
+	if v, ok := g.decoded.Get(key); ok {
+		if d := v.(*decoded[T]); sameBytes(d.data, data) {
+			return d.v, nil
+		}
+	}
+	v, err := g.codec.Decode(data)
+	if err != nil {
+		return zero, err
+	}
+	g.decoded.Set(key, &decoded[T]{data: data, v: v})
+	return v, nil
+}
+
+// Set stores v for key and replaces the existing one
+func (g *TypedGroup[T]) Set(ctx context.Context, key string, v T, o ...EntryOption) error {
+	data, err := g.codec.Encode(v)
+	if err != nil {
+		return err
+	}
+	if g.decoded != nil {
+		g.decoded.Delete(key)
+	}
+	return g.group.Set(ctx, key, data, o...)
+}
+
+// Remove evicts key from the group.
+// If the key does not exist, no action is taken.
+func (g *TypedGroup[T]) Remove(ctx context.Context, key string) error {
+	if g.decoded != nil {
+		g.decoded.Delete(key)
+	}
+	return g.group.Remove(ctx, key)
+}
+
+// decoded is a decoded value stored in a LRU cache
+type decoded[T any] struct {
+	data []byte
+	v    T
+}
+
+// Size returns 1, so the LRU cache capacity is a number of values
+func (d *decoded[T]) Size() int {
+	return 1
+}
+
+// sameBytes returns whether a and b share the same underlying array
+func sameBytes(a, b []byte) bool {
+	return len(a) > 0 && len(a) == len(b) && &a[0] == &b[0]
+}
@@ -0,0 +1,115 @@
+package cache_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"github.com/deixis/spine/cache"
+	"github.com/deixis/spine/cache/adapter/local"
+	"github.com/deixis/spine/config"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type user struct {
+	Name string
+	Age  int
+}
+
+func TestTypedGroupCodecs(t *testing.T) {
+	ctx := newContext(t)
+
+	expect := user{Name: "alpha", Age: 42}
+	loader := func(ctx context.Context, key string) (user, error) {
+		return expect, nil
+	}
+
+	codecs := map[string]cache.Codec[user]{
+		"json": cache.JSON[user](),
+		"gob":  cache.Gob[user](),
+	}
+	for name, codec := range codecs {
+		g := cache.NewTypedGroup(ctx, name, 1024, codec, loader)
+		for i := 0; i < 2; i++ {
+			got, err := g.Get(ctx, "alpha")
+			if err != nil {
+				t.Fatal(name, err)
+			}
+			if got != expect {
+				t.Errorf("%s: expect to get %v, but got %v", name, expect, got)
+			}
+		}
+	}
+
+	g := cache.NewTypedGroup(ctx, "proto", 1024, cache.Proto[*wrapperspb.StringValue](),
+		func(ctx context.Context, key string) (*wrapperspb.StringValue, error) {
+			return wrapperspb.String(key), nil
+		},
+	)
+	got, err := g.Get(ctx, "alpha")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !proto.Equal(got, wrapperspb.String("alpha")) {
+		t.Errorf("expect to get alpha, but got %v", got)
+	}
+}
+
+// TestTypedGroupDecoded ensures that decoded values are reused until the
+// group value changes
+func TestTypedGroupDecoded(t *testing.T) {
+	ctx := newContext(t)
+
+	codec := &countingCodec{Codec: cache.JSON[user]()}
+	g := cache.NewTypedGroup(ctx, "foo", 1024, codec,
+		func(ctx context.Context, key string) (user, error) {
+			return user{Name: key}, nil
+		},
+		cache.WithDecodedValues(10),
+	)
+
+	expectUser := func(expect user) {
+		t.Helper()
+		got, err := g.Get(ctx, "alpha")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != expect {
+			t.Errorf("expect to get %v, but got %v", expect, got)
+		}
+	}
+
+	expectUser(user{Name: "alpha"})
+	expectUser(user{Name: "alpha"})
+	if n := atomic.LoadInt32(&codec.decodes); n != 1 {
+		t.Errorf("expect to decode once, but got %d", n)
+	}
+
+	if err := g.Set(ctx, "alpha", user{Name: "beta"}); err != nil {
+		t.Fatal(err)
+	}
+	expectUser(user{Name: "beta"})
+	expectUser(user{Name: "beta"})
+	if n := atomic.LoadInt32(&codec.decodes); n != 2 {
+		t.Errorf("expect to decode twice, but got %d", n)
+	}
+}
+
+func newContext(t *testing.T) context.Context {
+	c, err := local.New(config.NopTree())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cache.WithContext(context.Background(), c)
+}
+
+type countingCodec struct {
+	cache.Codec[user]
+	decodes int32
+}
+
+func (c *countingCodec) Decode(data []byte) (user, error) {
+	atomic.AddInt32(&c.decodes, 1)
+	return c.Codec.Decode(data)
+}
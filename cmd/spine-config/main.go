@@ -0,0 +1,142 @@
+// Command spine-config manages encrypted config values
+//
+// The secret keys are read from CONFIG_KEYS or from the file at
+// CONFIG_KEYS_FILE (see config.ParseKeys).
+//
+// Usage:
+//
+//	spine-config keygen [-id n]            generate a new secret key
+//	spine-config encrypt [value]           encrypt a value (or stdin)
+//	spine-config encrypt -file f key...    encrypt TOML keys of a file in place
+//	spine-config rotate -file f            re-encrypt all values with the latest key
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/deixis/spine/config"
+	"github.com/deixis/spine/crypto"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "keygen":
+		err = keygen(os.Args[2:])
+	case "encrypt":
+		err = encrypt(os.Args[2:])
+	case "rotate":
+		err = rotate(os.Args[2:])
+	default:
+		usage()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "spine-config:", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: spine-config keygen|encrypt|rotate [flags]")
+	os.Exit(2)
+}
+
+func keygen(args []string) error {
+	fs := flag.NewFlagSet("keygen", flag.ExitOnError)
+	id := fs.Uint("id", 1, "key ID (must be higher than existing keys)")
+	fs.Parse(args)
+
+	key := make([]byte, crypto.KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return err
+	}
+	fmt.Printf("%d:%s\n", *id, base64.StdEncoding.EncodeToString(key))
+	return nil
+}
+
+func encrypt(args []string) error {
+	fs := flag.NewFlagSet("encrypt", flag.ExitOnError)
+	file := fs.String("file", "", "TOML config file to encrypt in place")
+	fs.Parse(args)
+
+	keys, err := config.KeysFromEnv()
+	if err != nil {
+		return err
+	}
+
+	if *file != "" {
+		if fs.NArg() == 0 {
+			return fmt.Errorf("missing keys to encrypt")
+		}
+		data, err := ioutil.ReadFile(*file)
+		if err != nil {
+			return err
+		}
+		data, err = config.EncryptTOMLKeys(data, keys, fs.Args()...)
+		if err != nil {
+			return err
+		}
+		return writeFile(*file, data)
+	}
+
+	value := strings.Join(fs.Args(), " ")
+	if fs.NArg() == 0 {
+		data, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		value = strings.TrimRight(string(data), "\r\n")
+	}
+	enc, err := config.EncryptValue(keys, value)
+	if err != nil {
+		return err
+	}
+	fmt.Println(enc)
+	return nil
+}
+
+func rotate(args []string) error {
+	fs := flag.NewFlagSet("rotate", flag.ExitOnError)
+	file := fs.String("file", "", "config file to rotate in place")
+	fs.Parse(args)
+	if *file == "" {
+		return fmt.Errorf("missing -file")
+	}
+
+	keys, err := config.KeysFromEnv()
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadFile(*file)
+	if err != nil {
+		return err
+	}
+	data, n, err := config.RotateSecrets(data, keys)
+	if err != nil {
+		return err
+	}
+	if err := writeFile(*file, data); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "%d value(s) rotated\n", n)
+	return nil
+}
+
+// writeFile replaces the content of path while keeping its mode
+func writeFile(path string, data []byte) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, fi.Mode())
+}
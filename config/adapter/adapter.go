@@ -1,6 +1,7 @@
 package store
 
 import (
+	"context"
 	"io"
 	"net/url"
 )
@@ -13,3 +14,11 @@ type Store interface {
 	// Load loads the configuration from the store
 	Load() (io.ReadCloser, error)
 }
+
+// Watcher is an optional interface implemented by stores which can detect
+// configuration changes
+type Watcher interface {
+	// Watch calls notify each time the configuration changes. It blocks until
+	// ctx is done or the store can no longer be watched.
+	Watch(ctx context.Context, notify func()) error
+}
@@ -5,15 +5,20 @@
 //
 // e.g.
 // CONFIG_URI=consul://prod.consul.cloud.com:8301/my/key?dc=frankfurt1&token=123
+//
+// The key is watched with blocking queries, so changes are picked up without a
+// restart.
 package consul
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/hashicorp/consul/api"
 	"github.com/pkg/errors"
@@ -27,6 +32,10 @@ const Name = "consul"
 // ErrMissingStoreKey means the given URL does not contain any key (path)
 var ErrMissingStoreKey = errors.New("cannot initialise config without store key")
 
+// watchRetry is the time to wait before watching the key again after a
+// failure
+const watchRetry = 5 * time.Second
+
 // ErrStoreKeyNotFound means the configuration does not exist on Consul
 var ErrStoreKeyNotFound = errors.New("store config does not exist")
 
@@ -83,3 +92,37 @@ func (s *Store) Load() (io.ReadCloser, error) {
 
 	return ioutil.NopCloser(bytes.NewReader(pair.Value)), nil
 }
+
+// Watch implements Watcher
+func (s *Store) Watch(ctx context.Context, notify func()) error {
+	kv := s.Client.KV()
+
+	var index uint64
+	for {
+		opts := (&api.QueryOptions{WaitIndex: index}).WithContext(ctx)
+		_, meta, err := kv.Get(s.Key, opts)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(watchRetry):
+			}
+			continue
+		}
+
+		switch {
+		case index == 0:
+			// First query returns immediately with the current index
+		case meta.LastIndex < index:
+			// The index went backwards (e.g. the Consul cluster has been
+			// restored), so start again from the current state
+			notify()
+		case meta.LastIndex > index:
+			notify()
+		}
+		index = meta.LastIndex
+	}
+}
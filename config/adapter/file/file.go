@@ -1,16 +1,25 @@
-// Package file reads configuration from a JSON file
+// Package file reads configuration from a TOML, YAML or JSON file
 //
 // e.g.
-// CONFIG_URI=file://${PWD}/config/dev.json
+// CONFIG_URI=file://${PWD}/config/dev.toml
+//
+// The file is watched with fsnotify, so changes are picked up without a
+// restart. Files swapped through a symlinked directory, like Kubernetes
+// ConfigMap and Secret volumes, are supported.
 package file
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
 	"io"
 	"net/url"
 	"os"
+	"path/filepath"
 
-	"github.com/pkg/errors"
 	a "github.com/deixis/spine/config/adapter"
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
 )
 
 // Name contains the adapter registered name
@@ -39,3 +48,61 @@ func (s *Store) Load() (io.ReadCloser, error) {
 	}
 	return file, nil
 }
+
+// Watch implements Watcher
+func (s *Store) Watch(ctx context.Context, notify func()) error {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return errors.Wrap(err, "cannot create file watcher")
+	}
+	defer w.Close()
+
+	// Watch the directory rather than the file, because editors and
+	// orchestrators often replace the file instead of writing to it
+	path := filepath.Clean(s.Path)
+	if err := w.Add(filepath.Dir(path)); err != nil {
+		return errors.Wrapf(err, "cannot watch config file (%s)", s.Path)
+	}
+
+	last := s.sum()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case e, ok := <-w.Events:
+			if !ok {
+				return nil
+			}
+			if filepath.Clean(e.Name) == path {
+				if e.Has(fsnotify.Write) || e.Has(fsnotify.Create) {
+					last = s.sum()
+					notify()
+				}
+				continue
+			}
+
+			// Other entries can change the file through a symlink (e.g. the
+			// ..data symlink of Kubernetes volumes), so compare its content
+			sum := s.sum()
+			if sum != nil && !bytes.Equal(sum, last) {
+				last = sum
+				notify()
+			}
+		case err, ok := <-w.Errors:
+			if !ok {
+				return nil
+			}
+			return errors.Wrap(err, "error watching config file")
+		}
+	}
+}
+
+// sum returns the checksum of the file content, or nil when it cannot be read
+func (s *Store) sum() []byte {
+	b, err := os.ReadFile(s.Path)
+	if err != nil {
+		return nil
+	}
+	h := sha256.Sum256(b)
+	return h[:]
+}
@@ -0,0 +1,128 @@
+package file_test
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	store "github.com/deixis/spine/config/adapter"
+	"github.com/deixis/spine/config/adapter/file"
+)
+
+func TestWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, []byte("foo = 1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := file.New(&url.URL{Scheme: "file", Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	notified := make(chan struct{}, 16)
+	done := make(chan error)
+	go func() {
+		done <- s.(store.Watcher).Watch(ctx, func() {
+			notified <- struct{}{}
+		})
+	}()
+
+	// Write until the watcher is set up and notifies the change
+	tick := time.NewTicker(10 * time.Millisecond)
+	defer tick.Stop()
+	timeout := time.After(5 * time.Second)
+loop:
+	for {
+		select {
+		case <-notified:
+			break loop
+		case <-tick.C:
+			if err := os.WriteFile(path, []byte("foo = 2"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		case <-timeout:
+			t.Fatal("expect to be notified")
+		}
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("expect watch to return without error, but got %s", err)
+	}
+}
+
+// TestWatchSymlink tests whether a file swapped through a symlinked directory
+// is picked up, like a Kubernetes ConfigMap volume
+func TestWatchSymlink(t *testing.T) {
+	dir := t.TempDir()
+	for i, v := range []string{"foo = 1", "foo = 2"} {
+		data := filepath.Join(dir, fmt.Sprintf("..data_%d", i))
+		if err := os.Mkdir(data, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(data, "config.toml"), []byte(v), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("..data_0", filepath.Join(dir, "..data")); err != nil {
+		t.Skip("symlinks are not supported", err)
+	}
+	path := filepath.Join(dir, "config.toml")
+	if err := os.Symlink(filepath.Join("..data", "config.toml"), path); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := file.New(&url.URL{Scheme: "file", Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	notified := make(chan struct{}, 16)
+	done := make(chan error)
+	go func() {
+		done <- s.(store.Watcher).Watch(ctx, func() {
+			notified <- struct{}{}
+		})
+	}()
+
+	// Swap the ..data symlink until the watcher is set up and notifies the
+	// change
+	tick := time.NewTicker(10 * time.Millisecond)
+	defer tick.Stop()
+	timeout := time.After(5 * time.Second)
+	swaps := 0
+loop:
+	for {
+		select {
+		case <-notified:
+			break loop
+		case <-tick.C:
+			swaps++
+			tmp := filepath.Join(dir, "..data_tmp")
+			if err := os.Symlink(fmt.Sprintf("..data_%d", swaps%2), tmp); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Rename(tmp, filepath.Join(dir, "..data")); err != nil {
+				t.Fatal(err)
+			}
+		case <-timeout:
+			t.Fatal("expect to be notified")
+		}
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("expect watch to return without error, but got %s", err)
+	}
+}
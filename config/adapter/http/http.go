@@ -0,0 +1,344 @@
+// Package http reads configuration from an HTTP(S) config service
+//
+// e.g.
+// CONFIG_URI=https://config.internal/my/app.toml?token=123&ca=/etc/ssl/ca.pem
+//
+// Options are given as URI query parameters, or else as environment variables:
+//   - token (CONFIG_HTTP_TOKEN): bearer token sent with each request
+//   - header (CONFIG_HTTP_HEADERS): extra headers (Name:Value). Several
+//     headers are given with several query parameters, or comma-separated in
+//     the environment variable.
+//   - ca, cert, key (CONFIG_HTTP_CA, CONFIG_HTTP_CERT, CONFIG_HTTP_KEY): PEM
+//     files of the CA and of the client certificate
+//   - interval (CONFIG_HTTP_INTERVAL): poll interval to watch changes (30s)
+//   - cache (CONFIG_HTTP_CACHE): path of the last-known-good copy. It is
+//     stored in a private directory of the user cache directory by default
+//     (e.g. ~/.cache/spine/config), and disabled when there is none.
+//
+// Basic auth credentials can be given in the URI user info. Other query
+// parameters are sent to the config service.
+//
+// The config is polled with conditional requests (ETag), so changes are picked
+// up without a restart. When the config service fails, the last-known-good copy
+// cached on disk is used instead. The copy may contain secrets, so it is only
+// loaded when it is owned by the current user and not writable by others.
+package http
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	nethttp "net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	a "github.com/deixis/spine/config/adapter"
+	"github.com/pkg/errors"
+)
+
+const (
+	// Name contains the adapter registered name
+	Name = "http"
+	// NameTLS contains the adapter registered name for HTTPS
+	NameTLS = "https"
+)
+
+const (
+	defaultInterval = 30 * time.Second
+	defaultTimeout  = 10 * time.Second
+)
+
+// options contains the URI query parameters and their environment variable
+var options = map[string]string{
+	"token":    "CONFIG_HTTP_TOKEN",
+	"header":   "CONFIG_HTTP_HEADERS",
+	"ca":       "CONFIG_HTTP_CA",
+	"cert":     "CONFIG_HTTP_CERT",
+	"key":      "CONFIG_HTTP_KEY",
+	"interval": "CONFIG_HTTP_INTERVAL",
+	"cache":    "CONFIG_HTTP_CACHE",
+	"format":   "",
+}
+
+// New returns a new HTTP config store
+func New(uri *url.URL) (a.Store, error) {
+	q := uri.Query()
+	opt := func(name string) string {
+		if v := q.Get(name); v != "" {
+			return v
+		}
+		if env := options[name]; env != "" {
+			return os.Getenv(env)
+		}
+		return ""
+	}
+
+	// Headers
+	header := nethttp.Header{}
+	headers := q["header"]
+	if len(headers) == 0 {
+		if env := os.Getenv(options["header"]); env != "" {
+			headers = strings.Split(env, ",")
+		}
+	}
+	for _, h := range headers {
+		k, v, ok := strings.Cut(h, ":")
+		if !ok {
+			return nil, errors.Errorf("invalid config header <%s> (expect Name:Value)", h)
+		}
+		header.Add(strings.TrimSpace(k), strings.TrimSpace(v))
+	}
+	if token := opt("token"); token != "" {
+		header.Set("Authorization", "Bearer "+token)
+	}
+
+	// TLS
+	tlsConfig, err := newTLSConfig(opt("ca"), opt("cert"), opt("key"))
+	if err != nil {
+		return nil, err
+	}
+
+	interval := defaultInterval
+	if s := opt("interval"); s != "" {
+		if interval, err = time.ParseDuration(s); err != nil {
+			return nil, errors.Wrapf(err, "invalid config poll interval <%s>", s)
+		}
+	}
+
+	cache := opt("cache")
+
+	// Build the request URL without the store options
+	u := *uri
+	for name := range options {
+		q.Del(name)
+	}
+	u.RawQuery = q.Encode()
+	if cache == "" {
+		cache = defaultCachePath(u.String())
+	}
+
+	transport := nethttp.DefaultTransport.(*nethttp.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &Store{
+		URL:       u.String(),
+		Header:    header,
+		Interval:  interval,
+		CachePath: cache,
+		Client: &nethttp.Client{
+			Transport: transport,
+			Timeout:   defaultTimeout,
+		},
+	}, nil
+}
+
+// defaultCachePath returns the cache path of rawurl in the user cache
+// directory. It returns an empty path (no cache) when there is no such
+// directory.
+func defaultCachePath(rawurl string) string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	h := sha256.Sum256([]byte(rawurl))
+	return filepath.Join(dir, "spine", "config", hex.EncodeToString(h[:8]))
+}
+
+// checkPrivate returns an error when fi is not owned by the current user, or
+// when it is writable by others
+func checkPrivate(fi os.FileInfo) error {
+	if !ownedByUser(fi) {
+		return errors.Errorf("%s is not owned by the current user", fi.Name())
+	}
+	if fi.Mode().Perm()&0022 != 0 {
+		return errors.Errorf("%s is writable by group or others", fi.Name())
+	}
+	return nil
+}
+
+func newTLSConfig(ca, cert, key string) (*tls.Config, error) {
+	c := &tls.Config{}
+	if ca != "" {
+		pem, err := ioutil.ReadFile(ca)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot read config CA")
+		}
+		c.RootCAs = x509.NewCertPool()
+		if !c.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.Errorf("no certificate found in config CA <%s>", ca)
+		}
+	}
+	if cert != "" || key != "" {
+		pair, err := tls.LoadX509KeyPair(cert, key)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot load config client certificate")
+		}
+		c.Certificates = []tls.Certificate{pair}
+	}
+	return c, nil
+}
+
+// Store reads config from an HTTP(S) endpoint
+type Store struct {
+	URL      string
+	Header   nethttp.Header
+	Client   *nethttp.Client
+	Interval time.Duration
+	// CachePath is the path of the last-known-good copy. There is no copy
+	// when it is empty.
+	CachePath string
+
+	mu   sync.Mutex
+	etag string
+	data []byte
+}
+
+// Load implements Store
+func (s *Store) Load() (io.ReadCloser, error) {
+	_, err := s.fetch(context.Background())
+	if err != nil {
+		data, cerr := s.lastKnownGood()
+		if cerr != nil {
+			return nil, err
+		}
+		return ioutil.NopCloser(bytes.NewReader(data)), nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return ioutil.NopCloser(bytes.NewReader(s.data)), nil
+}
+
+// Watch implements Watcher
+func (s *Store) Watch(ctx context.Context, notify func()) error {
+	t := time.NewTicker(s.Interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-t.C:
+			changed, err := s.fetch(ctx)
+			if err == nil && changed {
+				notify()
+			}
+		}
+	}
+}
+
+// fetch gets the config with a conditional request. It returns whether the
+// config changed since the last fetch.
+func (s *Store) fetch(ctx context.Context) (changed bool, err error) {
+	req, err := nethttp.NewRequestWithContext(ctx, nethttp.MethodGet, s.URL, nil)
+	if err != nil {
+		return false, errors.Wrap(err, "cannot build config request")
+	}
+	for k, v := range s.Header {
+		req.Header[k] = v
+	}
+
+	s.mu.Lock()
+	etag, data := s.etag, s.data
+	s.mu.Unlock()
+	if etag != "" && data != nil {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	res, err := s.Client.Do(req)
+	if err != nil {
+		return false, errors.Wrap(err, "cannot get config")
+	}
+	defer res.Body.Close()
+
+	switch {
+	case res.StatusCode == nethttp.StatusNotModified && data != nil:
+		return false, nil
+	case res.StatusCode != nethttp.StatusOK:
+		return false, fmt.Errorf("cannot get config (status %d)", res.StatusCode)
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return false, errors.Wrap(err, "cannot read config")
+	}
+
+	s.mu.Lock()
+	changed = data != nil && !bytes.Equal(s.data, body)
+	s.etag = res.Header.Get("ETag")
+	s.data = body
+	s.mu.Unlock()
+
+	s.store(body)
+	return changed, nil
+}
+
+// lastKnownGood returns the last config fetched, from memory or else from
+// the disk cache
+func (s *Store) lastKnownGood() ([]byte, error) {
+	s.mu.Lock()
+	data := s.data
+	s.mu.Unlock()
+	if data != nil {
+		return data, nil
+	}
+
+	if s.CachePath == "" {
+		return nil, errors.New("no last-known-good config cache")
+	}
+	f, err := os.Open(s.CachePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if err := checkPrivate(fi); err != nil {
+		return nil, errors.Wrap(err, "refuse last-known-good config cache")
+	}
+	data, err = ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.data = data
+	s.mu.Unlock()
+	return data, nil
+}
+
+// store caches data on disk. The data is written to a new private file,
+// which then replaces the cache atomically, so a partial write never becomes
+// the last-known-good copy. Missing directories are created private.
+func (s *Store) store(data []byte) {
+	if s.CachePath == "" {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(s.CachePath), 0700); err != nil {
+		return
+	}
+	f, err := os.CreateTemp(filepath.Dir(s.CachePath), filepath.Base(s.CachePath)+".*.tmp")
+	if err != nil {
+		return
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), s.CachePath)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+}
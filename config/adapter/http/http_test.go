@@ -0,0 +1,209 @@
+package http_test
+
+import (
+	"context"
+	"io/ioutil"
+	nethttp "net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	confighttp "github.com/deixis/spine/config/adapter/http"
+)
+
+// server is a config service which supports ETags
+type server struct {
+	mu       sync.Mutex
+	data     string
+	etag     string
+	down     bool
+	requests int
+	header   nethttp.Header
+}
+
+func (s *server) set(data, etag string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data, s.etag = data, etag
+}
+
+func (s *server) ServeHTTP(w nethttp.ResponseWriter, r *nethttp.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+	s.header = r.Header.Clone()
+
+	if s.down {
+		w.WriteHeader(nethttp.StatusServiceUnavailable)
+		return
+	}
+	if r.Header.Get("If-None-Match") == s.etag {
+		w.WriteHeader(nethttp.StatusNotModified)
+		return
+	}
+	w.Header().Set("ETag", s.etag)
+	w.Write([]byte(s.data))
+}
+
+func newStore(t *testing.T, rawurl string) *confighttp.Store {
+	uri, err := url.Parse(rawurl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st, err := confighttp.New(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return st.(*confighttp.Store)
+}
+
+func load(t *testing.T, st *confighttp.Store) string {
+	r, err := st.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestNew(t *testing.T) {
+	t.Setenv("CONFIG_HTTP_HEADERS", "X-Env:1")
+	st := newStore(t, "https://localhost/app.toml?token=123&header=X-Team:core&env=prod&interval=1m")
+
+	if st.URL != "https://localhost/app.toml?env=prod" {
+		t.Errorf("expect store options to be removed from URL, but got %s", st.URL)
+	}
+	if st.Header.Get("Authorization") != "Bearer 123" {
+		t.Errorf("expect bearer token, but got %s", st.Header.Get("Authorization"))
+	}
+	if st.Header.Get("X-Team") != "core" || st.Header.Get("X-Env") != "" {
+		t.Errorf("expect query headers to take precedence, but got %v", st.Header)
+	}
+	if st.Interval != time.Minute {
+		t.Errorf("expect interval 1m, but got %s", st.Interval)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	srv := &server{data: "a = 1", etag: `"1"`}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	cache := filepath.Join(t.TempDir(), "cache")
+	st := newStore(t, ts.URL+"/app.toml?token=123&cache="+cache)
+
+	if data := load(t, st); data != "a = 1" {
+		t.Errorf("expect config a = 1, but got %s", data)
+	}
+	if srv.header.Get("Authorization") != "Bearer 123" {
+		t.Errorf("expect auth header, but got %v", srv.header)
+	}
+
+	// Not modified
+	if data := load(t, st); data != "a = 1" {
+		t.Errorf("expect config a = 1, but got %s", data)
+	}
+	if srv.header.Get("If-None-Match") != `"1"` {
+		t.Errorf("expect conditional request, but got %v", srv.header)
+	}
+
+	// Last-known-good copy is used by a new store when the service is down
+	srv.mu.Lock()
+	srv.down = true
+	srv.mu.Unlock()
+	st = newStore(t, ts.URL+"/app.toml?cache="+cache)
+	if data := load(t, st); data != "a = 1" {
+		t.Errorf("expect last-known-good config a = 1, but got %s", data)
+	}
+
+	// Without a cache
+	st = newStore(t, ts.URL+"/app.toml?cache="+cache+".missing")
+	if _, err := st.Load(); err == nil {
+		t.Error("expect error without a last-known-good copy")
+	}
+}
+
+func TestCachePath(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", dir)
+	t.Setenv("HOME", dir)
+	userDir, err := os.UserCacheDir()
+	if err != nil {
+		t.Skip("no user cache directory", err)
+	}
+
+	srv := &server{data: "a = 1", etag: `"1"`}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	st := newStore(t, ts.URL+"/app.toml")
+	if filepath.Dir(st.CachePath) != filepath.Join(userDir, "spine", "config") {
+		t.Errorf("expect cache in user cache directory, but got %s", st.CachePath)
+	}
+	load(t, st)
+	fi, err := os.Stat(filepath.Dir(st.CachePath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0700 {
+		t.Errorf("expect private cache directory, but got %s", fi.Mode())
+	}
+}
+
+func TestCacheRefused(t *testing.T) {
+	srv := &server{down: true}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	// A cache which can be written by others cannot be trusted
+	cache := filepath.Join(t.TempDir(), "cache")
+	if err := os.WriteFile(cache, []byte("a = 1"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(cache, 0666); err != nil {
+		t.Fatal(err)
+	}
+	st := newStore(t, ts.URL+"/app.toml?cache="+cache)
+	if _, err := st.Load(); err == nil {
+		t.Error("expect writable cache to be refused")
+	}
+}
+
+func TestWatch(t *testing.T) {
+	srv := &server{data: "a = 1", etag: `"1"`}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	cache := filepath.Join(t.TempDir(), "cache")
+	st := newStore(t, ts.URL+"/app.toml?interval=10ms&cache="+cache)
+	load(t, st)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	notified := make(chan struct{}, 10)
+	go st.Watch(ctx, func() { notified <- struct{}{} })
+
+	select {
+	case <-notified:
+		t.Fatal("expect no notification without a change")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	srv.set("a = 2", `"2"`)
+	select {
+	case <-notified:
+	case <-time.After(time.Second):
+		t.Fatal("expect notification after a change")
+	}
+	if data := load(t, st); data != "a = 2" {
+		t.Errorf("expect config a = 2, but got %s", data)
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package http
+
+import "os"
+
+// ownedByUser returns true, because files have no owner uid on this platform
+func ownedByUser(fi os.FileInfo) bool {
+	return true
+}
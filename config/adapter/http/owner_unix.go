@@ -0,0 +1,14 @@
+//go:build unix
+
+package http
+
+import (
+	"os"
+	"syscall"
+)
+
+// ownedByUser returns whether fi is owned by the current user
+func ownedByUser(fi os.FileInfo) bool {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	return ok && int(st.Uid) == os.Getuid()
+}
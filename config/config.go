@@ -11,9 +11,10 @@ import (
 
 // Config defines the app config
 type Config struct {
-	Node    string  `toml:"node"`
-	Version string  `toml:"version"`
-	Request Request `toml:"request"`
+	Node     string   `toml:"node"`
+	Version  string   `toml:"version"`
+	Request  Request  `toml:"request"`
+	Shutdown Shutdown `toml:"shutdown"`
 }
 
 // Request defines the request default configuration
@@ -23,6 +24,23 @@ type Request struct {
 	Panic        bool          `toml:"panic"`
 }
 
+// Shutdown defines the graceful shutdown budget. When a phase runs out of
+// time, the app escalates to close.
+type Shutdown struct {
+	// Timeout is the overall shutdown budget
+	Timeout time.Duration `toml:"timeout" default:"30s"`
+	// Servers is the time given to servers to drain in-flight requests
+	Servers time.Duration `toml:"servers" default:"15s"`
+	// Jobs is the time given to schedule, stream, pubsub and background jobs
+	// to stop
+	Jobs time.Duration `toml:"jobs" default:"10s"`
+	// Components is the time given to components to stop
+	Components time.Duration `toml:"components" default:"5s"`
+	// Restart is the time given to a restarted process to become ready before
+	// this process drains (SIGUSR2)
+	Restart time.Duration `toml:"restart" default:"1m"`
+}
+
 // Timeout returns the TimeoutMS field in time.Duration
 func (r *Request) Timeout() time.Duration {
 	return time.Millisecond * r.TimeoutMS
@@ -1,2 +1,20 @@
 // Package config implements logic to load dynamic configuration from various sources
+//
+// CONFIG_URI may contain a comma-separated list of sources, which are merged
+// in order. Environment variables prefixed with SPINE_ override individual
+// keys, with levels separated by a double underscore.
+//
+// e.g.
+// CONFIG_URI=file:///etc/app/base.toml,consul://localhost/app SPINE_LOG__LEVEL=trace
+//
+// Tree.Unmarshal applies `default` struct tags and checks `validate` struct
+// tags (see Validate).
+//
+// Values may be encrypted with the form enc:v1:<base64>. They are decrypted at
+// load time with the keys given by CONFIG_KEYS or CONFIG_KEYS_FILE, and
+// redacted from Tree.String(). The spine-config command encrypts and rotates
+// values of a config file.
+//
+// e.g.
+// password = "enc:v1:AAAAAQWnU07o..."
 package config
@@ -31,6 +31,12 @@ func ValuesOf(v interface{}) interface{} {
 			r[i] = ValuesOf(v[i])
 		}
 		return r
+	case []string:
+		r := make([]string, len(v))
+		for i := range v {
+			r[i] = ValueOf(v[i])
+		}
+		return r
 	}
 	return v
 }
@@ -0,0 +1,143 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	toml "github.com/pelletier/go-toml"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Format is a configuration file format
+type Format string
+
+const (
+	// FormatTOML is the default configuration format
+	FormatTOML Format = "toml"
+	// FormatYAML is the YAML configuration format
+	FormatYAML Format = "yaml"
+	// FormatJSON is the JSON configuration format
+	FormatJSON Format = "json"
+)
+
+// FormatOf returns the format of the configuration at uri. The format is
+// either given with the `format` query parameter (e.g. ?format=yaml), or
+// inferred from the path extension. It returns an empty format when it cannot
+// be determined.
+func FormatOf(uri *url.URL) Format {
+	if f := uri.Query().Get("format"); f != "" {
+		return parseFormat(f)
+	}
+	return parseFormat(strings.TrimPrefix(path.Ext(uri.Path), "."))
+}
+
+func parseFormat(s string) Format {
+	switch strings.ToLower(s) {
+	case "toml":
+		return FormatTOML
+	case "yaml", "yml":
+		return FormatYAML
+	case "json":
+		return FormatJSON
+	}
+	return ""
+}
+
+// sniffFormat guesses the format of data from its content
+func sniffFormat(data []byte) Format {
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, "{"):
+			return FormatJSON
+		case line == "---":
+			// YAML document start
+			return FormatYAML
+		case strings.HasPrefix(line, "["):
+			// TOML table
+			return FormatTOML
+		}
+		eq := strings.Index(line, "=")
+		colon := strings.Index(line, ":")
+		if eq >= 0 && (colon < 0 || eq < colon) {
+			return FormatTOML
+		}
+		return FormatYAML
+	}
+	return FormatTOML
+}
+
+// parse parses data in the given format into a TOML tree
+func parse(data []byte, f Format) (*toml.Tree, error) {
+	switch f {
+	case FormatTOML:
+		return toml.LoadBytes(data)
+	case FormatYAML:
+		var m map[string]interface{}
+		if err := yaml.Unmarshal(data, &m); err != nil {
+			return nil, err
+		}
+		return toml.TreeFromMap(normalise(m).(map[string]interface{}))
+	case FormatJSON:
+		var m map[string]interface{}
+		d := json.NewDecoder(bytes.NewReader(data))
+		d.UseNumber()
+		if err := d.Decode(&m); err != nil {
+			return nil, err
+		}
+		return toml.TreeFromMap(normalise(m).(map[string]interface{}))
+	}
+	return nil, errors.Errorf("unsupported config format <%s>", f)
+}
+
+// normalise converts decoded YAML and JSON values to values supported by
+// TOML trees
+func normalise(v interface{}) interface{} {
+	switch v := v.(type) {
+	case nil:
+		return map[string]interface{}{}
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			// TOML does not have null values
+			if e != nil {
+				m[k] = normalise(e)
+			}
+		}
+		return m
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			if e != nil {
+				m[fmt.Sprint(k)] = normalise(e)
+			}
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, 0, len(v))
+		for _, e := range v {
+			if e != nil {
+				l = append(l, normalise(e))
+			}
+		}
+		return l
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	}
+	return v
+}
@@ -0,0 +1,133 @@
+package config_test
+
+import (
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/deixis/spine/config"
+)
+
+type formatConfig struct {
+	App struct {
+		Name  string   `toml:"name"`
+		Port  int      `toml:"port"`
+		Ratio float64  `toml:"ratio"`
+		Debug bool     `toml:"debug"`
+		Tags  []string `toml:"tags"`
+	} `toml:"app"`
+	Servers []struct {
+		Addr string `toml:"addr"`
+	} `toml:"servers"`
+}
+
+func TestLoadTreeFormats(t *testing.T) {
+	os.Setenv("SPINE_TEST_CONFIG_FORMAT", "yay")
+
+	inputs := map[string]string{
+		"toml": `
+# comment
+[app]
+name = "$SPINE_TEST_CONFIG_FORMAT"
+port = 8080
+ratio = 0.5
+debug = true
+tags = ["a", "$SPINE_TEST_CONFIG_FORMAT"]
+
+[[servers]]
+addr = "127.0.0.1:1"
+[[servers]]
+addr = "127.0.0.1:2"
+`,
+		"yaml": `
+# comment
+app:
+  name: $SPINE_TEST_CONFIG_FORMAT
+  port: 8080
+  ratio: 0.5
+  debug: true
+  tags: [a, $SPINE_TEST_CONFIG_FORMAT]
+  nothing:
+servers:
+  - addr: 127.0.0.1:1
+  - addr: 127.0.0.1:2
+`,
+		"json": `{
+  "app": {
+    "name": "$SPINE_TEST_CONFIG_FORMAT",
+    "port": 8080,
+    "ratio": 0.5,
+    "debug": true,
+    "tags": ["a", "$SPINE_TEST_CONFIG_FORMAT"],
+    "nothing": null
+  },
+  "servers": [{"addr": "127.0.0.1:1"}, {"addr": "127.0.0.1:2"}]
+}`,
+	}
+
+	var expect formatConfig
+	expect.App.Name = "yay"
+	expect.App.Port = 8080
+	expect.App.Ratio = 0.5
+	expect.App.Debug = true
+	expect.App.Tags = []string{"a", "yay"}
+	expect.Servers = append(expect.Servers,
+		struct {
+			Addr string `toml:"addr"`
+		}{"127.0.0.1:1"},
+		struct {
+			Addr string `toml:"addr"`
+		}{"127.0.0.1:2"},
+	)
+
+	for format, in := range inputs {
+		// Sniffed and explicit formats
+		opts := [][]config.LoadOption{
+			nil,
+			{config.WithFormat(config.Format(format))},
+		}
+		for _, o := range opts {
+			tree, err := config.LoadTree(strings.NewReader(in), o...)
+			if err != nil {
+				t.Fatalf("%s: %s", format, err)
+			}
+			var got formatConfig
+			if err := tree.Unmarshal(&got); err != nil {
+				t.Fatalf("%s: %s", format, err)
+			}
+			if !reflect.DeepEqual(expect, got) {
+				t.Errorf("%s: expect to get %+v, but got %+v", format, expect, got)
+			}
+			if !tree.Has("app") {
+				t.Errorf("%s: expect tree to have app", format)
+			}
+		}
+	}
+}
+
+func TestFormatOf(t *testing.T) {
+	tests := []struct {
+		in  string
+		out config.Format
+	}{
+		{in: "file:///etc/spine/config.toml", out: config.FormatTOML},
+		{in: "file:///etc/spine/config.yaml", out: config.FormatYAML},
+		{in: "file:///etc/spine/config.yml", out: config.FormatYAML},
+		{in: "consul://localhost/config/spine.json", out: config.FormatJSON},
+		{in: "consul://localhost/config/spine?format=yaml", out: config.FormatYAML},
+		{in: "file:///etc/spine/config.json?format=toml", out: config.FormatTOML},
+		{in: "file:///etc/spine/config", out: ""},
+	}
+
+	for _, test := range tests {
+		uri, err := url.Parse(test.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f := config.FormatOf(uri); f != test.out {
+			t.Errorf("expect to get format %s for %s, but got %s", test.out, test.in, f)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package config
+
+import (
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	toml "github.com/pelletier/go-toml"
+	"github.com/pkg/errors"
+)
+
+// EnvPrefix is the prefix of the environment variables which override config
+// keys. Levels are separated with a double underscore.
+//
+// e.g. SPINE_LOG__LEVEL=trace overrides the key log.level
+const EnvPrefix = "SPINE_"
+
+// EnvLayerName is the name of the layer made of environment variables
+const EnvLayerName = "env"
+
+// Layer is a named configuration tree
+type Layer struct {
+	Name string
+	Tree Tree
+}
+
+// LayeredTree is a configuration tree made of several layers merged together
+type LayeredTree struct {
+	tree
+
+	// origins contains the layer name of each leaf key (full dotted path)
+	origins map[string]string
+}
+
+// Merge merges layers into a single tree. Keys of a layer override the keys
+// of the previous layers, so the last layer has the highest precedence.
+// Tables are merged key by key, whereas values and arrays are replaced.
+func Merge(layers ...Layer) (*LayeredTree, error) {
+	dst, err := toml.TreeFromMap(map[string]interface{}{})
+	if err != nil {
+		return nil, err
+	}
+	t := &LayeredTree{
+		tree:    tree{t: dst, secrets: map[string]struct{}{}},
+		origins: map[string]string{},
+	}
+	for _, l := range layers {
+		src := tomlTree(l.Tree)
+		if src == nil {
+			continue
+		}
+		if err := t.merge(src, nil, l.Name, secretsOf(l.Tree)); err != nil {
+			return nil, errors.Wrapf(err, "cannot merge config layer <%s>", l.Name)
+		}
+	}
+	return t, nil
+}
+
+func (t *LayeredTree) merge(
+	src *toml.Tree, path []string, layer string, secrets map[string]struct{},
+) error {
+	for _, key := range src.Keys() {
+		p := append(append([]string{}, path...), key)
+		v := src.GetPath([]string{key})
+
+		if sub, ok := v.(*toml.Tree); ok {
+			if _, ok := t.t.GetPath(p).(*toml.Tree); !ok {
+				t.remove(p)
+				empty, err := toml.TreeFromMap(map[string]interface{}{})
+				if err != nil {
+					return err
+				}
+				t.t.SetPath(p, empty)
+			}
+			if err := t.merge(sub, p, layer, secrets); err != nil {
+				return err
+			}
+			continue
+		}
+
+		t.remove(p)
+		t.t.SetPath(p, v)
+		key := strings.Join(p, ".")
+		t.origins[key] = layer
+		for k := range secrets {
+			if isSubKey(k, key) {
+				t.secrets[k] = struct{}{}
+			}
+		}
+	}
+	return nil
+}
+
+// remove removes the value or table at path p
+func (t *LayeredTree) remove(p []string) {
+	if !t.t.HasPath(p) {
+		return
+	}
+	t.t.DeletePath(p)
+
+	key := strings.Join(p, ".")
+	for k := range t.origins {
+		if isSubKey(k, key) {
+			delete(t.origins, k)
+		}
+	}
+	for k := range t.secrets {
+		if isSubKey(k, key) {
+			delete(t.secrets, k)
+		}
+	}
+}
+
+// Get returns the subtree at key
+func (t *LayeredTree) Get(key string) Tree {
+	child, ok := t.t.Get(key).(*toml.Tree)
+	if !ok {
+		return &nopTree{path: childPath(t.path, key)}
+	}
+	return &LayeredTree{
+		tree:    tree{t: child, path: childPath(t.path, key), secrets: t.secrets},
+		origins: t.origins,
+	}
+}
+
+// Origin returns the name of the layer which defines the value at key. Key
+// is a dotted path relative to this tree (e.g. log.level).
+func (t *LayeredTree) Origin(key string) (string, bool) {
+	layer, ok := t.origins[strings.Join(childPath(t.path, key), ".")]
+	return layer, ok
+}
+
+// Origins returns the name of the layer which defines each value of the tree.
+// Keys are dotted paths relative to this tree.
+func (t *LayeredTree) Origins() map[string]string {
+	prefix := ""
+	if len(t.path) > 0 {
+		prefix = strings.Join(t.path, ".") + "."
+	}
+
+	m := map[string]string{}
+	for k, layer := range t.origins {
+		if strings.HasPrefix(k, prefix) {
+			m[strings.TrimPrefix(k, prefix)] = layer
+		}
+	}
+	return m
+}
+
+// EnvLayer returns a layer made of the environment variables starting with
+// prefix. Values are converted to the type of the same key in base, so an
+// integer stays an integer. Arrays are given as comma-separated values.
+func EnvLayer(prefix string, base Tree) (Layer, error) {
+	bt := tomlTree(base)
+
+	var names []string
+	for _, env := range os.Environ() {
+		if strings.HasPrefix(env, prefix) {
+			names = append(names, env[:strings.Index(env, "=")])
+		}
+	}
+	sort.Strings(names)
+
+	t, err := toml.TreeFromMap(map[string]interface{}{})
+	if err != nil {
+		return Layer{}, err
+	}
+	for _, name := range names {
+		var p []string
+		for _, k := range strings.Split(strings.ToLower(name[len(prefix):]), "__") {
+			if k != "" {
+				p = append(p, k)
+			}
+		}
+		if len(p) == 0 {
+			continue
+		}
+
+		var current interface{}
+		if bt != nil {
+			current = bt.GetPath(p)
+		}
+		v, err := envValue(os.Getenv(name), current)
+		if err != nil {
+			return Layer{}, errors.Wrapf(err, "invalid value for %s", name)
+		}
+		t.SetPath(p, v)
+	}
+	return Layer{Name: EnvLayerName, Tree: &tree{t: t}}, nil
+}
+
+// envValue converts s to the type of current
+func envValue(s string, current interface{}) (interface{}, error) {
+	switch current.(type) {
+	case int64:
+		return strconv.ParseInt(s, 10, 64)
+	case uint64:
+		return strconv.ParseUint(s, 10, 64)
+	case float64:
+		return strconv.ParseFloat(s, 64)
+	case bool:
+		return strconv.ParseBool(s)
+	case []interface{}, []string:
+		var l []interface{}
+		for _, e := range strings.Split(s, ",") {
+			l = append(l, strings.TrimSpace(e))
+		}
+		return l, nil
+	}
+	return s, nil
+}
+
+// secretsOf returns the key paths of the decrypted values of t
+func secretsOf(t Tree) map[string]struct{} {
+	switch t := t.(type) {
+	case *tree:
+		return t.secrets
+	case *LayeredTree:
+		return t.secrets
+	}
+	return nil
+}
+
+// tomlTree returns the TOML tree backing t, or nil when t is empty
+func tomlTree(t Tree) *toml.Tree {
+	switch t := t.(type) {
+	case *tree:
+		return t.t
+	case *LayeredTree:
+		return t.t
+	}
+	return nil
+}
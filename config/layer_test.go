@@ -0,0 +1,192 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/deixis/spine/config"
+)
+
+func TestMerge(t *testing.T) {
+	base := mustLoadTree(t, `
+[log]
+level = "trace"
+[log.printer.stdout]
+[app]
+name = "base"
+port = 80
+tags = ["a", "b"]
+`)
+	prod := mustLoadTree(t, `
+[log]
+level = "warning"
+[app]
+port = 443
+tags = ["c"]
+`)
+
+	tree, err := config.Merge(
+		config.Layer{Name: "base", Tree: base},
+		config.Layer{Name: "prod", Tree: prod},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var c struct {
+		Log struct {
+			Level string `toml:"level"`
+		} `toml:"log"`
+		App struct {
+			Name string   `toml:"name"`
+			Port int      `toml:"port"`
+			Tags []string `toml:"tags"`
+		} `toml:"app"`
+	}
+	if err := tree.Unmarshal(&c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Log.Level != "warning" || c.App.Name != "base" || c.App.Port != 443 {
+		t.Errorf("unexpected merged config %+v", c)
+	}
+	if !reflect.DeepEqual(c.App.Tags, []string{"c"}) {
+		t.Errorf("expect arrays to be replaced, but got %v", c.App.Tags)
+	}
+	if !tree.Get("log").Has("printer") {
+		t.Error("expect tables to be merged")
+	}
+
+	expect := map[string]string{
+		"log.level": "prod",
+		"app.name":  "base",
+		"app.port":  "prod",
+		"app.tags":  "prod",
+	}
+	if got := tree.Origins(); !reflect.DeepEqual(expect, got) {
+		t.Errorf("expect origins %v, but got %v", expect, got)
+	}
+	if layer, ok := tree.Origin("app.name"); !ok || layer != "base" {
+		t.Errorf("expect app.name to come from base, but got %s", layer)
+	}
+	if layer, ok := tree.Get("app").(*config.LayeredTree).Origin("port"); !ok || layer != "prod" {
+		t.Errorf("expect app.port to come from prod, but got %s", layer)
+	}
+	if _, ok := tree.Origin("app.missing"); ok {
+		t.Error("expect missing key not to have an origin")
+	}
+}
+
+func TestEnvLayer(t *testing.T) {
+	base := mustLoadTree(t, `
+[log]
+level = "trace"
+[app]
+port = 80
+ratio = 0.5
+debug = false
+tags = ["a"]
+`)
+	env := map[string]string{
+		"SPINE_TEST__LOG__LEVEL":   "warning",
+		"SPINE_TEST__APP__PORT":    "443",
+		"SPINE_TEST__APP__RATIO":   "0.75",
+		"SPINE_TEST__APP__DEBUG":   "true",
+		"SPINE_TEST__APP__TAGS":    "b, c",
+		"SPINE_TEST__APP__NEW_KEY": "new",
+	}
+	for k, v := range env {
+		t.Setenv(k, v)
+	}
+
+	// Use a custom prefix, so only the variables of this test apply
+	layer, err := config.EnvLayer("SPINE_TEST__", base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if layer.Name != config.EnvLayerName {
+		t.Errorf("expect layer name %s, but got %s", config.EnvLayerName, layer.Name)
+	}
+	tree, err := config.Merge(config.Layer{Name: "base", Tree: base}, layer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var c struct {
+		Log struct {
+			Level string `toml:"level"`
+		} `toml:"log"`
+		App struct {
+			Port   int      `toml:"port"`
+			Ratio  float64  `toml:"ratio"`
+			Debug  bool     `toml:"debug"`
+			Tags   []string `toml:"tags"`
+			NewKey string   `toml:"new_key"`
+		} `toml:"app"`
+	}
+	if err := tree.Unmarshal(&c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Log.Level != "warning" || c.App.Port != 443 || c.App.Ratio != 0.75 ||
+		!c.App.Debug || c.App.NewKey != "new" {
+		t.Errorf("unexpected config %+v", c)
+	}
+	if !reflect.DeepEqual(c.App.Tags, []string{"b", "c"}) {
+		t.Errorf("expect to get tags [b c], but got %v", c.App.Tags)
+	}
+	if layer, _ := tree.Origin("log.level"); layer != config.EnvLayerName {
+		t.Errorf("expect log.level to come from env, but got %s", layer)
+	}
+
+	t.Setenv("SPINE_TEST__APP__PORT", "not a number")
+	if _, err := config.EnvLayer("SPINE_TEST__", base); err == nil {
+		t.Error("expect invalid value to return an error")
+	}
+}
+
+func TestLoadSources(t *testing.T) {
+	dir := t.TempDir()
+	basePath := filepath.Join(dir, "base.toml")
+	prodPath := filepath.Join(dir, "prod.yaml")
+	if err := os.WriteFile(basePath, []byte("[app]\nname = \"base\"\nport = 80\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(prodPath, []byte("app:\n  port: 443\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	sources, err := config.NewSources("file://" + basePath + ",file://" + prodPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := config.LoadSources(sources)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var c struct {
+		App struct {
+			Name string `toml:"name"`
+			Port int    `toml:"port"`
+		} `toml:"app"`
+	}
+	if err := tree.Unmarshal(&c); err != nil {
+		t.Fatal(err)
+	}
+	if c.App.Name != "base" || c.App.Port != 443 {
+		t.Errorf("unexpected config %+v", c)
+	}
+	if layer, _ := tree.Origin("app.port"); layer != "file://"+prodPath {
+		t.Errorf("expect app.port to come from %s, but got %s", prodPath, layer)
+	}
+}
+
+func mustLoadTree(t *testing.T, s string) config.Tree {
+	tree, err := config.LoadTree(strings.NewReader(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tree
+}
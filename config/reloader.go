@@ -0,0 +1,129 @@
+package config
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/deixis/spine/contextutil"
+)
+
+// Reloader holds the latest version of a configuration tree and notifies
+// subscribers when it changes
+type Reloader struct {
+	mu sync.RWMutex
+
+	tree Tree
+	subs map[*subscription]struct{}
+}
+
+type subscription struct {
+	key string
+	f   func(Tree)
+}
+
+// NewReloader returns a new Reloader for t
+func NewReloader(t Tree) *Reloader {
+	return &Reloader{
+		tree: t,
+		subs: map[*subscription]struct{}{},
+	}
+}
+
+// Tree returns the latest configuration tree
+func (r *Reloader) Tree() Tree {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.tree
+}
+
+// Subscribe calls f with the new subtree at key each time it changes. An
+// empty key subscribes to the whole tree. It returns a function to cancel the
+// subscription.
+func (r *Reloader) Subscribe(key string, f func(Tree)) (cancel func()) {
+	s := &subscription{key: key, f: f}
+
+	r.mu.Lock()
+	r.subs[s] = struct{}{}
+	r.mu.Unlock()
+
+	return func() {
+		r.mu.Lock()
+		delete(r.subs, s)
+		r.mu.Unlock()
+	}
+}
+
+// Reload loads a new configuration tree from rd and notifies the subscribers
+// of the subtrees that changed. The current tree is kept when rd cannot be
+// loaded.
+func (r *Reloader) Reload(rd io.Reader, o ...LoadOption) error {
+	t, err := LoadTree(rd, o...)
+	if err != nil {
+		return err
+	}
+	r.Set(t)
+	return nil
+}
+
+// Set replaces the configuration tree with t and notifies the subscribers of
+// the subtrees that changed
+func (r *Reloader) Set(t Tree) {
+	r.mu.Lock()
+	old := r.tree
+	r.tree = t
+	var notify []*subscription
+	for s := range r.subs {
+		if rawString(subtree(old, s.key)) != rawString(subtree(t, s.key)) {
+			notify = append(notify, s)
+		}
+	}
+	r.mu.Unlock()
+
+	for _, s := range notify {
+		s.f(subtree(t, s.key))
+	}
+}
+
+// rawString returns t as a string without redacting secrets, so a change of
+// secret is noticed
+func rawString(t Tree) string {
+	if tt := tomlTree(t); tt != nil {
+		s, _ := tt.ToTomlString()
+		return s
+	}
+	return t.String()
+}
+
+func subtree(t Tree, key string) Tree {
+	if key == "" {
+		return t
+	}
+	return t.Get(key)
+}
+
+// Subscribe calls `Subscribe` on the context `Reloader`
+func Subscribe(ctx context.Context, key string, f func(Tree)) (cancel func()) {
+	return ReloaderFromContext(ctx).Subscribe(key, f)
+}
+
+type reloaderContextKey struct{}
+
+var activeReloaderContextKey = reloaderContextKey{}
+
+// ReloaderFromContext returns a `Reloader` instance associated with `ctx`, or
+// a `Reloader` of the context `Tree` which never reloads if no `Reloader`
+// instance could be found.
+func ReloaderFromContext(ctx contextutil.ValueContext) *Reloader {
+	val := ctx.Value(activeReloaderContextKey)
+	if o, ok := val.(*Reloader); ok {
+		return o
+	}
+	return NewReloader(TreeFromContext(ctx))
+}
+
+// ReloaderWithContext returns a copy of parent in which the `Reloader` is
+// stored
+func ReloaderWithContext(ctx context.Context, r *Reloader) context.Context {
+	return context.WithValue(ctx, activeReloaderContextKey, r)
+}
@@ -0,0 +1,75 @@
+package config_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/deixis/spine/config"
+)
+
+// TestReloaderSubscribe ensures that subscribers are only notified when their
+// subtree changes
+func TestReloaderSubscribe(t *testing.T) {
+	tree, err := config.LoadTree(strings.NewReader(`
+[log]
+level = "trace"
+[app]
+foo = "bar"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := config.NewReloader(tree)
+
+	var logs, apps []config.Tree
+	r.Subscribe("log", func(t config.Tree) { logs = append(logs, t) })
+	cancel := r.Subscribe("app", func(t config.Tree) { apps = append(apps, t) })
+
+	err = r.Reload(strings.NewReader(`
+[log]
+level = "warning"
+[app]
+foo = "bar"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 1 {
+		t.Fatalf("expect log subscriber to be notified once, but got %d", len(logs))
+	}
+	if len(apps) != 0 {
+		t.Errorf("expect app subscriber not to be notified, but got %d", len(apps))
+	}
+	var lc struct {
+		Level string `toml:"level"`
+	}
+	if err := logs[0].Unmarshal(&lc); err != nil {
+		t.Fatal(err)
+	}
+	if lc.Level != "warning" {
+		t.Errorf("expect to get level warning, but got %s", lc.Level)
+	}
+	if !r.Tree().Has("app") {
+		t.Error("expect tree to be replaced")
+	}
+
+	// Invalid configs are ignored
+	if err := r.Reload(strings.NewReader(`[app`)); err == nil {
+		t.Error("expect to get an error")
+	}
+
+	cancel()
+	err = r.Reload(strings.NewReader(`
+[app]
+foo = "baz"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(apps) != 0 {
+		t.Errorf("expect cancelled subscriber not to be notified, but got %d", len(apps))
+	}
+	if len(logs) != 2 {
+		t.Errorf("expect log subscriber to be notified when log is removed, but got %d", len(logs))
+	}
+}
@@ -0,0 +1,338 @@
+package config
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/deixis/spine/crypto"
+	toml "github.com/pelletier/go-toml"
+	"github.com/pkg/errors"
+)
+
+const (
+	// SecretPrefix is the prefix of encrypted config values
+	//
+	// e.g. password = "enc:v1:AAAAAdJ2..."
+	SecretPrefix = "enc:v1:"
+	// Redacted replaces decrypted values when a tree is printed
+	Redacted = "<redacted>"
+
+	// KeysEnv is the environment variable which contains the secret keys
+	KeysEnv = "CONFIG_KEYS"
+	// KeysFileEnv is the environment variable which contains the path to a
+	// file with the secret keys
+	KeysFileEnv = "CONFIG_KEYS_FILE"
+)
+
+// ErrNoKeys occurs when an encrypted value is found, but no secret keys are
+// configured
+var ErrNoKeys = errors.New("no config secret keys (set " + KeysEnv + " or " + KeysFileEnv + ")")
+
+var secretRegexp = regexp.MustCompile(regexp.QuoteMeta(SecretPrefix) + `[A-Za-z0-9+/=_-]+`)
+
+// ParseKeys parses secret keys given as `id:base64-key` pairs separated by
+// commas or new lines. Empty lines and lines starting with # are ignored.
+// The key with the highest ID encrypts new values, so a key is rotated by
+// adding a key with a higher ID.
+//
+// e.g. 1:aGVsbG8...,2:d29ybGQ...
+func ParseKeys(s string) (*crypto.Rotor, error) {
+	keys := map[uint32][]byte{}
+	var last uint32
+	for _, line := range strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == '\n'
+	}) {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		id, key, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, errors.New("invalid secret key format (expect id:base64-key)")
+		}
+		n, err := strconv.ParseUint(strings.TrimSpace(id), 10, 32)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid secret key ID <%s>", id)
+		}
+		k, err := base64.StdEncoding.DecodeString(strings.TrimSpace(key))
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid secret key <%d>", n)
+		}
+		if len(k) < crypto.CKeySize {
+			return nil, errors.Errorf("secret key <%d> must be at least %d bytes", n, crypto.CKeySize)
+		}
+		keys[uint32(n)] = k
+		if uint32(n) > last {
+			last = uint32(n)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, ErrNoKeys
+	}
+	return crypto.NewRotor(keys, last), nil
+}
+
+// KeysFromEnv returns the secret keys given by KeysEnv, or else in the file
+// given by KeysFileEnv. It returns ErrNoKeys when none of them is set.
+func KeysFromEnv() (*crypto.Rotor, error) {
+	if s := os.Getenv(KeysEnv); s != "" {
+		return ParseKeys(s)
+	}
+	if path := os.Getenv(KeysFileEnv); path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, errors.Wrap(err, "error reading config secret keys")
+		}
+		return ParseKeys(string(data))
+	}
+	return nil, ErrNoKeys
+}
+
+// IsSecret returns whether s is an encrypted value
+func IsSecret(s string) bool {
+	return strings.HasPrefix(s, SecretPrefix)
+}
+
+// EncryptValue encrypts s with the default key of r
+func EncryptValue(r *crypto.Rotor, s string) (string, error) {
+	data, err := r.Encrypt([]byte(s))
+	if err != nil {
+		return "", err
+	}
+	return SecretPrefix + base64.StdEncoding.EncodeToString(data), nil
+}
+
+// DecryptValue decrypts a value encrypted with EncryptValue
+func DecryptValue(r *crypto.Rotor, s string) (string, error) {
+	if !IsSecret(s) {
+		return "", errors.New("not an encrypted value")
+	}
+	data, err := base64.StdEncoding.DecodeString(s[len(SecretPrefix):])
+	if err != nil {
+		return "", crypto.ErrDecrypt
+	}
+	data, err = r.Decrypt(data)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// RotateSecrets re-encrypts all encrypted values found in data with the
+// default key of r. The rest of data is left untouched, so it works with all
+// formats. It returns the number of values rotated.
+func RotateSecrets(data []byte, r *crypto.Rotor) ([]byte, int, error) {
+	var n int
+	var err error
+	out := secretRegexp.ReplaceAllFunc(data, func(b []byte) []byte {
+		if err != nil {
+			return b
+		}
+		var plain, enc string
+		plain, err = DecryptValue(r, string(b))
+		if err != nil {
+			return b
+		}
+		enc, err = EncryptValue(r, plain)
+		if err != nil {
+			return b
+		}
+		n++
+		return []byte(enc)
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return out, n, nil
+}
+
+// EncryptTOMLKeys encrypts in place the string values of the given dotted
+// keys in a TOML document. Comments and formatting are preserved. Values
+// already encrypted are left untouched.
+func EncryptTOMLKeys(data []byte, r *crypto.Rotor, keys ...string) ([]byte, error) {
+	t, err := toml.LoadBytes(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "error loading toml config")
+	}
+
+	lines := bytes.Split(data, []byte("\n"))
+	for _, key := range keys {
+		s, ok := t.Get(key).(string)
+		if !ok {
+			return nil, errors.Errorf("key <%s> is not a string value", key)
+		}
+		if IsSecret(s) {
+			continue
+		}
+		enc, err := EncryptValue(r, s)
+		if err != nil {
+			return nil, err
+		}
+
+		pos := t.GetPosition(key)
+		if pos.Line < 1 || pos.Line > len(lines) {
+			return nil, errors.Errorf("cannot locate key <%s>", key)
+		}
+		line, err := replaceTOMLString(lines[pos.Line-1], strconv.Quote(enc))
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot encrypt key <%s>", key)
+		}
+		lines[pos.Line-1] = line
+	}
+	return bytes.Join(lines, []byte("\n")), nil
+}
+
+// replaceTOMLString replaces the single-line string value of a `key = value`
+// line with s
+func replaceTOMLString(line []byte, s string) ([]byte, error) {
+	eq := bytes.IndexByte(line, '=')
+	if eq < 0 {
+		return nil, errors.New("not a key/value line")
+	}
+	start := eq + 1
+	for start < len(line) && (line[start] == ' ' || line[start] == '\t') {
+		start++
+	}
+	if start == len(line) || (line[start] != '"' && line[start] != '\'') {
+		return nil, errors.New("not a string value")
+	}
+	quote := line[start]
+	if bytes.HasPrefix(line[start:], []byte{quote, quote, quote}) {
+		return nil, errors.New("multi-line strings are not supported")
+	}
+
+	end := -1
+	for i := start + 1; i < len(line); i++ {
+		if quote == '"' && line[i] == '\\' {
+			i++
+			continue
+		}
+		if line[i] == quote {
+			end = i
+			break
+		}
+	}
+	if end < 0 {
+		return nil, errors.New("unterminated string")
+	}
+
+	out := append([]byte{}, line[:start]...)
+	out = append(out, s...)
+	return append(out, line[end+1:]...), nil
+}
+
+// decryptTree decrypts all encrypted values of t. It returns the key path of
+// each decrypted value.
+func decryptTree(t *toml.Tree, keys func() (*crypto.Rotor, error)) (map[string]struct{}, error) {
+	secrets := map[string]struct{}{}
+	var r *crypto.Rotor
+	decrypt := func(key, s string) (string, error) {
+		if r == nil {
+			var err error
+			if r, err = keys(); err != nil {
+				return "", errors.Wrapf(err, "cannot decrypt config key <%s>", key)
+			}
+		}
+		plain, err := DecryptValue(r, s)
+		if err != nil {
+			return "", errors.Wrapf(err, "cannot decrypt config key <%s>", key)
+		}
+		secrets[key] = struct{}{}
+		return plain, nil
+	}
+
+	var walk func(t *toml.Tree, path string) error
+	walk = func(t *toml.Tree, path string) error {
+		for _, k := range t.Keys() {
+			key := joinKey(path, k)
+			switch v := t.GetPath([]string{k}).(type) {
+			case *toml.Tree:
+				if err := walk(v, key); err != nil {
+					return err
+				}
+			case []*toml.Tree:
+				for i, sub := range v {
+					if err := walk(sub, fmt.Sprintf("%s[%d]", key, i)); err != nil {
+						return err
+					}
+				}
+			case string:
+				if !IsSecret(v) {
+					continue
+				}
+				plain, err := decrypt(key, v)
+				if err != nil {
+					return err
+				}
+				t.SetPath([]string{k}, plain)
+			case []interface{}:
+				l := make([]interface{}, len(v))
+				for i, e := range v {
+					l[i] = e
+					if s, ok := e.(string); ok && IsSecret(s) {
+						plain, err := decrypt(fmt.Sprintf("%s[%d]", key, i), s)
+						if err != nil {
+							return err
+						}
+						l[i] = plain
+					}
+				}
+				t.SetPath([]string{k}, l)
+			}
+		}
+		return nil
+	}
+	if err := walk(t, ""); err != nil {
+		return nil, err
+	}
+	return secrets, nil
+}
+
+// redact returns a copy of t where the values at the given key paths are
+// replaced with Redacted. path is the key path of t from the root.
+func redact(t *toml.Tree, path string, secrets map[string]struct{}) *toml.Tree {
+	if len(secrets) == 0 {
+		return t
+	}
+
+	var walk func(v interface{}, key string) interface{}
+	walk = func(v interface{}, key string) interface{} {
+		if _, ok := secrets[key]; ok {
+			return Redacted
+		}
+		switch v := v.(type) {
+		case map[string]interface{}:
+			for k, e := range v {
+				v[k] = walk(e, joinKey(key, k))
+			}
+		case []map[string]interface{}:
+			for i, e := range v {
+				v[i] = walk(e, fmt.Sprintf("%s[%d]", key, i)).(map[string]interface{})
+			}
+		case []interface{}:
+			for i, e := range v {
+				v[i] = walk(e, fmt.Sprintf("%s[%d]", key, i))
+			}
+		}
+		return v
+	}
+
+	m := walk(t.ToMap(), path).(map[string]interface{})
+	c, err := toml.TreeFromMap(m)
+	if err != nil {
+		return t
+	}
+	return c
+}
+
+// isSubKey returns whether k is key, or a key inside key
+func isSubKey(k, key string) bool {
+	return k == key || strings.HasPrefix(k, key+".") || strings.HasPrefix(k, key+"[")
+}
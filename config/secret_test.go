@@ -0,0 +1,143 @@
+package config_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/deixis/spine/config"
+	"github.com/deixis/spine/crypto"
+)
+
+func testKey(b byte) string {
+	return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, crypto.KeySize))
+}
+
+func mustParseKeys(t *testing.T, s string) *crypto.Rotor {
+	r, err := config.ParseKeys(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestLoadTreeSecrets(t *testing.T) {
+	keys := mustParseKeys(t, "1:"+testKey(1))
+	enc, err := config.EncryptValue(keys, "s3cr3t")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := fmt.Sprintf(`
+[db]
+user = "admin"
+password = "%s"
+`, enc)
+	tree, err := config.LoadTree(strings.NewReader(data), config.WithKeys(keys))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var db struct {
+		User     string `toml:"user"`
+		Password string `toml:"password"`
+	}
+	if err := tree.Get("db").Unmarshal(&db); err != nil {
+		t.Fatal(err)
+	}
+	if db.Password != "s3cr3t" {
+		t.Errorf("expect decrypted password, but got %s", db.Password)
+	}
+
+	for _, s := range []string{tree.String(), tree.Get("db").String()} {
+		if strings.Contains(s, "s3cr3t") {
+			t.Errorf("expect password to be redacted, but got %s", s)
+		}
+		if !strings.Contains(s, config.Redacted) || !strings.Contains(s, "admin") {
+			t.Errorf("expect redacted tree, but got %s", s)
+		}
+	}
+
+	// Secrets survive merges
+	merged, err := config.Merge(config.Layer{Name: "a", Tree: tree})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(merged.String(), "s3cr3t") {
+		t.Errorf("expect password to be redacted, but got %s", merged.String())
+	}
+
+	// Missing keys
+	t.Setenv(config.KeysEnv, "")
+	t.Setenv(config.KeysFileEnv, "")
+	_, err = config.LoadTree(strings.NewReader(data))
+	if err == nil {
+		t.Error("expect error without keys")
+	}
+}
+
+func TestRotateSecrets(t *testing.T) {
+	old := mustParseKeys(t, "1:"+testKey(1))
+	enc, err := config.EncryptValue(old, "s3cr3t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte(fmt.Sprintf("# db\npassword = \"%s\" # comment\n", enc))
+
+	keys := mustParseKeys(t, "1:"+testKey(1)+"\n2:"+testKey(2))
+	data, n, err := config.RotateSecrets(data, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("expect 1 value rotated, but got %d", n)
+	}
+	if !strings.HasPrefix(string(data), "# db\npassword = \"enc:v1:") ||
+		!strings.HasSuffix(string(data), "\" # comment\n") {
+		t.Errorf("expect format to be preserved, but got %s", data)
+	}
+
+	// Only the new key is needed from now on
+	tree, err := config.LoadTree(bytes.NewReader(data), config.WithKeys(
+		mustParseKeys(t, "2:"+testKey(2)),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(tree.String(), "s3cr3t") {
+		t.Errorf("expect password to be redacted, but got %s", tree.String())
+	}
+}
+
+func TestEncryptTOMLKeys(t *testing.T) {
+	keys := mustParseKeys(t, "1:"+testKey(1))
+	data := []byte(`# Database
+[db]
+user = "admin"
+password = "p\"ss" # keep me
+`)
+
+	data, err := config.EncryptTOMLKeys(data, keys, "db.password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "# keep me") || !strings.Contains(string(data), `user = "admin"`) {
+		t.Errorf("expect format to be preserved, but got %s", data)
+	}
+
+	tree, err := config.LoadTree(bytes.NewReader(data), config.WithKeys(keys))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var db struct {
+		Password string `toml:"password"`
+	}
+	if err := tree.Get("db").Unmarshal(&db); err != nil {
+		t.Fatal(err)
+	}
+	if db.Password != `p"ss` {
+		t.Errorf("expect password p\"ss, but got %s", db.Password)
+	}
+}
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/deixis/spine/config/adapter"
+	"github.com/pkg/errors"
+)
+
+// Source is a config store used as a layer
+type Source struct {
+	// Name identifies the source without leaking credentials (e.g. tokens)
+	Name   string
+	Store  store.Store
+	Format Format
+}
+
+// NewSources returns a source for each URI of a comma-separated list. The
+// sources are listed by increasing precedence.
+//
+// e.g.
+// CONFIG_URI=file:///etc/app/base.toml,file:///etc/app/prod.yaml,consul://localhost/app
+func NewSources(uris string) ([]Source, error) {
+	var sources []Source
+	for _, s := range strings.Split(uris, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+
+		uri, err := url.Parse(s)
+		if err != nil {
+			return nil, err
+		}
+		st, err := NewStore(s)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error creating config store <%s>", s)
+		}
+		sources = append(sources, Source{
+			Name:   uri.Scheme + "://" + uri.Host + uri.Path,
+			Store:  st,
+			Format: FormatOf(uri),
+		})
+	}
+	if len(sources) == 0 {
+		return nil, errors.New("no config sources")
+	}
+	return sources, nil
+}
+
+// LoadSources loads all sources and merges them, followed by the environment
+// variables starting with EnvPrefix
+func LoadSources(sources []Source) (*LayeredTree, error) {
+	layers := make([]Layer, 0, len(sources)+1)
+	for _, s := range sources {
+		t, err := loadSource(s)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error loading config source <%s>", s.Name)
+		}
+		layers = append(layers, Layer{Name: s.Name, Tree: t})
+	}
+
+	base, err := Merge(layers...)
+	if err != nil {
+		return nil, err
+	}
+	env, err := EnvLayer(EnvPrefix, base)
+	if err != nil {
+		return nil, err
+	}
+	return Merge(append(layers, env)...)
+}
+
+func loadSource(s Source) (Tree, error) {
+	r, err := s.Store.Load()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return LoadTree(r, WithFormat(s.Format))
+}
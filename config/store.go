@@ -9,6 +9,7 @@ import (
 	"github.com/deixis/spine/config/adapter"
 	"github.com/deixis/spine/config/adapter/consul"
 	"github.com/deixis/spine/config/adapter/file"
+	"github.com/deixis/spine/config/adapter/http"
 )
 
 var (
@@ -20,6 +21,8 @@ func init() {
 	// Register default adapters
 	Register(consul.Name, consul.New)
 	Register(file.Name, file.New)
+	Register(http.Name, http.New)
+	Register(http.NameTLS, http.New)
 }
 
 // Adapters returns the list of registered adapters
@@ -8,7 +8,7 @@ import (
 
 // TestDefaultAdapters tests whether the default adapters are registered
 func TestDefaultAdapters(t *testing.T) {
-	expected := []string{"consul", "file"}
+	expected := []string{"consul", "file", "http", "https"}
 
 	l := config.Adapters()
 	if len(l) != len(expected) {
@@ -2,7 +2,10 @@ package config
 
 import (
 	"io"
+	"io/ioutil"
+	"strings"
 
+	"github.com/deixis/spine/crypto"
 	toml "github.com/pelletier/go-toml"
 	"github.com/pelletier/go-toml/query"
 	"github.com/pkg/errors"
@@ -19,11 +22,57 @@ type Tree interface {
 	String() string
 }
 
-// LoadTree loads r into a config tree
-func LoadTree(r io.Reader) (Tree, error) {
-	t, err := toml.LoadReader(r)
+// LoadOption configures how a tree is loaded
+type LoadOption func(*LoadOptions)
+
+// LoadOptions configure how a tree is loaded. LoadOptions are set by the
+// LoadOption values passed to LoadTree.
+type LoadOptions struct {
+	// Format is the format of the configuration. When it is empty, the format
+	// is sniffed from the content.
+	Format Format
+	// Keys decrypt the encrypted values (see SecretPrefix). When it is nil,
+	// the keys are loaded from the environment (see KeysFromEnv) on the first
+	// encrypted value.
+	Keys *crypto.Rotor
+}
+
+// WithFormat sets the format of the configuration
+func WithFormat(f Format) LoadOption {
+	return func(o *LoadOptions) {
+		o.Format = f
+	}
+}
+
+// WithKeys sets the keys which decrypt the encrypted values
+func WithKeys(r *crypto.Rotor) LoadOption {
+	return func(o *LoadOptions) {
+		o.Keys = r
+	}
+}
+
+// LoadTree loads r into a config tree. TOML, YAML and JSON formats are
+// supported.
+//
+// String values starting with `$` are replaced with the environment variable
+// value, and values starting with SecretPrefix are decrypted. Decrypted values
+// are redacted from Tree.String().
+func LoadTree(r io.Reader, o ...LoadOption) (Tree, error) {
+	opts := LoadOptions{}
+	for _, o := range o {
+		o(&opts)
+	}
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading config")
+	}
+	if opts.Format == "" {
+		opts.Format = sniffFormat(data)
+	}
+	t, err := parse(data, opts.Format)
 	if err != nil {
-		return nil, errors.Wrap(err, "error loading config tree")
+		return nil, errors.Wrapf(err, "error loading %s config tree", opts.Format)
 	}
 
 	// Replace all environment variables with their value
@@ -43,7 +92,16 @@ func LoadTree(r io.Reader) (Tree, error) {
 		}
 	}
 
-	return &tree{t: t}, nil
+	keys := KeysFromEnv
+	if opts.Keys != nil {
+		keys = func() (*crypto.Rotor, error) { return opts.Keys, nil }
+	}
+	secrets, err := decryptTree(t, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tree{t: t, secrets: secrets}, nil
 }
 
 // NopTree returns an empty tree
@@ -54,6 +112,10 @@ func NopTree() Tree {
 // tree wraps a TOML tree
 type tree struct {
 	t *toml.Tree
+	// path is the key path of this tree from the root
+	path []string
+	// secrets contains the key path (from the root) of each decrypted value
+	secrets map[string]struct{}
 }
 
 // TreeFromMap initialises a new Tree object using the given map.
@@ -77,32 +139,52 @@ func (t *tree) Has(key string) bool {
 func (t *tree) Get(key string) Tree {
 	child, ok := t.t.Get(key).(*toml.Tree)
 	if !ok {
-		return &nopTree{}
+		return &nopTree{path: childPath(t.path, key)}
 	}
-	return &tree{t: child}
+	return &tree{t: child, path: childPath(t.path, key), secrets: t.secrets}
 }
 
+// Unmarshal unmarshals the tree into v, applies default values to the keys
+// absent from the tree and validates it (see Validate)
 func (t *tree) Unmarshal(v interface{}) error {
 	err := t.t.Unmarshal(v)
 	if err != nil {
 		return errors.Wrap(err, "cannot unmarshal config tree")
 	}
-	return nil
+	path := strings.Join(t.path, ".")
+	return validate(path, v, func(key string) bool {
+		if path != "" {
+			key = strings.TrimPrefix(key, path+".")
+		}
+		return t.t.Has(key)
+	})
 }
 
+// String returns the tree as TOML with the decrypted values redacted
 func (t *tree) String() string {
-	s, _ := t.t.ToTomlString()
+	s, _ := redact(t.t, strings.Join(t.path, "."), t.secrets).ToTomlString()
 	return s
 }
 
 // nopTree is a tree that does not do anything (null pattern)
-type nopTree struct{}
+type nopTree struct {
+	path []string
+}
+
+func (t *nopTree) Keys() []string      { return nil }
+func (t *nopTree) Has(key string) bool { return false }
+func (t *nopTree) Get(key string) Tree { return &nopTree{path: childPath(t.path, key)} }
+func (t *nopTree) String() string      { return "" }
 
-func (t *nopTree) Keys() []string                { return nil }
-func (t *nopTree) Has(key string) bool           { return false }
-func (t *nopTree) Get(key string) Tree           { return t }
-func (t *nopTree) Unmarshal(v interface{}) error { return nil }
-func (t *nopTree) String() string                { return "" }
+// Unmarshal applies default values to v and validates it, since the tree is
+// empty
+func (t *nopTree) Unmarshal(v interface{}) error {
+	return Validate(strings.Join(t.path, "."), v)
+}
+
+func childPath(path []string, key string) []string {
+	return append(append([]string{}, path...), key)
+}
 
 func mustCompile(q *query.Query, err error) *query.Query {
 	if err != nil {
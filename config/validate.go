@@ -0,0 +1,299 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Violation is a config value which does not satisfy a rule
+type Violation struct {
+	// Key is the key path of the value (e.g. cache.groupcache.addr)
+	Key string
+	Msg string
+}
+
+func (v Violation) String() string {
+	return v.Key + ": " + v.Msg
+}
+
+// ValidationError is returned when a config has violations
+type ValidationError struct {
+	Violations []Violation
+}
+
+func (e *ValidationError) Error() string {
+	l := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		l[i] = v.String()
+	}
+	return "invalid config: " + strings.Join(l, "; ")
+}
+
+// Validate applies default values to v and checks its validation rules. path
+// is the key path of v in the config tree. It returns a *ValidationError with
+// all violations found.
+//
+// Validation rules are given with the `validate` struct tag, and default
+// values with the `default` struct tag. Defaults follow the TOML decoder
+// format (e.g. 5s, 42, true), and are applied to empty values before
+// validation, even when the whole section is missing. Tree.Unmarshal only
+// applies defaults to keys absent from the tree, so an explicit zero value
+// (e.g. timeout = "0s") is kept.
+//
+//	type Config struct {
+//		Addr  string `toml:"addr" validate:"required"`
+//		Level string `toml:"level" validate:"oneof=trace warning error"`
+//		Port  int    `toml:"port" default:"8080" validate:"min=1,max=65535"`
+//	}
+//
+// Rules:
+//   - required: the value must not be empty
+//   - min=n, max=n: bounds of a number, or of the length of a string, slice
+//     or map. Empty values of absent keys are not checked.
+//   - oneof=a b c: the value must be one of the space-separated values. Empty
+//     values of absent keys are not checked.
+func Validate(path string, v interface{}) error {
+	return validate(path, v, nil)
+}
+
+// validate is like Validate, but it only applies defaults to the keys for
+// which present returns false. Defaults are applied to all empty values when
+// present is nil.
+func validate(path string, v interface{}, present func(key string) bool) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return nil
+	}
+
+	var violations []Violation
+	validateValue(path, rv.Elem(), present, &violations)
+	if len(violations) > 0 {
+		return &ValidationError{Violations: violations}
+	}
+	return nil
+}
+
+// JoinValidationErrors merges all validation errors, even wrapped, into a
+// single one. It returns the first error which is not a validation error, if
+// any.
+func JoinValidationErrors(errs ...error) error {
+	var violations []Violation
+	for _, err := range errs {
+		if err == nil {
+			continue
+		}
+		var verr *ValidationError
+		if !errors.As(err, &verr) {
+			return err
+		}
+		violations = append(violations, verr.Violations...)
+	}
+	if len(violations) > 0 {
+		return &ValidationError{Violations: violations}
+	}
+	return nil
+}
+
+func validateValue(
+	path string, v reflect.Value, present func(key string) bool, violations *[]Violation,
+) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			validateValue(path, v.Elem(), present, violations)
+		}
+	case reflect.Struct:
+		if v.Type() == reflect.TypeOf(time.Time{}) {
+			return
+		}
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" {
+				// Unexported
+				continue
+			}
+			validateField(joinKey(path, keyOf(f)), f, v.Field(i), present, violations)
+		}
+	case reflect.Slice, reflect.Array:
+		// Keys of array elements cannot be looked up, so defaults apply to
+		// their empty values
+		for i := 0; i < v.Len(); i++ {
+			validateValue(fmt.Sprintf("%s[%d]", path, i), v.Index(i), nil, violations)
+		}
+	}
+}
+
+func validateField(
+	key string,
+	f reflect.StructField,
+	v reflect.Value,
+	present func(key string) bool,
+	violations *[]Violation,
+) {
+	add := func(format string, a ...interface{}) {
+		*violations = append(*violations, Violation{Key: key, Msg: fmt.Sprintf(format, a...)})
+	}
+
+	// Zero values are only validated when they are set explicitly, since
+	// absent keys are optional unless they are required
+	explicit := present != nil && present(key)
+	def, ok := f.Tag.Lookup("default")
+	if ok && v.IsZero() && !explicit {
+		if err := setValue(v, def); err != nil {
+			add("invalid default value %q (%s)", def, err)
+			return
+		}
+	}
+
+	for _, rule := range splitRules(f.Tag.Get("validate")) {
+		name, arg, _ := strings.Cut(rule, "=")
+		switch name {
+		case "required":
+			if v.IsZero() {
+				add("is required")
+			}
+		case "min", "max":
+			if v.IsZero() && !explicit {
+				continue
+			}
+			n, ok := numberOf(v)
+			if !ok {
+				add("rule %s is not supported on %s", name, v.Type())
+				continue
+			}
+			bound, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				add("invalid rule %s", rule)
+				continue
+			}
+			if name == "min" && n < bound {
+				add("must be at least %s (got %v)", arg, displayValue(v))
+			}
+			if name == "max" && n > bound {
+				add("must be at most %s (got %v)", arg, displayValue(v))
+			}
+		case "oneof":
+			if v.IsZero() && !explicit {
+				continue
+			}
+			allowed := strings.Fields(arg)
+			s := fmt.Sprint(v.Interface())
+			found := false
+			for _, a := range allowed {
+				if a == s {
+					found = true
+					break
+				}
+			}
+			if !found {
+				add("must be one of %s (got %s)", strings.Join(allowed, ", "), s)
+			}
+		case "":
+		default:
+			add("unknown rule %s", name)
+		}
+	}
+
+	validateValue(key, v, present, violations)
+}
+
+// splitRules splits rules separated by a comma
+func splitRules(s string) []string {
+	var rules []string
+	for _, r := range strings.Split(s, ",") {
+		if r = strings.TrimSpace(r); r != "" {
+			rules = append(rules, r)
+		}
+	}
+	return rules
+}
+
+// numberOf returns the value of a number, or the length of a string, slice or
+// map
+func numberOf(v reflect.Value) (float64, bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return float64(v.Len()), true
+	}
+	return 0, false
+}
+
+func displayValue(v reflect.Value) interface{} {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return fmt.Sprintf("length %d", v.Len())
+	}
+	return v.Interface()
+}
+
+// setValue parses s into v
+func setValue(v reflect.Value, s string) error {
+	if v.Type() == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// keyOf returns the config key of a struct field
+func keyOf(f reflect.StructField) string {
+	if tag := f.Tag.Get("toml"); tag != "" {
+		if name, _, _ := strings.Cut(tag, ","); name != "" && name != "-" {
+			return name
+		}
+	}
+	return strings.ToLower(f.Name)
+}
+
+func joinKey(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,176 @@
+package config_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/deixis/spine/config"
+)
+
+type validateServer struct {
+	Addr    string        `toml:"addr" validate:"required"`
+	Timeout time.Duration `toml:"timeout" default:"5s"`
+	Retries uint32        `toml:"retries" default:"3"`
+	Workers int           `toml:"workers" default:"4" validate:"min=1,max=8"`
+	Level   string        `toml:"level" validate:"oneof=trace warning error"`
+}
+
+type validateConfig struct {
+	Name    string           `toml:"name" validate:"required"`
+	Server  validateServer   `toml:"server"`
+	Servers []validateServer `toml:"servers"`
+}
+
+func TestUnmarshalDefaults(t *testing.T) {
+	tree := mustLoadTree(t, `
+name = "test"
+[server]
+addr = ":80"
+`)
+
+	var c validateConfig
+	if err := tree.Unmarshal(&c); err != nil {
+		t.Fatal("expect no error, but got", err)
+	}
+	expect := validateServer{
+		Addr:    ":80",
+		Timeout: 5 * time.Second,
+		Retries: 3,
+		Workers: 4,
+	}
+	if !reflect.DeepEqual(expect, c.Server) {
+		t.Errorf("expect server config %+v, but got %+v", expect, c.Server)
+	}
+}
+
+func TestUnmarshalExplicitZero(t *testing.T) {
+	tree := mustLoadTree(t, `
+name = "test"
+[server]
+addr = ":80"
+timeout = "0s"
+retries = 0
+`)
+
+	var c validateConfig
+	if err := tree.Unmarshal(&c); err != nil {
+		t.Fatal("expect no error, but got", err)
+	}
+	var s validateServer
+	if err := tree.Get("server").Unmarshal(&s); err != nil {
+		t.Fatal("expect no error, but got", err)
+	}
+	expect := validateServer{
+		Addr:    ":80",
+		Workers: 4,
+	}
+	if !reflect.DeepEqual(expect, c.Server) {
+		t.Errorf("expect server config %+v, but got %+v", expect, c.Server)
+	}
+	if !reflect.DeepEqual(expect, s) {
+		t.Errorf("expect server config %+v, but got %+v", expect, s)
+	}
+}
+
+func TestUnmarshalExplicitZeroViolations(t *testing.T) {
+	tree := mustLoadTree(t, `
+name = "test"
+[server]
+addr = ":80"
+workers = 0
+level = ""
+`)
+
+	var c validateConfig
+	err := tree.Unmarshal(&c)
+	verr, ok := err.(*config.ValidationError)
+	if !ok {
+		t.Fatalf("expect ValidationError, but got %v", err)
+	}
+	expect := []config.Violation{
+		{Key: "server.workers", Msg: "must be at least 1 (got 0)"},
+		{Key: "server.level", Msg: "must be one of trace, warning, error (got )"},
+	}
+	if !reflect.DeepEqual(expect, verr.Violations) {
+		t.Errorf("expect violations %v, but got %v", expect, verr.Violations)
+	}
+}
+
+func TestUnmarshalViolations(t *testing.T) {
+	tree := mustLoadTree(t, `
+[server]
+workers = 10
+level = "debug"
+[[servers]]
+addr = ":80"
+[[servers]]
+workers = -1
+`)
+
+	var c validateConfig
+	err := tree.Unmarshal(&c)
+	verr, ok := err.(*config.ValidationError)
+	if !ok {
+		t.Fatalf("expect validation error, but got %v", err)
+	}
+	var keys []string
+	for _, v := range verr.Violations {
+		keys = append(keys, v.Key)
+	}
+	expect := []string{
+		"name",
+		"server.addr",
+		"server.workers",
+		"server.level",
+		"servers[1].addr",
+		"servers[1].workers",
+	}
+	if !reflect.DeepEqual(expect, keys) {
+		t.Errorf("expect violations on %v, but got %v", expect, keys)
+	}
+}
+
+func TestUnmarshalPath(t *testing.T) {
+	tree := mustLoadTree(t, `
+[app.server]
+workers = 4
+`)
+
+	var s validateServer
+	err := tree.Get("app").Get("server").Unmarshal(&s)
+	verr, ok := err.(*config.ValidationError)
+	if !ok || len(verr.Violations) != 1 {
+		t.Fatalf("expect 1 validation error, but got %v", err)
+	}
+	if verr.Violations[0].Key != "app.server.addr" {
+		t.Errorf("expect key app.server.addr, but got %s", verr.Violations[0].Key)
+	}
+
+	// Defaults and required rules apply to missing subtrees
+	s = validateServer{}
+	err = tree.Get("missing").Unmarshal(&s)
+	verr, ok = err.(*config.ValidationError)
+	if !ok || verr.Violations[0].Key != "missing.addr" {
+		t.Fatalf("expect validation error on missing.addr, but got %v", err)
+	}
+	if s.Timeout != 5*time.Second {
+		t.Errorf("expect default timeout on missing subtree, but got %s", s.Timeout)
+	}
+}
+
+func TestJoinValidationErrors(t *testing.T) {
+	a := &config.ValidationError{Violations: []config.Violation{{Key: "a", Msg: "is required"}}}
+	b := &config.ValidationError{Violations: []config.Violation{{Key: "b", Msg: "is required"}}}
+
+	err := config.JoinValidationErrors(a, nil, b)
+	if err == nil {
+		t.Fatal("expect error")
+	}
+	if err.Error() != "invalid config: a: is required; b: is required" {
+		t.Errorf("unexpected error message %q", err.Error())
+	}
+	if err := config.JoinValidationErrors(nil, nil); err != nil {
+		t.Errorf("expect no error, but got %v", err)
+	}
+}
@@ -0,0 +1,38 @@
+package spine_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/deixis/spine"
+	"github.com/deixis/spine/config"
+	lt "github.com/deixis/spine/testing"
+)
+
+// TestConfigViolations tests whether the violations of the app config and of
+// the adapter configs are reported together
+func TestConfigViolations(t *testing.T) {
+	appConfig := struct {
+		Name string `toml:"name" validate:"required"`
+	}{}
+	_, err := spine.NewWithConfig("test", strings.NewReader(`
+[schedule.local]
+workers = 0
+[cache.groupcache]
+replicas = 0
+`), &appConfig, spine.WithLogger(lt.NewLogger(t, false)))
+
+	var verr *config.ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expect ValidationError, but got %v", err)
+	}
+	var keys []string
+	for _, v := range verr.Violations {
+		keys = append(keys, v.Key)
+	}
+	expect := "app.name,schedule.local.workers,cache.groupcache.addr,cache.groupcache.replicas"
+	if strings.Join(keys, ",") != expect {
+		t.Errorf("expect violations of %s, but got %v", expect, verr)
+	}
+}
@@ -0,0 +1,516 @@
+package context
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/deixis/spine/contextutil"
+	"github.com/deixis/spine/log"
+	"github.com/deixis/spine/stats"
+)
+
+var (
+	// ErrCircuitOpen is the error returned when a command is rejected because
+	// its circuit breaker is open
+	ErrCircuitOpen = errors.New("circuit breaker is open")
+	// ErrMaxConcurrency is the error returned when a command is rejected
+	// because too many calls are already running
+	ErrMaxConcurrency = errors.New("command max concurrency reached")
+	// ErrCommandTimeout is the error returned when a command does not return
+	// before its timeout
+	ErrCommandTimeout = errors.New("command timed out")
+)
+
+// CommandConfig configures the circuit breaker of a command. Zero values are
+// replaced by defaults.
+type CommandConfig struct {
+	// Timeout is the maximum duration of a call (1s by default). It is reduced
+	// to the caller deadline when it is shorter.
+	Timeout time.Duration
+	// MaxConcurrent is the maximum number of concurrent calls (10 by default)
+	MaxConcurrent int
+	// Window is the rolling window over which calls are counted (10s by
+	// default)
+	Window time.Duration
+	// VolumeThreshold is the minimum number of calls in the window before the
+	// breaker can open (20 by default)
+	VolumeThreshold int
+	// ErrorPercent is the percentage of failed calls in the window which opens
+	// the breaker (50 by default)
+	ErrorPercent int
+	// LatencyThreshold counts calls slower than it as failures (disabled by
+	// default)
+	LatencyThreshold time.Duration
+	// SleepWindow is the time an open breaker waits before letting a probe
+	// call through (5s by default)
+	SleepWindow time.Duration
+}
+
+func (c *CommandConfig) setDefaults() {
+	if c.Timeout <= 0 {
+		c.Timeout = time.Second
+	}
+	if c.MaxConcurrent <= 0 {
+		c.MaxConcurrent = 10
+	}
+	if c.Window <= 0 {
+		c.Window = 10 * time.Second
+	}
+	if c.VolumeThreshold <= 0 {
+		c.VolumeThreshold = 20
+	}
+	if c.ErrorPercent <= 0 {
+		c.ErrorPercent = 50
+	}
+	if c.SleepWindow <= 0 {
+		c.SleepWindow = 5 * time.Second
+	}
+}
+
+// BreakerState is the state of a circuit breaker
+type BreakerState int
+
+const (
+	// StateClosed lets calls through
+	StateClosed BreakerState = iota
+	// StateOpen rejects calls
+	StateOpen
+	// StateHalfOpen lets a single probe call through
+	StateHalfOpen
+)
+
+var breakerStateNames = map[BreakerState]string{
+	StateClosed:   "closed",
+	StateOpen:     "open",
+	StateHalfOpen: "half_open",
+}
+
+func (s BreakerState) String() string {
+	return breakerStateNames[s]
+}
+
+// Do runs the named command. When the command fails, or when its circuit
+// breaker rejects it, fallback is called with the error. Without fallback,
+// Do returns the error.
+func Do(
+	ctx Context,
+	name string,
+	run func(ctx Context) error,
+	fallback func(ctx Context, err error) error,
+) error {
+	b := BreakersFromContext(ctx).Get(name)
+	report, release, err := b.allow()
+	if err != nil {
+		return fallbackOrErr(ctx, fallback, err)
+	}
+
+	timeout := b.Config().Timeout
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < timeout {
+		timeout = time.Until(deadline)
+	}
+	cctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// The concurrency slot is held until run returns, even when the command
+	// has timed out
+	errc := make(chan error, 1)
+	go func() {
+		defer release()
+		defer func() {
+			if r := recover(); r != nil {
+				errc <- fmt.Errorf("command panic: %v\n%s", r, debug.Stack())
+			}
+		}()
+		errc <- run(cctx)
+	}()
+
+	select {
+	case err = <-errc:
+	case <-cctx.Done():
+		err = ErrCommandTimeout
+	}
+	if ctx.Err() != nil {
+		// The caller gave up (cancelled or past its own deadline), which says
+		// nothing about the command health
+		err = ctx.Err()
+		report(context.Canceled)
+	} else {
+		report(err)
+	}
+	if err != nil {
+		return fallbackOrErr(ctx, fallback, err)
+	}
+	return nil
+}
+
+// Go runs the named command asynchronously (see Do). The returned channel
+// receives the result.
+func Go(
+	ctx Context,
+	name string,
+	run func(ctx Context) error,
+	fallback func(ctx Context, err error) error,
+) <-chan error {
+	errc := make(chan error, 1)
+	go func() {
+		errc <- Do(ctx, name, run, fallback)
+	}()
+	return errc
+}
+
+func fallbackOrErr(
+	ctx Context, fallback func(ctx Context, err error) error, err error,
+) error {
+	if fallback == nil {
+		return err
+	}
+	return fallback(ctx, err)
+}
+
+// BreakerStats describes the state of a circuit breaker
+type BreakerStats struct {
+	Name       string    `json:"name"`
+	State      string    `json:"state"`
+	Requests   int       `json:"requests"`
+	Failures   int       `json:"failures"`
+	Concurrent int       `json:"concurrent"`
+	OpenedAt   time.Time `json:"opened_at,omitempty"`
+}
+
+// Breakers holds the circuit breakers of commands
+type Breakers struct {
+	mu sync.Mutex
+
+	log      log.Logger
+	stats    stats.Stats
+	configs  map[string]CommandConfig
+	breakers map[string]*Breaker
+}
+
+// NewBreakers returns a new circuit breaker registry
+func NewBreakers(l log.Logger, s stats.Stats) *Breakers {
+	return &Breakers{
+		log:      l,
+		stats:    s,
+		configs:  map[string]CommandConfig{},
+		breakers: map[string]*Breaker{},
+	}
+}
+
+// Configure sets the configuration of the named command
+func (r *Breakers) Configure(name string, c CommandConfig) {
+	c.setDefaults()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.configs[name] = c
+	if b, ok := r.breakers[name]; ok {
+		b.mu.Lock()
+		b.config = c
+		b.window.resize(c.Window)
+		b.mu.Unlock()
+	}
+}
+
+// Get returns the circuit breaker of the named command
+func (r *Breakers) Get(name string) *Breaker {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if b, ok := r.breakers[name]; ok {
+		return b
+	}
+	c, ok := r.configs[name]
+	if !ok {
+		c.setDefaults()
+	}
+	b := &Breaker{
+		name:   name,
+		config: c,
+		reg:    r,
+	}
+	b.window.resize(c.Window)
+	r.breakers[name] = b
+	return b
+}
+
+// Stats returns the state of all circuit breakers sorted by name
+func (r *Breakers) Stats() []BreakerStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	l := make([]BreakerStats, 0, len(r.breakers))
+	for _, b := range r.breakers {
+		l = append(l, b.Stats())
+	}
+	sort.Slice(l, func(i, j int) bool {
+		return l[i].Name < l[j].Name
+	})
+	return l
+}
+
+// Breaker is the circuit breaker of a command
+type Breaker struct {
+	mu sync.Mutex
+
+	name   string
+	config CommandConfig
+	reg    *Breakers
+
+	state      BreakerState
+	openedAt   time.Time
+	probing    bool
+	concurrent int
+	window     window
+}
+
+// Config returns the breaker configuration
+func (b *Breaker) Config() CommandConfig {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.config
+}
+
+// Allow returns whether a call can go through. When it can, done must be
+// called with the result of the call. context.Canceled is not counted, so a
+// call whose caller gave up (cancelled or past its deadline) must be reported
+// with context.Canceled.
+func (b *Breaker) Allow() (done func(err error), err error) {
+	report, release, err := b.allow()
+	if err != nil {
+		return nil, err
+	}
+	return func(err error) {
+		report(err)
+		release()
+	}, nil
+}
+
+// allow is like Allow, but the result of the call is reported separately
+// from the release of its concurrency slot
+func (b *Breaker) allow() (report func(err error), release func(), err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	probe := false
+	switch b.state {
+	case StateOpen:
+		if now.Sub(b.openedAt) < b.config.SleepWindow {
+			b.count("short_circuit")
+			return nil, nil, ErrCircuitOpen
+		}
+		b.setState(StateHalfOpen, now)
+		fallthrough
+	case StateHalfOpen:
+		if b.probing {
+			b.count("short_circuit")
+			return nil, nil, ErrCircuitOpen
+		}
+	}
+	if b.concurrent >= b.config.MaxConcurrent {
+		b.count("rejected")
+		return nil, nil, ErrMaxConcurrency
+	}
+	if b.state == StateHalfOpen {
+		b.probing = true
+		probe = true
+	}
+	b.concurrent++
+
+	var reported, released sync.Once
+	report = func(err error) {
+		reported.Do(func() {
+			b.report(now, probe, err)
+		})
+	}
+	release = func() {
+		released.Do(b.release)
+	}
+	return report, release, nil
+}
+
+// Stats returns the breaker state
+func (b *Breaker) Stats() BreakerStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s := BreakerStats{
+		Name:       b.name,
+		State:      b.state.String(),
+		Concurrent: b.concurrent,
+	}
+	s.Requests, s.Failures = b.window.sum(time.Now())
+	if b.state != StateClosed {
+		s.OpenedAt = b.openedAt
+	}
+	return s
+}
+
+func (b *Breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.concurrent--
+}
+
+func (b *Breaker) report(start time.Time, probe bool, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	latency := now.Sub(start)
+	b.reg.stats.Timing("breaker.latency", latency, map[string]string{
+		"command": b.name,
+	})
+
+	if errors.Is(err, context.Canceled) {
+		if probe {
+			b.probing = false
+		}
+		return
+	}
+
+	failed := err != nil ||
+		(b.config.LatencyThreshold > 0 && latency > b.config.LatencyThreshold)
+	switch {
+	case errors.Is(err, ErrCommandTimeout):
+		b.count("timeout")
+	case failed:
+		b.count("failure")
+	default:
+		b.count("success")
+	}
+
+	if probe {
+		b.probing = false
+		if failed {
+			b.setState(StateOpen, now)
+		} else {
+			b.window.reset()
+			b.setState(StateClosed, now)
+		}
+		return
+	}
+	if b.state != StateClosed {
+		return
+	}
+
+	b.window.add(now, failed)
+	requests, failures := b.window.sum(now)
+	if requests >= b.config.VolumeThreshold &&
+		failures*100 >= b.config.ErrorPercent*requests {
+		b.setState(StateOpen, now)
+	}
+}
+
+func (b *Breaker) setState(s BreakerState, now time.Time) {
+	if b.state == s {
+		return
+	}
+	b.state = s
+	if s == StateOpen {
+		b.openedAt = now
+	}
+
+	fields := []log.Field{
+		log.String("command", b.name),
+		log.Stringer("state", s),
+	}
+	if s == StateOpen {
+		b.reg.log.Warning("breaker.open", "Circuit breaker opened", fields...)
+	} else {
+		b.reg.log.Trace("breaker.state", "Circuit breaker state changed", fields...)
+	}
+	b.reg.stats.Inc("breaker.state", map[string]string{
+		"command": b.name,
+		"state":   s.String(),
+	})
+}
+
+func (b *Breaker) count(status string) {
+	b.reg.stats.Inc("breaker.call", map[string]string{
+		"command": b.name,
+		"status":  status,
+	})
+}
+
+// windowBuckets is the number of buckets of a rolling window
+const windowBuckets = 10
+
+// window counts calls over a rolling window
+type window struct {
+	width   time.Duration
+	buckets [windowBuckets]bucket
+}
+
+type bucket struct {
+	epoch    int64
+	requests int
+	failures int
+}
+
+func (w *window) resize(d time.Duration) {
+	w.width = d / windowBuckets
+	if w.width <= 0 {
+		w.width = 1
+	}
+	w.reset()
+}
+
+func (w *window) reset() {
+	w.buckets = [windowBuckets]bucket{}
+}
+
+func (w *window) add(now time.Time, failed bool) {
+	epoch := now.UnixNano() / int64(w.width)
+	b := &w.buckets[epoch%windowBuckets]
+	if b.epoch != epoch {
+		*b = bucket{epoch: epoch}
+	}
+	b.requests++
+	if failed {
+		b.failures++
+	}
+}
+
+func (w *window) sum(now time.Time) (requests, failures int) {
+	epoch := now.UnixNano() / int64(w.width)
+	for _, b := range w.buckets {
+		if b.epoch > epoch-windowBuckets && b.epoch <= epoch {
+			requests += b.requests
+			failures += b.failures
+		}
+	}
+	return requests, failures
+}
+
+type breakersKey struct{}
+
+var activeBreakersKey = breakersKey{}
+
+var defaultBreakers = NewBreakers(log.NopLogger(), stats.NopStats())
+
+// ConfigureCommand calls `Configure` on the context `Breakers`
+func ConfigureCommand(ctx contextutil.ValueContext, name string, c CommandConfig) {
+	BreakersFromContext(ctx).Configure(name, c)
+}
+
+// BreakersFromContext returns a `Breakers` instance associated with `ctx`, or
+// a default `Breakers` if no existing `Breakers` instance could be found.
+func BreakersFromContext(ctx contextutil.ValueContext) *Breakers {
+	val := ctx.Value(activeBreakersKey)
+	if o, ok := val.(*Breakers); ok {
+		return o
+	}
+	return defaultBreakers
+}
+
+// BreakersWithContext returns a copy of parent in which `Breakers` is stored
+func BreakersWithContext(ctx context.Context, r *Breakers) context.Context {
+	return context.WithValue(ctx, activeBreakersKey, r)
+}
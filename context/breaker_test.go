@@ -0,0 +1,156 @@
+package context
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/deixis/spine/log"
+	"github.com/deixis/spine/stats"
+)
+
+func newBreakersContext() (Context, *Breakers) {
+	r := NewBreakers(log.NopLogger(), stats.NopStats())
+	return BreakersWithContext(Background(), r), r
+}
+
+func TestBreaker_Open(t *testing.T) {
+	ctx, r := newBreakersContext()
+	r.Configure("foo", CommandConfig{
+		VolumeThreshold: 4,
+		ErrorPercent:    50,
+		SleepWindow:     10 * time.Millisecond,
+	})
+
+	errFoo := errors.New("foo")
+	fail := func(ctx Context) error { return errFoo }
+	pass := func(ctx Context) error { return nil }
+
+	Do(ctx, "foo", pass, nil)
+	Do(ctx, "foo", pass, nil)
+	Do(ctx, "foo", fail, nil)
+	if err := Do(ctx, "foo", fail, nil); err != errFoo {
+		t.Fatalf("expect %v, but got %v", errFoo, err)
+	}
+	if s := r.Get("foo").Stats(); s.State != "open" {
+		t.Fatalf("expect breaker to be open, but got %s", s.State)
+	}
+
+	// Calls are short-circuited to the fallback
+	var fallbackErr error
+	err := Do(ctx, "foo", pass, func(ctx Context, err error) error {
+		fallbackErr = err
+		return nil
+	})
+	if err != nil || fallbackErr != ErrCircuitOpen {
+		t.Errorf("expect fallback with ErrCircuitOpen, but got %v (%v)", fallbackErr, err)
+	}
+
+	// A failing probe opens it again
+	time.Sleep(15 * time.Millisecond)
+	Do(ctx, "foo", fail, nil)
+	if s := r.Get("foo").Stats(); s.State != "open" {
+		t.Fatalf("expect breaker to be open, but got %s", s.State)
+	}
+
+	// A successful probe closes it
+	time.Sleep(15 * time.Millisecond)
+	if err := Do(ctx, "foo", pass, nil); err != nil {
+		t.Fatal(err)
+	}
+	if s := r.Get("foo").Stats(); s.State != "closed" {
+		t.Errorf("expect breaker to be closed, but got %s", s.State)
+	}
+}
+
+func TestBreaker_Timeout(t *testing.T) {
+	ctx, r := newBreakersContext()
+	r.Configure("slow", CommandConfig{Timeout: time.Hour})
+
+	// The timeout is derived from the caller deadline
+	ctx, cancel := WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := Do(ctx, "slow", func(ctx Context) error {
+		time.Sleep(time.Second)
+		return nil
+	}, nil)
+	if err != DeadlineExceeded {
+		t.Errorf("expect DeadlineExceeded, but got %v", err)
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("expect call to return at the caller deadline, but took %s", d)
+	}
+	if s := r.Get("slow").Stats(); s.Requests != 0 || s.Failures != 0 {
+		t.Errorf("expect caller deadline not to be counted, but got %+v", s)
+	}
+
+	r.Configure("hung", CommandConfig{Timeout: time.Millisecond})
+	err = <-Go(BreakersWithContext(Background(), r), "hung", func(ctx Context) error {
+		time.Sleep(time.Second)
+		return nil
+	}, nil)
+	if err != ErrCommandTimeout {
+		t.Errorf("expect ErrCommandTimeout, but got %v", err)
+	}
+}
+
+func TestBreaker_MaxConcurrent(t *testing.T) {
+	ctx, r := newBreakersContext()
+	r.Configure("bulkhead", CommandConfig{MaxConcurrent: 1})
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	errc := Go(ctx, "bulkhead", func(ctx Context) error {
+		close(started)
+		<-release
+		return nil
+	}, nil)
+	<-started
+
+	err := Do(ctx, "bulkhead", func(ctx Context) error { return nil }, nil)
+	if err != ErrMaxConcurrency {
+		t.Errorf("expect ErrMaxConcurrency, but got %v", err)
+	}
+	close(release)
+	if err := <-errc; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestBreaker_TimeoutHoldsSlot(t *testing.T) {
+	ctx, r := newBreakersContext()
+	r.Configure("hung", CommandConfig{Timeout: time.Millisecond, MaxConcurrent: 1})
+
+	release := make(chan struct{})
+	returned := make(chan struct{})
+	err := Do(ctx, "hung", func(ctx Context) error {
+		defer close(returned)
+		<-release
+		return nil
+	}, nil)
+	if err != ErrCommandTimeout {
+		t.Fatalf("expect ErrCommandTimeout, but got %v", err)
+	}
+	if s := r.Get("hung").Stats(); s.Failures != 1 {
+		t.Errorf("expect timeout to be counted as a failure, but got %d", s.Failures)
+	}
+
+	// The slot is held until the command returns
+	err = Do(ctx, "hung", func(ctx Context) error { return nil }, nil)
+	if err != ErrMaxConcurrency {
+		t.Errorf("expect ErrMaxConcurrency, but got %v", err)
+	}
+	close(release)
+	<-returned
+	deadline := time.Now().Add(time.Second)
+	for r.Get("hung").Stats().Concurrent != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expect slot to be released once the command returns")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := Do(ctx, "hung", func(ctx Context) error { return nil }, nil); err != nil {
+		t.Error(err)
+	}
+}
@@ -2,6 +2,14 @@
 //
 // Consul is a highly available and distributed service discovery and key-value store designed
 // with support for the modern data center to make distributed systems and configuration easy.
+//
+// Registered services get a TTL check which reports the readiness of the
+// context health registry, so instances which are not ready (e.g. draining)
+// are no longer discovered.
+//
+// The agent also runs leader elections with Consul sessions. The leader holds
+// a KV lock (see Config.ElectionPrefix) with a session which must be renewed
+// within Config.SessionTTL.
 package consul
 
 import (
@@ -10,18 +18,23 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/hashicorp/consul/api"
 	"github.com/pkg/errors"
 	"github.com/deixis/spine/config"
 	"github.com/deixis/spine/disco"
+	"github.com/deixis/spine/health"
 	"github.com/deixis/spine/log"
 )
 
 // Name contains the adapter registered name
 const Name = "consul"
 
+// defaultCheckTTL is the TTL of the health check of registered services
+const defaultCheckTTL = 15 * time.Second
+
 // New returns a new file config store
 func New(tree config.Tree) (disco.Agent, error) {
 	config := &Config{}
@@ -46,6 +59,7 @@ func New(tree config.Tree) (disco.Agent, error) {
 		consulConfig: cc,
 		config:       config,
 		serviceIDs:   map[string]struct{}{},
+		checks:       map[string]context.CancelFunc{},
 	}, nil
 }
 
@@ -56,6 +70,14 @@ type Config struct {
 	Address       string   `json:"address"`
 	DC            string   `json:"dc"`
 	Token         string   `json:"token"`
+	// CheckTTL is the TTL of the health check of registered services. The
+	// check is updated every third of the TTL.
+	CheckTTL time.Duration `json:"check_ttl" default:"15s"`
+	// ElectionPrefix is the KV prefix of election keys
+	ElectionPrefix string `json:"election_prefix" default:"spine/election/"`
+	// SessionTTL is the TTL of election sessions. A leader which cannot renew
+	// its session within the TTL loses its leadership.
+	SessionTTL time.Duration `json:"session_ttl" default:"15s"`
 }
 
 type Agent struct {
@@ -68,6 +90,9 @@ type Agent struct {
 
 	// serviceIDs caches the list of services registered
 	serviceIDs map[string]struct{}
+	// checks contains the function to stop updating the health check of each
+	// registered service
+	checks map[string]context.CancelFunc
 }
 
 func (a *Agent) Register(ctx context.Context, r *disco.Registration) (string, error) {
@@ -82,6 +107,15 @@ func (a *Agent) Register(ctx context.Context, r *disco.Registration) (string, er
 	if reg.ID == "" {
 		reg.ID = uuid.New().String()
 	}
+	ttl := a.config.CheckTTL
+	if ttl <= 0 {
+		ttl = defaultCheckTTL
+	}
+	reg.Check = &api.AgentServiceCheck{
+		CheckID: checkID(reg.ID),
+		Name:    "Service readiness",
+		TTL:     ttl.String(),
+	}
 	if a.advertAddr != "" {
 		if net.ParseIP(a.advertAddr) != nil {
 			reg.Address = a.advertAddr
@@ -113,16 +147,78 @@ func (a *Agent) Register(ctx context.Context, r *disco.Registration) (string, er
 
 	a.mu.Lock()
 	a.serviceIDs[reg.ID] = struct{}{}
+	if cancel, ok := a.checks[reg.ID]; ok {
+		cancel()
+	}
+	cctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	a.checks[reg.ID] = cancel
 	a.mu.Unlock()
+
+	go a.updateCheck(cctx, reg.ID, health.FromContext(ctx), ttl/3)
 	return reg.ID, nil
 }
 
+// updateCheck reports the readiness of reg to the health check of a service
+// until ctx is done
+func (a *Agent) updateCheck(
+	ctx context.Context, id string, reg *health.Registry, interval time.Duration,
+) {
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+
+	for {
+		report := reg.Readiness(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		status := api.HealthPassing
+		switch report.Status {
+		case health.StatusWarn:
+			status = api.HealthWarning
+		case health.StatusFail:
+			status = api.HealthCritical
+		}
+		var output []string
+		for _, c := range report.Checks {
+			if c.Error != "" {
+				output = append(output, c.Name+": "+c.Error)
+			}
+		}
+
+		err := a.consul.Agent().UpdateTTL(checkID(id), strings.Join(output, "\n"), status)
+		if err != nil {
+			log.FromContext(ctx).Warning("disco.check.update_err", "Cannot update health check",
+				log.String("service_id", id),
+				log.Error(err),
+			)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+	}
+}
+
+func checkID(serviceID string) string {
+	return "service:" + serviceID + ":health"
+}
+
 func (a *Agent) Deregister(ctx context.Context, id string) error {
 	log.FromContext(ctx).Trace("disco.deregister", "Deregister service",
 		log.String("id", id),
 		log.String("adapter", "consul"),
 	)
 
+	a.mu.Lock()
+	if cancel, ok := a.checks[id]; ok {
+		cancel()
+		delete(a.checks, id)
+	}
+	a.mu.Unlock()
+
 	err := a.consul.Agent().ServiceDeregister(id)
 	if err != nil {
 		return err
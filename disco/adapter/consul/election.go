@@ -0,0 +1,258 @@
+package consul
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/deixis/spine/disco"
+	"github.com/deixis/spine/log"
+	"github.com/hashicorp/consul/api"
+	"github.com/pkg/errors"
+)
+
+// retryWait is the time to wait before retrying a failed blocking query
+const retryWait = time.Second
+
+// Campaign creates a session and acquires the election key with it. The
+// session is renewed until the leadership is resigned.
+func (a *Agent) Campaign(
+	ctx context.Context, key, id string,
+) (disco.Leadership, error) {
+	kv := a.consul.KV()
+	k := a.config.ElectionPrefix + key
+
+	session, _, err := a.consul.Session().Create(&api.SessionEntry{
+		Name:     "spine-election-" + key,
+		TTL:      a.config.SessionTTL.String(),
+		Behavior: api.SessionBehaviorRelease,
+	}, a.buildWriteOptions(ctx))
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create election session")
+	}
+
+	l := &leadership{
+		key:     key,
+		id:      id,
+		kvKey:   k,
+		session: session,
+		agent:   a,
+		lost:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go l.renew(ctx)
+
+	var waitIndex uint64
+	for {
+		acquired, _, err := kv.Acquire(&api.KVPair{
+			Key:     k,
+			Value:   []byte(id),
+			Session: session,
+		}, a.buildWriteOptions(ctx))
+		switch {
+		case err != nil:
+			l.stop()
+			return nil, errors.Wrap(err, "cannot acquire election key")
+		case acquired:
+			go l.watch(log.FromContext(ctx))
+			return l, nil
+		}
+
+		// Wait for the current leader to release the key
+		q := a.buildQueryOptions().WithContext(ctx)
+		q.WaitIndex = waitIndex
+		pair, meta, err := kv.Get(k, q)
+		if ctx.Err() != nil {
+			l.stop()
+			return nil, ctx.Err()
+		}
+		if err != nil {
+			select {
+			case <-time.After(retryWait):
+			case <-ctx.Done():
+			}
+			continue
+		}
+		waitIndex = meta.LastIndex
+		if pair == nil || pair.Session == "" {
+			// The key is free, but it can still be in its lock delay
+			select {
+			case <-time.After(retryWait):
+			case <-ctx.Done():
+			}
+		}
+	}
+}
+
+// Leader returns the candidate id stored in the election key
+func (a *Agent) Leader(ctx context.Context, key string) (string, error) {
+	pair, _, err := a.consul.KV().Get(
+		a.config.ElectionPrefix+key,
+		a.buildQueryOptions().WithContext(ctx),
+	)
+	if err != nil {
+		return "", err
+	}
+	if pair == nil || pair.Session == "" {
+		return "", nil
+	}
+	return string(pair.Value), nil
+}
+
+// Observe watches the election key with blocking queries
+func (a *Agent) Observe(ctx context.Context, key string) (<-chan string, error) {
+	c := make(chan string, 1)
+	go func() {
+		defer close(c)
+
+		var waitIndex uint64
+		leader := "?"
+		for {
+			q := a.buildQueryOptions().WithContext(ctx)
+			q.WaitIndex = waitIndex
+			pair, meta, err := a.consul.KV().Get(a.config.ElectionPrefix+key, q)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				log.FromContext(ctx).Warning("disco.election.observe_err", "Cannot observe election",
+					log.String("key", key),
+					log.Error(err),
+				)
+				select {
+				case <-time.After(retryWait):
+					continue
+				case <-ctx.Done():
+					return
+				}
+			}
+			waitIndex = meta.LastIndex
+
+			id := ""
+			if pair != nil && pair.Session != "" {
+				id = string(pair.Value)
+			}
+			if id == leader {
+				continue
+			}
+			leader = id
+
+			// Only keep the latest leader for slow observers
+			select {
+			case <-c:
+			default:
+			}
+			c <- id
+		}
+	}()
+	return c, nil
+}
+
+func (a *Agent) buildWriteOptions(ctx context.Context) *api.WriteOptions {
+	return (&api.WriteOptions{
+		Datacenter: a.consulConfig.Datacenter,
+		Token:      a.consulConfig.Token,
+	}).WithContext(ctx)
+}
+
+// leadership implements disco.Leadership
+type leadership struct {
+	key     string
+	id      string
+	kvKey   string
+	session string
+	agent   *Agent
+
+	once sync.Once
+	lost chan struct{}
+	// done stops renewing the session, which destroys it
+	done chan struct{}
+}
+
+func (l *leadership) Key() string {
+	return l.key
+}
+
+func (l *leadership) ID() string {
+	return l.id
+}
+
+func (l *leadership) Lost() <-chan struct{} {
+	return l.lost
+}
+
+func (l *leadership) Resign(ctx context.Context) error {
+	defer l.stop()
+
+	_, _, err := l.agent.consul.KV().Release(&api.KVPair{
+		Key:     l.kvKey,
+		Session: l.session,
+	}, l.agent.buildWriteOptions(ctx))
+	return err
+}
+
+// renew renews the session until the leadership stops. The leadership is lost
+// when the session cannot be renewed.
+func (l *leadership) renew(ctx context.Context) {
+	err := l.agent.consul.Session().RenewPeriodic(
+		l.agent.config.SessionTTL.String(), l.session, nil, l.done,
+	)
+	if err != nil {
+		log.FromContext(ctx).Warning("disco.election.renew_err", "Cannot renew election session",
+			log.String("key", l.key),
+			log.Error(err),
+		)
+	}
+	l.stop()
+}
+
+// watch marks the leadership as lost when the election key is no longer held
+// by its session
+func (l *leadership) watch(logger log.Logger) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-l.lost:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	var waitIndex uint64
+	for {
+		q := l.agent.buildQueryOptions().WithContext(ctx)
+		q.WaitIndex = waitIndex
+		pair, meta, err := l.agent.consul.KV().Get(l.kvKey, q)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			// The session TTL bounds the time spent without reaching Consul
+			logger.Warning("disco.election.watch_err", "Cannot watch election key",
+				log.String("key", l.key),
+				log.Error(err),
+			)
+			select {
+			case <-time.After(retryWait):
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+		waitIndex = meta.LastIndex
+
+		if pair == nil || pair.Session != l.session {
+			l.stop()
+			return
+		}
+	}
+}
+
+// stop marks the leadership as lost and destroys the session
+func (l *leadership) stop() {
+	l.once.Do(func() {
+		close(l.lost)
+		close(l.done)
+	})
+}
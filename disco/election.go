@@ -0,0 +1,198 @@
+package disco
+
+import (
+	"context"
+	"sync"
+
+	"github.com/deixis/spine/contextutil"
+	"github.com/deixis/spine/log"
+	"github.com/google/uuid"
+)
+
+// An Elector runs leader elections, so a task runs on exactly one instance.
+// Service discovery agents which support elections implement Elector.
+type Elector interface {
+	// Campaign blocks until the candidate id is elected leader of the election
+	// key, or until ctx is done.
+	Campaign(ctx context.Context, key, id string) (Leadership, error)
+	// Leader returns the candidate id of the current leader of key, or an
+	// empty string when there is no leader
+	Leader(ctx context.Context, key string) (string, error)
+	// Observe sends the candidate id of the leader of key each time it
+	// changes (empty when there is no leader). The channel is closed once ctx
+	// is done.
+	Observe(ctx context.Context, key string) (<-chan string, error)
+}
+
+// Leadership is held by an elected candidate
+type Leadership interface {
+	// Key returns the election key
+	Key() string
+	// ID returns the candidate id
+	ID() string
+	// Lost is closed when the leadership is lost or resigned
+	Lost() <-chan struct{}
+	// Resign gives up the leadership
+	Resign(ctx context.Context) error
+}
+
+// Campaign calls Campaign on the context `Elector`. The leadership is tracked
+// until it is lost, so IsLeader can gate on it. When id is empty, a random
+// candidate id is used.
+func Campaign(ctx context.Context, key, id string) (Leadership, error) {
+	if id == "" {
+		id = uuid.New().String()
+	}
+	e := ElectorFromContext(ctx)
+	l, err := e.Campaign(ctx, key, id)
+	if err != nil {
+		return nil, err
+	}
+	held.add(e, l)
+	return l, nil
+}
+
+// RunAsLeader campaigns for key and calls f once elected. The context given
+// to f carries the leadership, and it is cancelled when leadership is lost.
+// RunAsLeader campaigns again once f returns, until ctx is done.
+func RunAsLeader(
+	ctx context.Context, key, id string, f func(ctx context.Context),
+) error {
+	for {
+		l, err := Campaign(ctx, key, id)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		log.FromContext(ctx).Trace("disco.election.elected", "Elected leader",
+			log.String("key", key),
+			log.String("id", l.ID()),
+		)
+
+		lctx, cancel := context.WithCancel(LeadershipWithContext(ctx, l))
+		go func() {
+			select {
+			case <-l.Lost():
+				cancel()
+			case <-lctx.Done():
+			}
+		}()
+		f(lctx)
+		cancel()
+
+		select {
+		case <-l.Lost():
+			log.FromContext(ctx).Warning("disco.election.lost", "Leadership lost",
+				log.String("key", key),
+				log.String("id", l.ID()),
+			)
+		default:
+			if err := l.Resign(context.WithoutCancel(ctx)); err != nil {
+				log.FromContext(ctx).Warning("disco.election.resign_err", "Cannot resign",
+					log.String("key", key),
+					log.Error(err),
+				)
+			}
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+	}
+}
+
+// IsLeader returns whether this instance holds the leadership of key. It
+// checks the context leadership first, and then the leaderships acquired
+// with Campaign on the context `Elector`.
+func IsLeader(ctx contextutil.ValueContext, key string) bool {
+	if l := LeadershipFromContext(ctx); l != nil && l.Key() == key {
+		return !isLost(l)
+	}
+	l, ok := held.get(ElectorFromContext(ctx), key)
+	return ok && !isLost(l)
+}
+
+func isLost(l Leadership) bool {
+	select {
+	case <-l.Lost():
+		return true
+	default:
+		return false
+	}
+}
+
+// held tracks the leaderships acquired with Campaign until they are lost
+var held = &leaderships{m: map[Elector]map[string]Leadership{}}
+
+type leaderships struct {
+	mu sync.Mutex
+	m  map[Elector]map[string]Leadership
+}
+
+func (h *leaderships) add(e Elector, l Leadership) {
+	h.mu.Lock()
+	if h.m[e] == nil {
+		h.m[e] = map[string]Leadership{}
+	}
+	h.m[e][l.Key()] = l
+	h.mu.Unlock()
+
+	go func() {
+		<-l.Lost()
+		h.mu.Lock()
+		if h.m[e][l.Key()] == l {
+			delete(h.m[e], l.Key())
+		}
+		h.mu.Unlock()
+	}()
+}
+
+func (h *leaderships) get(e Elector, key string) (Leadership, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	l, ok := h.m[e][key]
+	return l, ok
+}
+
+type electorKey struct{}
+
+var activeElectorContextKey = electorKey{}
+
+// ElectorFromContext returns an `Elector` instance associated with `ctx`, or
+// the context `Agent` when it supports elections, or an in-process elector.
+func ElectorFromContext(ctx contextutil.ValueContext) Elector {
+	val := ctx.Value(activeElectorContextKey)
+	if o, ok := val.(Elector); ok {
+		return o
+	}
+	if o, ok := AgentFromContext(ctx).(Elector); ok {
+		return o
+	}
+	return activeLocalAgent.(Elector)
+}
+
+// ElectorWithContext returns a copy of parent in which the `Elector` is stored
+func ElectorWithContext(ctx context.Context, e Elector) context.Context {
+	return context.WithValue(ctx, activeElectorContextKey, e)
+}
+
+type leadershipKey struct{}
+
+var activeLeadershipContextKey = leadershipKey{}
+
+// LeadershipFromContext returns the `Leadership` associated with `ctx`, or
+// nil if none could be found
+func LeadershipFromContext(ctx contextutil.ValueContext) Leadership {
+	val := ctx.Value(activeLeadershipContextKey)
+	if o, ok := val.(Leadership); ok {
+		return o
+	}
+	return nil
+}
+
+// LeadershipWithContext returns a copy of parent in which the `Leadership` is
+// stored
+func LeadershipWithContext(ctx context.Context, l Leadership) context.Context {
+	return context.WithValue(ctx, activeLeadershipContextKey, l)
+}
@@ -0,0 +1,89 @@
+package disco_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/deixis/spine/disco"
+)
+
+func TestLocalElection(t *testing.T) {
+	ctx := disco.AgentWithContext(context.Background(), disco.NewLocalAgent())
+	e := disco.ElectorFromContext(ctx)
+
+	observe, cancel := context.WithCancel(ctx)
+	defer cancel()
+	leaders, err := e.Observe(observe, "cron")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id := <-leaders; id != "" {
+		t.Errorf("expect no leader, but got %s", id)
+	}
+
+	alpha, err := disco.Campaign(ctx, "cron", "alpha")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !disco.IsLeader(ctx, "cron") {
+		t.Error("expect alpha to be leader")
+	}
+	if id := <-leaders; id != "alpha" {
+		t.Errorf("expect alpha to be observed, but got %s", id)
+	}
+
+	// beta waits until alpha resigns
+	timeout, cancelTimeout := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancelTimeout()
+	if _, err := e.Campaign(timeout, "cron", "beta"); err != context.DeadlineExceeded {
+		t.Errorf("expect beta campaign to time out, but got %v", err)
+	}
+
+	betac := make(chan disco.Leadership)
+	go func() {
+		l, _ := e.Campaign(ctx, "cron", "beta")
+		betac <- l
+	}()
+	if err := alpha.Resign(ctx); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-alpha.Lost():
+	default:
+		t.Error("expect alpha leadership to be lost")
+	}
+	beta := <-betac
+	if id, _ := e.Leader(ctx, "cron"); id != "beta" {
+		t.Errorf("expect beta to be leader, but got %s", id)
+	}
+	if disco.IsLeader(ctx, "cron") {
+		t.Error("expect alpha to no longer be leader")
+	}
+	beta.Resign(ctx)
+}
+
+func TestRunAsLeader(t *testing.T) {
+	ctx, cancel := context.WithCancel(
+		disco.AgentWithContext(context.Background(), disco.NewLocalAgent()),
+	)
+	defer cancel()
+
+	ran := make(chan bool)
+	go disco.RunAsLeader(ctx, "job", "alpha", func(ctx context.Context) {
+		ran <- disco.IsLeader(ctx, "job")
+		<-ctx.Done()
+	})
+	if !<-ran {
+		t.Error("expect leadership to be on the context")
+	}
+
+	l := disco.LeadershipFromContext(ctx)
+	if l != nil {
+		t.Error("expect parent context to have no leadership")
+	}
+	id, _ := disco.ElectorFromContext(ctx).Leader(ctx, "job")
+	if id != "alpha" {
+		t.Errorf("expect alpha to be leader, but got %s", id)
+	}
+}
@@ -19,6 +19,9 @@ type agent struct {
 	Registry map[string]*Instance
 	// subs contains all event subscriptions
 	Subs map[chan *Event]struct{}
+
+	// elections contains the in-process elections by key
+	elections *localElections
 }
 
 // NewLocalAgent returns a new local-only service discovery agent. This agent
@@ -27,6 +30,9 @@ func NewLocalAgent() Agent {
 	return &agent{
 		Registry: map[string]*Instance{},
 		Subs:     map[chan *Event]struct{}{},
+		elections: &localElections{
+			m: map[string]*localElection{},
+		},
 	}
 }
 
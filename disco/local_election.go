@@ -0,0 +1,143 @@
+package disco
+
+import (
+	"context"
+	"sync"
+)
+
+// localElections runs in-process elections. It is used by the local agent,
+// so elections still work (within one process) when service discovery is
+// disabled.
+type localElections struct {
+	mu sync.Mutex
+	m  map[string]*localElection
+}
+
+type localElection struct {
+	leader *localLeadership
+	// released is closed when the leader resigns
+	released  chan struct{}
+	observers map[chan string]struct{}
+}
+
+func (a *agent) Campaign(ctx context.Context, key, id string) (Leadership, error) {
+	e := a.elections
+	for {
+		e.mu.Lock()
+		el := e.get(key)
+		if el.leader == nil {
+			l := &localLeadership{
+				key:       key,
+				id:        id,
+				elections: e,
+				lost:      make(chan struct{}),
+			}
+			el.leader = l
+			el.released = make(chan struct{})
+			el.notify(id)
+			e.mu.Unlock()
+			return l, nil
+		}
+		released := el.released
+		e.mu.Unlock()
+
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (a *agent) Leader(ctx context.Context, key string) (string, error) {
+	e := a.elections
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if el, ok := e.m[key]; ok && el.leader != nil {
+		return el.leader.id, nil
+	}
+	return "", nil
+}
+
+func (a *agent) Observe(ctx context.Context, key string) (<-chan string, error) {
+	e := a.elections
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	c := make(chan string, 1)
+	el := e.get(key)
+	el.observers[c] = struct{}{}
+	if el.leader != nil {
+		c <- el.leader.id
+	} else {
+		c <- ""
+	}
+
+	go func() {
+		<-ctx.Done()
+		e.mu.Lock()
+		delete(el.observers, c)
+		close(c)
+		e.mu.Unlock()
+	}()
+	return c, nil
+}
+
+// get returns the election of key. The caller must hold the lock.
+func (e *localElections) get(key string) *localElection {
+	el, ok := e.m[key]
+	if !ok {
+		el = &localElection{observers: map[chan string]struct{}{}}
+		e.m[key] = el
+	}
+	return el
+}
+
+// notify sends the leader to observers. A slow observer only receives the
+// latest leader. The caller must hold the lock.
+func (el *localElection) notify(id string) {
+	for c := range el.observers {
+		select {
+		case <-c:
+		default:
+		}
+		c <- id
+	}
+}
+
+// localLeadership implements Leadership
+type localLeadership struct {
+	key       string
+	id        string
+	elections *localElections
+	lost      chan struct{}
+}
+
+func (l *localLeadership) Key() string {
+	return l.key
+}
+
+func (l *localLeadership) ID() string {
+	return l.id
+}
+
+func (l *localLeadership) Lost() <-chan struct{} {
+	return l.lost
+}
+
+func (l *localLeadership) Resign(ctx context.Context) error {
+	e := l.elections
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	el := e.get(l.key)
+	if el.leader != l {
+		return nil
+	}
+	el.leader = nil
+	close(l.lost)
+	close(el.released)
+	el.notify("")
+	return nil
+}
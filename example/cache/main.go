@@ -69,7 +69,7 @@ func main() {
 	}
 	s := http.NewServer()
 	s.HandleFunc("/cache/{key}", http.GET, h.Load)
-	app.RegisterServer("127.0.0.1:3000", s)
+	app.RegisterServer("127.0.0.1:"+os.Getenv("HTTP_PORT"), s)
 
 	// Start serving requests
 	err = app.Serve()
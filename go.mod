@@ -5,6 +5,7 @@ go 1.21
 require (
 	cloud.google.com/go/logging v1.8.1
 	github.com/fatih/color v1.13.0
+	github.com/fsnotify/fsnotify v1.7.0
 	github.com/google/uuid v1.3.0
 	github.com/gorilla/mux v1.8.0
 	github.com/hashicorp/consul/api v1.14.0
@@ -20,6 +21,7 @@ require (
 	google.golang.org/grpc v1.56.3
 	google.golang.org/protobuf v1.31.0
 	gopkg.in/DataDog/dd-trace-go.v1 v1.42.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -0,0 +1,16 @@
+// Package health aggregates health checks into liveness and readiness.
+//
+// Components register named checks on the context registry. Checks are
+// critical readiness checks by default.
+//
+//	health.Register(ctx, "db", func(ctx context.Context) error {
+//		return db.PingContext(ctx)
+//	}, health.WithTimeout(time.Second))
+//
+// Liveness tells whether the app must be restarted, and readiness whether it
+// can receive traffic. Readiness fails as soon as the app starts draining.
+//
+// Health is reported on the admin server (/health/live and /health/ready), as
+// the grpc.health.v1 service on net/grpc servers, and as a TTL check on
+// services registered with Consul.
+package health
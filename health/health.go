@@ -0,0 +1,293 @@
+package health
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/deixis/spine/contextutil"
+	"github.com/pkg/errors"
+)
+
+// Status is the result of a health check
+type Status string
+
+const (
+	// StatusPass means the check is healthy
+	StatusPass Status = "pass"
+	// StatusWarn means a non-critical check is failing
+	StatusWarn Status = "warn"
+	// StatusFail means a critical check is failing
+	StatusFail Status = "fail"
+)
+
+// ErrDraining is the readiness error reported while the app is draining
+var ErrDraining = errors.New("draining")
+
+const defaultTimeout = 5 * time.Second
+
+// CheckFunc checks the health of a component (e.g. the DB is reachable). It
+// returns an error when the component is unhealthy.
+type CheckFunc func(ctx context.Context) error
+
+// CheckOption configures a check
+type CheckOption func(*CheckOptions)
+
+// CheckOptions configure a check. CheckOptions are set by the CheckOption
+// values passed to Register.
+type CheckOptions struct {
+	// Timeout is the maximum duration of the check
+	Timeout time.Duration
+	// Critical checks fail readiness, whereas non-critical checks only warn
+	Critical bool
+	// Liveness checks are also part of liveness. A failing liveness check
+	// means the app must be restarted.
+	Liveness bool
+}
+
+// WithTimeout sets the maximum duration of a check (5s by default)
+func WithTimeout(d time.Duration) CheckOption {
+	return func(o *CheckOptions) {
+		o.Timeout = d
+	}
+}
+
+// NonCritical makes a check warn instead of failing readiness
+func NonCritical() CheckOption {
+	return func(o *CheckOptions) {
+		o.Critical = false
+	}
+}
+
+// Liveness adds a check to liveness
+func Liveness() CheckOption {
+	return func(o *CheckOptions) {
+		o.Liveness = true
+	}
+}
+
+// Result is the result of a check
+type Result struct {
+	Name     string        `json:"name"`
+	Status   Status        `json:"status"`
+	Critical bool          `json:"critical"`
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration"`
+}
+
+// Report aggregates the results of several checks
+type Report struct {
+	Status Status   `json:"status"`
+	Checks []Result `json:"checks"`
+}
+
+// Healthy returns whether the report does not fail
+func (r *Report) Healthy() bool {
+	return r.Status != StatusFail
+}
+
+type check struct {
+	name string
+	f    CheckFunc
+	opts CheckOptions
+}
+
+// Registry holds the health checks of an app
+type Registry struct {
+	mu sync.RWMutex
+
+	checks   map[string]*check
+	draining bool
+}
+
+// NewRegistry returns a new health check registry
+func NewRegistry() *Registry {
+	return &Registry{
+		checks: map[string]*check{},
+	}
+}
+
+// Register adds a named check. Checks are critical readiness checks unless
+// options say otherwise. A check registered with an existing name replaces it.
+func (r *Registry) Register(name string, f CheckFunc, o ...CheckOption) {
+	opts := CheckOptions{
+		Timeout:  defaultTimeout,
+		Critical: true,
+	}
+	for _, o := range o {
+		o(&opts)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checks[name] = &check{name: name, f: f, opts: opts}
+}
+
+// Deregister removes a check
+func (r *Registry) Deregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.checks, name)
+}
+
+// Drain flips readiness to failing
+func (r *Registry) Drain() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.draining = true
+}
+
+// Draining returns whether the registry is draining
+func (r *Registry) Draining() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.draining
+}
+
+// Liveness runs the liveness checks. A failing liveness means the app should
+// be restarted.
+func (r *Registry) Liveness(ctx context.Context) *Report {
+	r.mu.RLock()
+	var l []*check
+	for _, c := range r.checks {
+		if c.opts.Liveness {
+			l = append(l, c)
+		}
+	}
+	r.mu.RUnlock()
+
+	return run(ctx, l)
+}
+
+// Readiness runs all checks. A failing readiness means the app should not
+// receive traffic. Readiness fails as soon as the registry is draining.
+func (r *Registry) Readiness(ctx context.Context) *Report {
+	r.mu.RLock()
+	draining := r.draining
+	l := make([]*check, 0, len(r.checks))
+	for _, c := range r.checks {
+		l = append(l, c)
+	}
+	r.mu.RUnlock()
+
+	report := run(ctx, l)
+	if draining {
+		report.Status = StatusFail
+		report.Checks = append([]Result{{
+			Name:     "drain",
+			Status:   StatusFail,
+			Critical: true,
+			Error:    ErrDraining.Error(),
+		}}, report.Checks...)
+	}
+	return report
+}
+
+// Check runs the check with the given name
+func (r *Registry) Check(ctx context.Context, name string) (*Result, bool) {
+	r.mu.RLock()
+	c, ok := r.checks[name]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, false
+	}
+
+	res := c.run(ctx)
+	return &res, true
+}
+
+// run runs all checks concurrently
+func run(ctx context.Context, l []*check) *Report {
+	report := &Report{
+		Status: StatusPass,
+		Checks: make([]Result, len(l)),
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(len(l))
+	for i, c := range l {
+		go func(i int, c *check) {
+			defer wg.Done()
+			report.Checks[i] = c.run(ctx)
+		}(i, c)
+	}
+	wg.Wait()
+
+	sort.Slice(report.Checks, func(i, j int) bool {
+		return report.Checks[i].Name < report.Checks[j].Name
+	})
+	for _, res := range report.Checks {
+		switch {
+		case res.Status == StatusFail:
+			report.Status = StatusFail
+		case res.Status == StatusWarn && report.Status == StatusPass:
+			report.Status = StatusWarn
+		}
+	}
+	return report
+}
+
+func (c *check) run(ctx context.Context) Result {
+	ctx, cancel := context.WithTimeout(ctx, c.opts.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	errc := make(chan error, 1)
+	go func() {
+		defer func() {
+			if recover := recover(); recover != nil {
+				errc <- errors.Errorf("check panic: %v", recover)
+			}
+		}()
+		errc <- c.f(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-errc:
+	case <-ctx.Done():
+		err = errors.Wrap(ctx.Err(), "check timed out")
+	}
+
+	res := Result{
+		Name:     c.name,
+		Status:   StatusPass,
+		Critical: c.opts.Critical,
+		Duration: time.Since(start),
+	}
+	if err != nil {
+		res.Error = err.Error()
+		res.Status = StatusWarn
+		if c.opts.Critical {
+			res.Status = StatusFail
+		}
+	}
+	return res
+}
+
+// Register calls `Register` on the context `Registry`
+func Register(ctx context.Context, name string, f CheckFunc, o ...CheckOption) {
+	FromContext(ctx).Register(name, f, o...)
+}
+
+type contextKey struct{}
+
+var activeContextKey = contextKey{}
+
+var defaultRegistry = NewRegistry()
+
+// FromContext returns a `Registry` instance associated with `ctx`, or
+// a default `Registry` if no existing `Registry` instance could be found.
+func FromContext(ctx contextutil.ValueContext) *Registry {
+	val := ctx.Value(activeContextKey)
+	if o, ok := val.(*Registry); ok {
+		return o
+	}
+	return defaultRegistry
+}
+
+// WithContext returns a copy of parent in which `Registry` is stored
+func WithContext(ctx context.Context, r *Registry) context.Context {
+	return context.WithValue(ctx, activeContextKey, r)
+}
@@ -0,0 +1,99 @@
+package health_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/deixis/spine/health"
+)
+
+func TestReadiness(t *testing.T) {
+	reg := health.NewRegistry()
+	ctx := context.Background()
+
+	if r := reg.Readiness(ctx); r.Status != health.StatusPass {
+		t.Errorf("expect empty registry to pass, but got %s", r.Status)
+	}
+
+	reg.Register("db", func(ctx context.Context) error { return nil })
+	reg.Register("search", func(ctx context.Context) error {
+		return errors.New("unreachable")
+	}, health.NonCritical())
+	r := reg.Readiness(ctx)
+	if r.Status != health.StatusWarn || !r.Healthy() {
+		t.Errorf("expect non-critical failure to warn, but got %s", r.Status)
+	}
+	if len(r.Checks) != 2 || r.Checks[1].Error != "unreachable" {
+		t.Errorf("unexpected checks %+v", r.Checks)
+	}
+
+	reg.Register("db", func(ctx context.Context) error {
+		<-ctx.Done()
+		return nil
+	}, health.WithTimeout(10*time.Millisecond))
+	r = reg.Readiness(ctx)
+	if r.Status != health.StatusFail || r.Healthy() {
+		t.Errorf("expect critical timeout to fail, but got %s", r.Status)
+	}
+
+	reg.Deregister("db")
+	reg.Deregister("search")
+	reg.Drain()
+	r = reg.Readiness(ctx)
+	if r.Status != health.StatusFail || r.Checks[0].Error != health.ErrDraining.Error() {
+		t.Errorf("expect readiness to fail while draining, but got %+v", r)
+	}
+	if r := reg.Liveness(ctx); r.Status != health.StatusPass {
+		t.Errorf("expect liveness to pass while draining, but got %s", r.Status)
+	}
+}
+
+func TestLiveness(t *testing.T) {
+	reg := health.NewRegistry()
+	ctx := context.Background()
+
+	reg.Register("db", func(ctx context.Context) error {
+		return errors.New("unreachable")
+	})
+	reg.Register("deadlock", func(ctx context.Context) error {
+		panic("deadlock")
+	}, health.Liveness())
+
+	r := reg.Liveness(ctx)
+	if r.Status != health.StatusFail || len(r.Checks) != 1 || r.Checks[0].Name != "deadlock" {
+		t.Errorf("expect liveness to run liveness checks only, but got %+v", r)
+	}
+	if _, ok := reg.Check(ctx, "unknown"); ok {
+		t.Error("expect unknown check to be not found")
+	}
+}
+
+func TestHandler(t *testing.T) {
+	reg := health.NewRegistry()
+	reg.Register("db", func(ctx context.Context) error { return nil })
+
+	w := httptest.NewRecorder()
+	reg.ReadinessHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("expect status 200, but got %d", w.Code)
+	}
+	var r health.Report
+	if err := json.Unmarshal(w.Body.Bytes(), &r); err != nil {
+		t.Fatal(err)
+	}
+	if r.Status != health.StatusPass || len(r.Checks) != 1 {
+		t.Errorf("unexpected report %+v", r)
+	}
+
+	reg.Drain()
+	w = httptest.NewRecorder()
+	reg.ReadinessHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expect status 503 while draining, but got %d", w.Code)
+	}
+}
@@ -1,35 +1,21 @@
 package spine
 
-import "time"
+import (
+	"context"
+	"time"
+)
 
-// heartbeat sends a heartbeat to stats periodically
-type hearbeat struct {
-	app  *App
-	stop chan bool
-}
-
-// Start starts sending a heartbeat
-func (h *hearbeat) Start() {
-	h.stop = make(chan bool, 1)
+// heartbeatInterval is the interval between two heartbeats
+const heartbeatInterval = 5 * time.Second
 
-	tick := time.Tick(5 * time.Second)
-	for {
-		select {
-		case <-h.stop:
-			break
-		case <-tick:
-			tags := map[string]string{
-				"service": h.app.service,
-				"node":    h.app.config.Node,
-				"version": h.app.config.Version,
-			}
-
-			h.app.Stats().Histogram("heartbeat", 1, tags)
-		}
+// heartbeat sends a heartbeat to stats
+func (a *App) heartbeat(ctx context.Context) error {
+	tags := map[string]string{
+		"service": a.service,
+		"node":    a.config.Node,
+		"version": a.config.Version,
 	}
-}
 
-// Stop stops sending a heartbeat
-func (h *hearbeat) Stop() {
-	h.stop <- true
+	a.Stats().Histogram("heartbeat", 1, tags)
+	return nil
 }
@@ -0,0 +1,10 @@
+// Package lifecycle starts and stops app components in dependency order.
+//
+// Components (e.g. DB pools, consumers) declare the components they depend
+// on. They are started in topological order before the app serves requests,
+// and stopped in reverse order once the app has drained. Each step has a
+// timeout, so a component which hangs is reported instead of blocking the app.
+//
+//	app.RegisterComponent("db", db)
+//	app.RegisterComponent("consumer", consumer, lifecycle.DependsOn("db"))
+package lifecycle
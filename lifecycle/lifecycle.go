@@ -0,0 +1,307 @@
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/deixis/spine/log"
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultStartTimeout = 30 * time.Second
+	defaultStopTimeout  = 30 * time.Second
+)
+
+var (
+	// ErrDup occurs when a component name has already been registered
+	ErrDup = errors.New("component has already been registered")
+	// ErrStarted occurs when a component is registered after Start
+	ErrStarted = errors.New("components have already been started")
+	// ErrTimeout occurs when a component does not start or stop in time
+	ErrTimeout = errors.New("component hung")
+)
+
+// Component is a part of an app which must be started before serving, and
+// stopped after
+type Component interface {
+	Start(ctx context.Context) error
+	Stop(ctx context.Context) error
+}
+
+// Option configures a component
+type Option func(*Options)
+
+// Options configure a component. Options are set by the Option values passed
+// to Register.
+type Options struct {
+	// DependsOn contains the names of the components which must be started
+	// before this component, and stopped after
+	DependsOn []string
+	// StartTimeout is the maximum duration of Start
+	StartTimeout time.Duration
+	// StopTimeout is the maximum duration of Stop
+	StopTimeout time.Duration
+}
+
+// DependsOn declares the components which must be started before this one
+func DependsOn(names ...string) Option {
+	return func(o *Options) {
+		o.DependsOn = append(o.DependsOn, names...)
+	}
+}
+
+// WithStartTimeout sets the maximum duration of Start (30s by default)
+func WithStartTimeout(d time.Duration) Option {
+	return func(o *Options) {
+		o.StartTimeout = d
+	}
+}
+
+// WithStopTimeout sets the maximum duration of Stop (30s by default)
+func WithStopTimeout(d time.Duration) Option {
+	return func(o *Options) {
+		o.StopTimeout = d
+	}
+}
+
+// StepError reports the component which failed or hung
+type StepError struct {
+	// Component is the component name
+	Component string
+	// Step is either start or stop
+	Step string
+	Err  error
+}
+
+func (e *StepError) Error() string {
+	return fmt.Sprintf("component <%s> failed to %s: %s", e.Component, e.Step, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *StepError) Unwrap() error {
+	return e.Err
+}
+
+// StopError contains all errors which occurred when stopping components
+type StopError struct {
+	Errors []*StepError
+}
+
+func (e *StopError) Error() string {
+	l := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		l[i] = err.Error()
+	}
+	return strings.Join(l, "; ")
+}
+
+type component struct {
+	name string
+	c    Component
+	opts Options
+}
+
+// Manager starts components in dependency order and stops them in reverse
+// order
+type Manager struct {
+	mu sync.Mutex
+
+	log        log.Logger
+	components map[string]*component
+	// started contains the components started, in start order
+	started []*component
+	running bool
+}
+
+// NewManager returns a new component manager
+func NewManager(l log.Logger) *Manager {
+	return &Manager{
+		log:        l,
+		components: map[string]*component{},
+	}
+}
+
+// Register adds a named component
+func (m *Manager) Register(name string, c Component, o ...Option) error {
+	opts := Options{
+		StartTimeout: defaultStartTimeout,
+		StopTimeout:  defaultStopTimeout,
+	}
+	for _, o := range o {
+		o(&opts)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.running {
+		return ErrStarted
+	}
+	if _, ok := m.components[name]; ok {
+		return ErrDup
+	}
+	m.components[name] = &component{name: name, c: c, opts: opts}
+	return nil
+}
+
+// Order returns the component names in start order. It fails when a
+// dependency is missing or when dependencies are cyclic.
+func (m *Manager) Order() ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	l, err := m.order()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(l))
+	for i, c := range l {
+		names[i] = c.name
+	}
+	return names, nil
+}
+
+// order sorts components topologically. Independent components are sorted
+// by name, so the order is stable.
+func (m *Manager) order() ([]*component, error) {
+	names := make([]string, 0, len(m.components))
+	for name := range m.components {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := map[string]int{}
+	var l []*component
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		c, ok := m.components[name]
+		if !ok {
+			return errors.Errorf("component <%s> depends on unknown component <%s>", path[len(path)-1], name)
+		}
+		switch state[name] {
+		case visiting:
+			return errors.Errorf("cyclic component dependencies (%s)", strings.Join(append(path, name), " -> "))
+		case visited:
+			return nil
+		}
+
+		state[name] = visiting
+		deps := append([]string{}, c.opts.DependsOn...)
+		sort.Strings(deps)
+		for _, dep := range deps {
+			if err := visit(dep, append(path, name)); err != nil {
+				return err
+			}
+		}
+		state[name] = visited
+		l = append(l, c)
+		return nil
+	}
+	for _, name := range names {
+		if err := visit(name, nil); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// Start starts all components in dependency order. When a component fails,
+// the components already started are stopped and a *StepError is returned.
+func (m *Manager) Start(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.running {
+		return ErrStarted
+	}
+
+	l, err := m.order()
+	if err != nil {
+		return err
+	}
+	m.running = true
+
+	for _, c := range l {
+		m.log.Trace("lifecycle.start", "Start component",
+			log.String("component", c.name),
+		)
+		err := step(ctx, c.opts.StartTimeout, c.c.Start)
+		if err != nil {
+			serr := &StepError{Component: c.name, Step: "start", Err: err}
+			m.log.Error("lifecycle.start_err", "Component failed to start",
+				log.String("component", c.name),
+				log.Error(err),
+			)
+			m.stop(ctx)
+			return serr
+		}
+		m.started = append(m.started, c)
+	}
+	return nil
+}
+
+// Stop stops the started components in reverse order. All components are
+// stopped even when one fails, and a *StopError reports all failures.
+func (m *Manager) Stop(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.stop(ctx)
+}
+
+func (m *Manager) stop(ctx context.Context) error {
+	var errs []*StepError
+	for i := len(m.started) - 1; i >= 0; i-- {
+		c := m.started[i]
+		m.log.Trace("lifecycle.stop", "Stop component",
+			log.String("component", c.name),
+		)
+		if err := step(ctx, c.opts.StopTimeout, c.c.Stop); err != nil {
+			m.log.Error("lifecycle.stop_err", "Component failed to stop",
+				log.String("component", c.name),
+				log.Error(err),
+			)
+			errs = append(errs, &StepError{Component: c.name, Step: "stop", Err: err})
+		}
+	}
+	m.started = nil
+	m.running = false
+
+	if len(errs) > 0 {
+		return &StopError{Errors: errs}
+	}
+	return nil
+}
+
+// step calls f and waits at most timeout for it to return
+func step(ctx context.Context, timeout time.Duration, f func(context.Context) error) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	errc := make(chan error, 1)
+	go func() {
+		defer func() {
+			if recover := recover(); recover != nil {
+				errc <- errors.Errorf("panic: %v", recover)
+			}
+		}()
+		errc <- f(ctx)
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+		if ctx.Err() == context.DeadlineExceeded {
+			return errors.Wrapf(ErrTimeout, "no response after %s", timeout)
+		}
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,127 @@
+package lifecycle_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/deixis/spine/lifecycle"
+	lt "github.com/deixis/spine/testing"
+)
+
+// events records component events. Steps which time out keep running in
+// background, so events may be added concurrently.
+type events struct {
+	mu   sync.Mutex
+	list []string
+}
+
+func (e *events) add(s string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.list = append(e.list, s)
+}
+
+func (e *events) get() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]string{}, e.list...)
+}
+
+type component struct {
+	name   string
+	events *events
+	start  func(ctx context.Context) error
+}
+
+func (c *component) Start(ctx context.Context) error {
+	c.events.add("start " + c.name)
+	if c.start != nil {
+		return c.start(ctx)
+	}
+	return nil
+}
+
+func (c *component) Stop(ctx context.Context) error {
+	c.events.add("stop " + c.name)
+	return nil
+}
+
+func TestOrder(t *testing.T) {
+	var events events
+	m := lifecycle.NewManager(lt.NewLogger(t, false))
+	m.Register("consumer", &component{name: "consumer", events: &events},
+		lifecycle.DependsOn("db", "cache"),
+	)
+	m.Register("db", &component{name: "db", events: &events})
+	m.Register("cache", &component{name: "cache", events: &events},
+		lifecycle.DependsOn("db"),
+	)
+	if err := m.Register("db", &component{}); err != lifecycle.ErrDup {
+		t.Errorf("expect ErrDup, but got %v", err)
+	}
+
+	ctx := context.Background()
+	if err := m.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []string{
+		"start db", "start cache", "start consumer",
+		"stop consumer", "stop cache", "stop db",
+	}
+	if !reflect.DeepEqual(expect, events.get()) {
+		t.Errorf("expect events %v, but got %v", expect, events.get())
+	}
+}
+
+func TestInvalidDependencies(t *testing.T) {
+	m := lifecycle.NewManager(lt.NewLogger(t, false))
+	m.Register("a", &component{}, lifecycle.DependsOn("b"))
+	if _, err := m.Order(); err == nil || !strings.Contains(err.Error(), "unknown component <b>") {
+		t.Errorf("expect unknown dependency error, but got %v", err)
+	}
+
+	m.Register("b", &component{}, lifecycle.DependsOn("a"))
+	if _, err := m.Order(); err == nil || !strings.Contains(err.Error(), "a -> b -> a") {
+		t.Errorf("expect cycle error, but got %v", err)
+	}
+}
+
+func TestStartFailure(t *testing.T) {
+	var events events
+	m := lifecycle.NewManager(lt.NewLogger(t, false))
+	m.Register("db", &component{name: "db", events: &events})
+	m.Register("consumer", &component{
+		name:   "consumer",
+		events: &events,
+		start: func(ctx context.Context) error {
+			<-ctx.Done()
+			return nil
+		},
+	}, lifecycle.DependsOn("db"), lifecycle.WithStartTimeout(10*time.Millisecond))
+
+	err := m.Start(context.Background())
+	var serr *lifecycle.StepError
+	if !errors.As(err, &serr) {
+		t.Fatalf("expect StepError, but got %v", err)
+	}
+	if serr.Component != "consumer" || serr.Step != "start" {
+		t.Errorf("expect consumer to fail on start, but got %s/%s", serr.Component, serr.Step)
+	}
+	if !errors.Is(err, lifecycle.ErrTimeout) {
+		t.Errorf("expect ErrTimeout, but got %v", err)
+	}
+
+	expect := []string{"start db", "start consumer", "stop db"}
+	if !reflect.DeepEqual(expect, events.get()) {
+		t.Errorf("expect events %v, but got %v", expect, events.get())
+	}
+}
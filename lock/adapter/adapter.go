@@ -0,0 +1,84 @@
+package adapter
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/deixis/spine/config"
+	"github.com/deixis/spine/lock"
+	"github.com/deixis/spine/lock/adapter/bolt"
+	"github.com/deixis/spine/lock/adapter/consul"
+)
+
+// MemoryName is the in-memory locker adapter name
+const MemoryName = "memory"
+
+// Adapter returns a new locker initialised with the given config
+type Adapter func(config.Tree) (lock.Locker, error)
+
+var (
+	mu       sync.RWMutex
+	adapters = make(map[string]Adapter)
+)
+
+func init() {
+	// Register default adapters
+	Register(bolt.Name, bolt.New)
+	Register(consul.Name, consul.New)
+	Register(MemoryName, func(config.Tree) (lock.Locker, error) {
+		return lock.NewMemory(), nil
+	})
+}
+
+// Adapters returns the list of registered adapters
+func Adapters() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	var l []string
+	for a := range adapters {
+		l = append(l, a)
+	}
+
+	sort.Strings(l)
+
+	return l
+}
+
+// Register makes a lock adapter available by the provided name.
+// If an adapter is registered twice or if an adapter is nil, it will panic.
+func Register(name string, adapter Adapter) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if adapter == nil {
+		panic("lock: Registered adapter is nil")
+	}
+	if _, dup := adapters[name]; dup {
+		panic("lock: Duplicated adapter")
+	}
+
+	adapters[name] = adapter
+}
+
+// New creates a new locker
+func New(config config.Tree) (lock.Locker, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	keys := config.Keys()
+	if len(keys) == 0 {
+		return nil, ErrEmptyConfig
+	}
+	adapter := keys[0]
+
+	if f, ok := adapters[adapter]; ok {
+		return f(config.Get(adapter))
+	}
+	return nil, fmt.Errorf("lock adapter not found <%s>", adapter)
+}
+
+// ErrEmptyConfig occurs when initialising a locker from an empty config tree
+var ErrEmptyConfig = errors.New("lock config tree is empty")
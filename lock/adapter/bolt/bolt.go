@@ -0,0 +1,179 @@
+// Package bolt provides a locker which persists leases in a bbolt database.
+//
+// Leases survive a restart of the process, but they are only shared within a
+// single process, because bbolt locks the database file exclusively. Use it
+// for single-process setups, like the local scheduler.
+package bolt
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"time"
+
+	"github.com/deixis/spine/config"
+	"github.com/deixis/spine/lock"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Name contains the adapter registered name
+const Name = "bolt"
+
+const dbFileMod = 0600
+
+var (
+	leaseBucket = []byte("lease")
+	tokenBucket = []byte("token")
+)
+
+// Config is the bolt locker configuration
+type Config struct {
+	// DB is the path to the database file
+	DB string `toml:"db" default:"lock.bolt.db"`
+}
+
+// New returns a locker backed by a bbolt database
+func New(tree config.Tree) (lock.Locker, error) {
+	c := Config{}
+	if err := tree.Unmarshal(&c); err != nil {
+		return nil, err
+	}
+	return Open(c.DB)
+}
+
+// Open opens the bbolt database at path and returns a locker backed by it
+func Open(path string) (lock.Locker, error) {
+	db, err := bolt.Open(path, dbFileMod, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot open lock database <%s>", path)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, b := range [][]byte{leaseBucket, tokenBucket} {
+			if _, err := tx.CreateBucketIfNotExists(b); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, errors.Wrap(err, "cannot create lock buckets")
+	}
+	return &locker{db: db}, nil
+}
+
+type locker struct {
+	db *bolt.DB
+}
+
+func (l *locker) TryAcquire(
+	ctx context.Context, key string, ttl time.Duration,
+) (lock.Handle, error) {
+	h := &handle{
+		db:    l.db,
+		key:   []byte(key),
+		owner: []byte(uuid.New().String()),
+	}
+	err := l.db.Update(func(tx *bolt.Tx) error {
+		now := time.Now()
+		leases := tx.Bucket(leaseBucket)
+		if r, ok := decode(leases.Get(h.key)); ok && now.Before(r.expires) {
+			return lock.ErrLocked
+		}
+
+		tokens := tx.Bucket(tokenBucket)
+		var token uint64
+		if v := tokens.Get(h.key); len(v) == 8 {
+			token = binary.BigEndian.Uint64(v)
+		}
+		token++
+		if err := tokens.Put(h.key, binary.BigEndian.AppendUint64(nil, token)); err != nil {
+			return err
+		}
+		h.token = token
+
+		return leases.Put(h.key, encode(record{
+			token:   token,
+			expires: now.Add(ttl),
+			owner:   h.owner,
+		}))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// LockedFile returns the path of the database file, which bbolt locks
+// exclusively until the locker is closed
+func (l *locker) LockedFile() string {
+	return l.db.Path()
+}
+
+func (l *locker) Close() error {
+	return l.db.Close()
+}
+
+// handle implements lock.Handle
+type handle struct {
+	db    *bolt.DB
+	key   []byte
+	owner []byte
+	token uint64
+}
+
+func (h *handle) Token() uint64 {
+	return h.token
+}
+
+func (h *handle) Renew(ctx context.Context, ttl time.Duration) error {
+	return h.db.Update(func(tx *bolt.Tx) error {
+		now := time.Now()
+		leases := tx.Bucket(leaseBucket)
+		r, ok := decode(leases.Get(h.key))
+		if !ok || !bytes.Equal(r.owner, h.owner) || now.After(r.expires) {
+			return lock.ErrLost
+		}
+		r.expires = now.Add(ttl)
+		return leases.Put(h.key, encode(r))
+	})
+}
+
+func (h *handle) Release(ctx context.Context) error {
+	return h.db.Update(func(tx *bolt.Tx) error {
+		leases := tx.Bucket(leaseBucket)
+		r, ok := decode(leases.Get(h.key))
+		if !ok || !bytes.Equal(r.owner, h.owner) {
+			return nil
+		}
+		return leases.Delete(h.key)
+	})
+}
+
+// record is a lease stored as token (8 bytes), expiry in unix ns (8 bytes)
+// and owner
+type record struct {
+	token   uint64
+	expires time.Time
+	owner   []byte
+}
+
+func encode(r record) []byte {
+	b := make([]byte, 16, 16+len(r.owner))
+	binary.BigEndian.PutUint64(b, r.token)
+	binary.BigEndian.PutUint64(b[8:], uint64(r.expires.UnixNano()))
+	return append(b, r.owner...)
+}
+
+func decode(b []byte) (record, bool) {
+	if len(b) < 16 {
+		return record{}, false
+	}
+	return record{
+		token:   binary.BigEndian.Uint64(b),
+		expires: time.Unix(0, int64(binary.BigEndian.Uint64(b[8:]))),
+		owner:   append([]byte{}, b[16:]...),
+	}, true
+}
@@ -0,0 +1,52 @@
+package bolt_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/deixis/spine/lock"
+	"github.com/deixis/spine/lock/adapter/bolt"
+)
+
+func TestBolt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lock.db")
+	l, err := bolt.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	a, err := l.TryAcquire(ctx, "tenant", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.TryAcquire(ctx, "tenant", time.Minute); err != lock.ErrLocked {
+		t.Errorf("expect ErrLocked, but got %v", err)
+	}
+	if err := a.Renew(ctx, time.Minute); err != nil {
+		t.Errorf("expect lease to be renewed, but got %v", err)
+	}
+	if err := a.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Renew(ctx, time.Minute); err != lock.ErrLost {
+		t.Errorf("expect released lease to be lost, but got %v", err)
+	}
+
+	// Tokens survive a restart
+	l.Close()
+	l, err = bolt.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	b, err := l.TryAcquire(ctx, "tenant", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Token() != a.Token()+1 {
+		t.Errorf("expect token %d, but got %d", a.Token()+1, b.Token())
+	}
+}
@@ -0,0 +1,148 @@
+// Package consul provides a locker backed by Consul KV.
+//
+// Each lease is a Consul session which holds the lock of a KV key. The
+// fencing token is the key lock index, which Consul increments each time the
+// key is acquired.
+//
+// Consul sessions last at least 10s, so shorter leases are rejected with
+// lock.ErrTTL. Once a lease is lost, Consul also waits for the session
+// lock-delay (15s by default) before the key can be acquired again.
+package consul
+
+import (
+	"context"
+	"time"
+
+	"github.com/deixis/spine/config"
+	"github.com/deixis/spine/lock"
+	"github.com/hashicorp/consul/api"
+	"github.com/pkg/errors"
+)
+
+// Name contains the adapter registered name
+const Name = "consul"
+
+// minSessionTTL is the minimum session TTL accepted by Consul
+const minSessionTTL = 10 * time.Second
+
+// Config contains the configuration to connect to Consul
+type Config struct {
+	Address string `toml:"address"`
+	DC      string `toml:"dc"`
+	Token   string `toml:"token"`
+	// Prefix is the KV prefix of lock keys
+	Prefix string `toml:"prefix" default:"spine/lock/"`
+}
+
+// New returns a locker backed by Consul KV
+func New(tree config.Tree) (lock.Locker, error) {
+	c := Config{}
+	if err := tree.Unmarshal(&c); err != nil {
+		return nil, err
+	}
+
+	cc := api.DefaultConfig()
+	cc.Address = c.Address
+	cc.Datacenter = c.DC
+	cc.Token = c.Token
+	client, err := api.NewClient(cc)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot initialise Consul client")
+	}
+	return &locker{consul: client, prefix: c.Prefix}, nil
+}
+
+type locker struct {
+	consul *api.Client
+	prefix string
+}
+
+func (l *locker) TryAcquire(
+	ctx context.Context, key string, ttl time.Duration,
+) (lock.Handle, error) {
+	if ttl < minSessionTTL {
+		// A shorter lease would silently outlive its holder
+		return nil, errors.Wrapf(lock.ErrTTL, "consul sessions last at least %s", minSessionTTL)
+	}
+	wo := (&api.WriteOptions{}).WithContext(ctx)
+
+	session, _, err := l.consul.Session().Create(&api.SessionEntry{
+		Name:     "spine-lock-" + key,
+		TTL:      ttl.String(),
+		Behavior: api.SessionBehaviorRelease,
+	}, wo)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create lock session")
+	}
+	h := &handle{
+		consul:  l.consul,
+		key:     l.prefix + key,
+		session: session,
+	}
+
+	acquired, _, err := l.consul.KV().Acquire(&api.KVPair{
+		Key:     h.key,
+		Session: session,
+	}, wo)
+	if err != nil || !acquired {
+		l.consul.Session().Destroy(session, nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot acquire lock key")
+		}
+		return nil, lock.ErrLocked
+	}
+
+	pair, _, err := l.consul.KV().Get(h.key, (&api.QueryOptions{}).WithContext(ctx))
+	if err != nil || pair == nil || pair.Session != session {
+		h.Release(context.WithoutCancel(ctx))
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot read lock index")
+		}
+		return nil, lock.ErrLost
+	}
+	h.token = pair.LockIndex
+	return h, nil
+}
+
+func (l *locker) Close() error {
+	return nil
+}
+
+// handle implements lock.Handle
+type handle struct {
+	consul  *api.Client
+	key     string
+	session string
+	token   uint64
+}
+
+func (h *handle) Token() uint64 {
+	return h.token
+}
+
+// Renew renews the session. Consul renews sessions for their initial TTL, so
+// ttl is ignored.
+func (h *handle) Renew(ctx context.Context, ttl time.Duration) error {
+	entry, _, err := h.consul.Session().Renew(
+		h.session, (&api.WriteOptions{}).WithContext(ctx),
+	)
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		return lock.ErrLost
+	}
+	return nil
+}
+
+func (h *handle) Release(ctx context.Context) error {
+	wo := (&api.WriteOptions{}).WithContext(ctx)
+	if _, _, err := h.consul.KV().Release(&api.KVPair{
+		Key:     h.key,
+		Session: h.session,
+	}, wo); err != nil {
+		return err
+	}
+	_, err := h.consul.Session().Destroy(h.session, wo)
+	return err
+}
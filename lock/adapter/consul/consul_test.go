@@ -0,0 +1,25 @@
+package consul_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/deixis/spine/config"
+	"github.com/deixis/spine/lock"
+	"github.com/deixis/spine/lock/adapter/consul"
+)
+
+// TestShortTTL tests whether leases shorter than a Consul session are
+// rejected instead of being extended
+func TestShortTTL(t *testing.T) {
+	l, err := consul.New(config.NopTree())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = l.TryAcquire(context.Background(), "tenant", 2*time.Second)
+	if !errors.Is(err, lock.ErrTTL) {
+		t.Errorf("expect ErrTTL, but got %v", err)
+	}
+}
@@ -0,0 +1,16 @@
+// Package lock provides distributed locks (leases) with fencing tokens.
+//
+// A lease grants exclusive access to a key for a TTL. It is renewed in
+// background until it is released, or until the app drains. Each acquisition
+// of a key gets a greater fencing token, so a resource can reject writes
+// from a holder whose lease has expired.
+//
+//	lease, err := lock.Acquire(ctx, "migrate/tenant-42", 30*time.Second)
+//	if err != nil {
+//		return err
+//	}
+//	defer lease.Release(ctx)
+//
+// Locks are stored by a Locker (see lock/adapter): in memory, in a bbolt
+// database for single-process setups, or in Consul KV.
+package lock
@@ -0,0 +1,226 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/deixis/spine/bg"
+	"github.com/deixis/spine/contextutil"
+	"github.com/deixis/spine/log"
+)
+
+var (
+	// ErrLocked occurs when a key is already held by another lease
+	ErrLocked = errors.New("key is locked")
+	// ErrLost occurs when a lease has expired or has been released
+	ErrLost = errors.New("lease lost")
+	// ErrTTL occurs when a lease is requested for a TTL shorter than the
+	// locker supports (1ms, or more for some adapters)
+	ErrTTL = errors.New("lease ttl is too short")
+)
+
+// minRetry and maxRetry bound the time between two attempts to acquire a key
+const (
+	minRetry = 10 * time.Millisecond
+	maxRetry = time.Second
+)
+
+// minTTL is the shortest lease which can be renewed
+const minTTL = time.Millisecond
+
+// A Locker stores locks. Fencing tokens of a key must increase with each
+// acquisition, so a resource can reject writes from a stale lease holder.
+type Locker interface {
+	// TryAcquire acquires key for ttl without blocking. It returns ErrLocked
+	// when key is held by another lease.
+	TryAcquire(ctx context.Context, key string, ttl time.Duration) (Handle, error)
+	// Close releases the resources held by the locker
+	Close() error
+}
+
+// A Handle is a lease held on a Locker
+type Handle interface {
+	// Token returns the fencing token of the lease
+	Token() uint64
+	// Renew extends the lease for ttl. It returns ErrLost when the lease has
+	// expired or has been released.
+	Renew(ctx context.Context, ttl time.Duration) error
+	// Release gives up the lease
+	Release(ctx context.Context) error
+}
+
+// Acquire blocks until key is acquired on the context `Locker`, or until ctx is
+// done. The lease is renewed in background (see bg) until it is released, or
+// until the app drains.
+func Acquire(ctx context.Context, key string, ttl time.Duration) (*Lease, error) {
+	if ttl < minTTL {
+		return nil, ErrTTL
+	}
+	l := FromContext(ctx)
+	wait := minRetry
+	for {
+		h, err := l.TryAcquire(ctx, key, ttl)
+		switch err {
+		case nil:
+			return newLease(ctx, key, ttl, h)
+		case ErrLocked:
+		default:
+			return nil, err
+		}
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if wait *= 2; wait > maxRetry {
+			wait = maxRetry
+		}
+	}
+}
+
+// TryAcquire is like Acquire, but it returns ErrLocked instead of blocking when
+// key is held by another lease
+func TryAcquire(ctx context.Context, key string, ttl time.Duration) (*Lease, error) {
+	if ttl < minTTL {
+		return nil, ErrTTL
+	}
+	h, err := FromContext(ctx).TryAcquire(ctx, key, ttl)
+	if err != nil {
+		return nil, err
+	}
+	return newLease(ctx, key, ttl, h)
+}
+
+// A Lease grants exclusive access to a key until it expires or is released.
+// It implements bg.Job, so it is renewed in background and released on drain.
+type Lease struct {
+	key string
+	ttl time.Duration
+	h   Handle
+	log log.Logger
+
+	once sync.Once
+	lost chan struct{}
+	// stop stops the renewal
+	stop chan struct{}
+	// done is closed once the renewal has stopped
+	done chan struct{}
+}
+
+func newLease(ctx context.Context, key string, ttl time.Duration, h Handle) (*Lease, error) {
+	l := &Lease{
+		key:  key,
+		ttl:  ttl,
+		h:    h,
+		log:  log.FromContext(ctx),
+		lost: make(chan struct{}),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	if err := bg.Dispatch(ctx, l); err != nil {
+		h.Release(context.WithoutCancel(ctx))
+		return nil, err
+	}
+	return l, nil
+}
+
+// Key returns the locked key
+func (l *Lease) Key() string {
+	return l.key
+}
+
+// Token returns the fencing token. Tokens of a key increase with each
+// acquisition.
+func (l *Lease) Token() uint64 {
+	return l.h.Token()
+}
+
+// Lost is closed when the lease is lost or released
+func (l *Lease) Lost() <-chan struct{} {
+	return l.lost
+}
+
+// Release stops renewing the lease and releases it
+func (l *Lease) Release(ctx context.Context) error {
+	l.markLost()
+	<-l.done
+	return l.h.Release(ctx)
+}
+
+// Start renews the lease every third of its TTL (bg.Job)
+func (l *Lease) Start() {
+	defer close(l.done)
+
+	interval := l.ttl / 3
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+
+	expires := time.Now().Add(l.ttl)
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-tick.C:
+		}
+
+		ctx, cancel := context.WithDeadline(context.Background(), expires)
+		err := l.h.Renew(ctx, l.ttl)
+		cancel()
+		switch {
+		case err == nil:
+			expires = time.Now().Add(l.ttl)
+		case errors.Is(err, ErrLost) || time.Now().After(expires):
+			l.log.Warning("lock.lease.lost", "Lease lost",
+				log.String("key", l.key),
+				log.Uint("token", uint(l.h.Token())),
+				log.Error(err),
+			)
+			l.markLost()
+			return
+		default:
+			l.log.Warning("lock.lease.renew_err", "Cannot renew lease",
+				log.String("key", l.key),
+				log.Error(err),
+			)
+		}
+	}
+}
+
+// Stop releases the lease (bg.Job)
+func (l *Lease) Stop() {
+	if err := l.Release(context.Background()); err != nil {
+		l.log.Warning("lock.lease.release_err", "Cannot release lease",
+			log.String("key", l.key),
+			log.Error(err),
+		)
+	}
+}
+
+func (l *Lease) markLost() {
+	l.once.Do(func() {
+		close(l.lost)
+		close(l.stop)
+	})
+}
+
+type contextKey struct{}
+
+var activeContextKey = contextKey{}
+
+// FromContext returns a `Locker` instance associated with `ctx`, or
+// the process in-memory `Locker` if no instance could be found.
+func FromContext(ctx contextutil.ValueContext) Locker {
+	val := ctx.Value(activeContextKey)
+	if o, ok := val.(Locker); ok {
+		return o
+	}
+	return activeMemory
+}
+
+// WithContext returns a copy of parent in which the `Locker` is stored
+func WithContext(ctx context.Context, l Locker) context.Context {
+	return context.WithValue(ctx, activeContextKey, l)
+}
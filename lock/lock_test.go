@@ -0,0 +1,118 @@
+package lock_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/deixis/spine/bg"
+	"github.com/deixis/spine/lock"
+)
+
+func TestAcquire(t *testing.T) {
+	ctx := lock.WithContext(context.Background(), lock.NewMemory())
+
+	a, err := lock.Acquire(ctx, "tenant", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lock.TryAcquire(ctx, "tenant", time.Minute); err != lock.ErrLocked {
+		t.Errorf("expect ErrLocked, but got %v", err)
+	}
+
+	// b waits until a is released
+	bc := make(chan *lock.Lease)
+	go func() {
+		b, err := lock.Acquire(ctx, "tenant", time.Minute)
+		if err != nil {
+			t.Error(err)
+		}
+		bc <- b
+	}()
+	if err := a.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-a.Lost():
+	default:
+		t.Error("expect released lease to be lost")
+	}
+
+	b := <-bc
+	if b.Token() <= a.Token() {
+		t.Errorf("expect token to increase, but got %d after %d", b.Token(), a.Token())
+	}
+	b.Release(ctx)
+}
+
+func TestInvalidTTL(t *testing.T) {
+	ctx := lock.WithContext(context.Background(), lock.NewMemory())
+
+	for _, ttl := range []time.Duration{-time.Second, 0, 2} {
+		if _, err := lock.Acquire(ctx, "tenant", ttl); err != lock.ErrTTL {
+			t.Errorf("expect ErrTTL for %s, but got %v", ttl, err)
+		}
+		if _, err := lock.TryAcquire(ctx, "tenant", ttl); err != lock.ErrTTL {
+			t.Errorf("expect ErrTTL for %s, but got %v", ttl, err)
+		}
+	}
+}
+
+func TestRenewal(t *testing.T) {
+	ctx := lock.WithContext(context.Background(), lock.NewMemory())
+
+	a, err := lock.Acquire(ctx, "tenant", 30*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Release(ctx)
+
+	time.Sleep(100 * time.Millisecond)
+	if _, err := lock.TryAcquire(ctx, "tenant", time.Minute); err != lock.ErrLocked {
+		t.Errorf("expect renewed lease to keep the key locked, but got %v", err)
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	l := lock.NewMemory()
+	ctx := context.Background()
+
+	a, err := l.TryAcquire(ctx, "tenant", time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	b, err := l.TryAcquire(ctx, "tenant", time.Minute)
+	if err != nil {
+		t.Fatalf("expect expired lease to be acquired, but got %v", err)
+	}
+	if err := a.Renew(ctx, time.Minute); err != lock.ErrLost {
+		t.Errorf("expect expired lease to be lost, but got %v", err)
+	}
+	if b.Token() != a.Token()+1 {
+		t.Errorf("expect token %d, but got %d", a.Token()+1, b.Token())
+	}
+}
+
+func TestReleaseOnDrain(t *testing.T) {
+	l := lock.NewMemory()
+	ctx := lock.WithContext(context.Background(), l)
+	reg := bg.NewReg("TestReleaseOnDrain", ctx)
+	ctx = bg.RegWithContext(ctx, reg)
+
+	a, err := lock.Acquire(ctx, "tenant", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg.Drain()
+
+	select {
+	case <-a.Lost():
+	default:
+		t.Error("expect lease to be released on drain")
+	}
+	if _, err := l.TryAcquire(ctx, "tenant", time.Minute); err != nil {
+		t.Errorf("expect key to be free, but got %v", err)
+	}
+}
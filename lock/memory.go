@@ -0,0 +1,86 @@
+package lock
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+var activeMemory = NewMemory()
+
+// memory is an in-process locker
+type memory struct {
+	mu sync.Mutex
+
+	leases map[string]*memoryHandle
+	// tokens contains the last fencing token of each key
+	tokens map[string]uint64
+}
+
+// NewMemory returns a locker which only locks keys within this process
+func NewMemory() Locker {
+	return &memory{
+		leases: map[string]*memoryHandle{},
+		tokens: map[string]uint64{},
+	}
+}
+
+func (m *memory) TryAcquire(
+	ctx context.Context, key string, ttl time.Duration,
+) (Handle, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if h, ok := m.leases[key]; ok && now.Before(h.expires) {
+		return nil, ErrLocked
+	}
+
+	m.tokens[key]++
+	h := &memoryHandle{
+		m:       m,
+		key:     key,
+		token:   m.tokens[key],
+		expires: now.Add(ttl),
+	}
+	m.leases[key] = h
+	return h, nil
+}
+
+func (m *memory) Close() error {
+	return nil
+}
+
+// memoryHandle implements Handle
+type memoryHandle struct {
+	m       *memory
+	key     string
+	token   uint64
+	expires time.Time
+}
+
+func (h *memoryHandle) Token() uint64 {
+	return h.token
+}
+
+func (h *memoryHandle) Renew(ctx context.Context, ttl time.Duration) error {
+	h.m.mu.Lock()
+	defer h.m.mu.Unlock()
+
+	now := time.Now()
+	if h.m.leases[h.key] != h || now.After(h.expires) {
+		return ErrLost
+	}
+	h.expires = now.Add(ttl)
+	return nil
+}
+
+func (h *memoryHandle) Release(ctx context.Context) error {
+	h.m.mu.Lock()
+	defer h.m.mu.Unlock()
+
+	if h.m.leases[h.key] == h {
+		delete(h.m.leases, h.key)
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package logger
 import (
 	"fmt"
 	"runtime"
+	"sync/atomic"
 	"time"
 
 	"github.com/deixis/spine/config"
@@ -54,20 +55,22 @@ func Build(
 	f log.Formatter,
 	p log.Printer,
 ) log.Logger {
-	return &Logger{
+	l := &Logger{
 		service:   service,
-		level:     level,
+		level:     new(atomic.Int32),
 		fmt:       f,
 		pnt:       p,
 		calldepth: 1,
 	}
+	l.level.Store(int32(level))
+	return l
 }
 
 // Logger is the key struct of the log package.
 // It is the part that links the log formatter to the log printer
 type Logger struct {
 	service   string
-	level     log.Level
+	level     *atomic.Int32 // shared with all loggers derived from this one
 	fmt       log.Formatter
 	pnt       log.Printer
 	calldepth int
@@ -108,6 +111,17 @@ func (l *Logger) AddCalldepth(n int) log.Logger {
 	return c
 }
 
+// Level returns the minimum level of the logger
+func (l *Logger) Level() log.Level {
+	return log.Level(l.level.Load())
+}
+
+// SetLevel changes the minimum level of the logger and of all loggers derived
+// from it
+func (l *Logger) SetLevel(lvl log.Level) {
+	l.level.Store(int32(lvl))
+}
+
 func (l *Logger) Close() error {
 	return l.pnt.Close()
 }
@@ -124,7 +138,7 @@ func (l *Logger) clone() *Logger {
 }
 
 func (l *Logger) log(lvl log.Level, tag, msg string, fields ...log.Field) {
-	if l.level > lvl {
+	if log.Level(l.level.Load()) > lvl {
 		return
 	}
 
@@ -162,5 +176,5 @@ func (l *Logger) log(lvl log.Level, tag, msg string, fields ...log.Field) {
 
 // Config contains all log-related configuration
 type Config struct {
-	Level string `toml:"level"`
+	Level string `toml:"level" validate:"oneof=trace warning error"`
 }
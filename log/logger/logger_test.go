@@ -128,3 +128,19 @@ func (m *mockPrinter) LastJSON() (map[string]interface{}, error) {
 
 	return out, err
 }
+
+func TestSetLevel(t *testing.T) {
+	p := newMockPrinter()
+	l := Build("test", log.LevelTrace, &fjson.Formatter{}, p)
+	child := l.With(log.String("key", "value"))
+
+	l.(*Logger).SetLevel(log.LevelWarning)
+	child.Trace("my.func", "something happened")
+	if n := p.NumLines(); n != 0 {
+		t.Fatalf("expected printer to have output %d lines, got %d", 0, n)
+	}
+	child.Warning("my.func", "something happened")
+	if n := p.NumLines(); n != 1 {
+		t.Fatalf("expected printer to have output %d lines, got %d", 1, n)
+	}
+}
@@ -26,7 +26,7 @@ const (
 
 // Config defines the filer printer config
 type Config struct {
-	Path        string `toml:"path"`
+	Path        string `toml:"path" validate:"required"`
 	Flag        int    `toml:"flag"`
 	Mode        uint32 `toml:"mode"`
 	FlushPeriod int    `toml:"flush_period"`
@@ -37,9 +37,6 @@ func New(tree config.Tree) (log.Printer, error) {
 	if err := tree.Unmarshal(&c); err != nil {
 		return nil, err
 	}
-	if c.Path == "" {
-		return nil, errors.New("missing \"path\" on file log printer config")
-	}
 	if c.Mode == 0 {
 		c.Mode = defaultMode
 	}
@@ -124,13 +121,17 @@ func (l *Logger) listen() {
 	}
 }
 
+// flushPeriodically flushes the buffer every d until Close is called. It does
+// not run on bg, because printers are created before the bg registry and must
+// keep flushing logs after it has drained.
 func (l *Logger) flushPeriodically(d time.Duration) {
-	tick := time.Tick(d)
+	tick := time.NewTicker(d)
+	defer tick.Stop()
 	for {
 		select {
 		case <-l.flusher:
 			return
-		case <-tick:
+		case <-tick.C:
 			func() {
 				l.mu.Lock()
 				defer l.mu.Unlock()
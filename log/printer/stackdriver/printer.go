@@ -38,14 +38,14 @@ type Config struct {
 	// for backwards compatibility, a string with no '/' is also allowed and is
 	// interpreted as a project ID.
 	// ProjectID sets the Google Cloud Platform project ID.
-	Parent string `toml:"parent"`
+	Parent string `toml:"parent" validate:"required"`
 	// Name sets the name of the log to write to.
 	//
 	// A log ID must be less than 512 characters long and can only
 	// include the following characters: upper and lower case alphanumeric
 	// characters: [A-Za-z0-9]; and punctuation characters: forward-slash,
 	// underscore, hyphen, and period.
-	LogID string `toml:"log_id"`
+	LogID string `toml:"log_id" validate:"required"`
 	// FlushPeriod is the frequence on which log lines are flushed to StackDriver
 	FlushPeriod int `toml:"flush_period"`
 	// CommonLabels are labels that apply to all log entries written from a Logger,
@@ -102,12 +102,6 @@ func New(tree config.Tree) (log.Printer, error) {
 	if err := tree.Unmarshal(&c); err != nil {
 		return nil, err
 	}
-	if c.Parent == "" {
-		return nil, errors.New("missing \"Parent\" on stackdriver log printer config")
-	}
-	if c.LogID == "" {
-		return nil, errors.New("missing \"LogID\" on stackdriver log printer config")
-	}
 	flushPeriod := defaultFlushPeriod
 	if c.FlushPeriod > 0 {
 		flushPeriod = time.Duration(c.FlushPeriod) * time.Second
@@ -203,13 +197,17 @@ func (l *Logger) Close() error {
 	return l.C.Close() // Flush and exit
 }
 
+// flushPeriodically flushes the buffer every d until Close is called. It does
+// not run on bg, because printers are created before the bg registry and must
+// keep flushing logs after it has drained.
 func (l *Logger) flushPeriodically(d time.Duration) {
-	tick := time.Tick(d)
+	tick := time.NewTicker(d)
+	defer tick.Stop()
 	for {
 		select {
 		case <-l.flusher:
 			return
-		case <-tick:
+		case <-tick.C:
 			func() {
 				l.mu.Lock()
 				defer l.mu.Unlock()
@@ -9,4 +9,9 @@
 // It also manages the lifecycle of the handlers. All handlers should be
 // registered to this package in order to be gracefuly stopped (drained)
 // when the application shuts down.
+//
+// Servers bind their sockets with Listeners, which reuses sockets inherited
+// from systemd socket activation (LISTEN_FDS) or from a parent process. On
+// SIGUSR2, the app starts a new process with its sockets and drains once the
+// new process is ready, so a deploy does not drop connections.
 package net
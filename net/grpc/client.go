@@ -16,9 +16,11 @@ import (
 	"github.com/opentracing/opentracing-go/ext"
 	"github.com/pkg/errors"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/connectivity"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 // Client is a wrapper for the grpc client.
@@ -226,6 +228,50 @@ func OpenTracingUnaryClientMiddleware(spanOpts ...opentracing.StartSpanOption) U
 	}
 }
 
+// BreakerUnaryClientMiddleware returns a UnaryClientMiddleware which guards
+// calls with the circuit breaker of the named command (see context.Do). The
+// method name is used when name is empty.
+//
+// Only errors signalling an unhealthy upstream (e.g. Unavailable) count as
+// failures. Calls cancelled by the caller, or past the caller deadline, do
+// not.
+func BreakerUnaryClientMiddleware(name string) UnaryClientMiddleware {
+	return func(next grpc.UnaryInvoker) grpc.UnaryInvoker {
+		return func(
+			ctx context.Context,
+			method string,
+			req, reply interface{},
+			cc *grpc.ClientConn,
+			opts ...grpc.CallOption,
+		) error {
+			command := name
+			if command == "" {
+				command = method
+			}
+			done, err := scontext.BreakersFromContext(ctx).Get(command).Allow()
+			if err != nil {
+				return status.Error(codes.Unavailable, err.Error())
+			}
+
+			err = next(ctx, method, req, reply, cc, opts...)
+			code := status.Code(err)
+			switch {
+			case code == codes.Canceled || (err != nil && ctx.Err() != nil):
+				// The caller gave up (cancelled or past its own deadline), which
+				// says nothing about the upstream health
+				done(context.Canceled)
+			case code == codes.Unavailable, code == codes.DeadlineExceeded,
+				code == codes.ResourceExhausted, code == codes.Internal,
+				code == codes.Unknown:
+				done(err)
+			default:
+				done(nil)
+			}
+			return err
+		}
+	}
+}
+
 type StreamClientMiddleware func(grpc.Streamer) grpc.Streamer
 
 func (c *Client) streamInterceptor(
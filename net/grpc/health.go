@@ -0,0 +1,99 @@
+package grpc
+
+import (
+	"context"
+	"time"
+
+	"github.com/deixis/spine/health"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// LivenessService is the grpc.health.v1 service name which reports liveness.
+// The empty service name reports readiness, and any other name reports the
+// health check with that name.
+const LivenessService = "liveness"
+
+// healthWatchInterval is the interval between two checks on Watch
+const healthWatchInterval = 5 * time.Second
+
+// healthServer implements grpc.health.v1 with a health registry
+type healthServer struct {
+	healthpb.UnimplementedHealthServer
+
+	reg *health.Registry
+}
+
+// registerHealth registers the health service, unless it has already been
+// registered
+func registerHealth(s *grpc.Server, reg *health.Registry) {
+	if _, ok := s.GetServiceInfo()[healthpb.Health_ServiceDesc.ServiceName]; ok {
+		return
+	}
+	healthpb.RegisterHealthServer(s, &healthServer{reg: reg})
+}
+
+func (s *healthServer) Check(
+	ctx context.Context, req *healthpb.HealthCheckRequest,
+) (*healthpb.HealthCheckResponse, error) {
+	st, err := s.check(ctx, req.Service)
+	if err != nil {
+		return nil, err
+	}
+	return &healthpb.HealthCheckResponse{Status: st}, nil
+}
+
+func (s *healthServer) Watch(
+	req *healthpb.HealthCheckRequest, stream healthpb.Health_WatchServer,
+) error {
+	ctx := stream.Context()
+	tick := time.NewTicker(healthWatchInterval)
+	defer tick.Stop()
+
+	last := healthpb.HealthCheckResponse_UNKNOWN
+	for {
+		st, err := s.check(ctx, req.Service)
+		if status.Code(err) == codes.NotFound {
+			st = healthpb.HealthCheckResponse_SERVICE_UNKNOWN
+		} else if err != nil {
+			return err
+		}
+		if st != last {
+			if err := stream.Send(&healthpb.HealthCheckResponse{Status: st}); err != nil {
+				return err
+			}
+			last = st
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-tick.C:
+		}
+	}
+}
+
+func (s *healthServer) check(
+	ctx context.Context, service string,
+) (healthpb.HealthCheckResponse_ServingStatus, error) {
+	var healthy bool
+	switch service {
+	case "":
+		healthy = s.reg.Readiness(ctx).Healthy()
+	case LivenessService:
+		healthy = s.reg.Liveness(ctx).Healthy()
+	default:
+		res, ok := s.reg.Check(ctx, service)
+		if !ok {
+			return 0, status.Errorf(codes.NotFound, "unknown service %s", service)
+		}
+		healthy = res.Status != health.StatusFail
+	}
+
+	if healthy {
+		return healthpb.HealthCheckResponse_SERVING, nil
+	}
+	return healthpb.HealthCheckResponse_NOT_SERVING, nil
+}
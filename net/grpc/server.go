@@ -19,6 +19,8 @@ import (
 	"github.com/deixis/spine/config"
 	scontext "github.com/deixis/spine/context"
 	"github.com/deixis/spine/disco"
+	"github.com/deixis/spine/health"
+	"github.com/deixis/spine/lock"
 	"github.com/deixis/spine/log"
 	lnet "github.com/deixis/spine/net"
 	"github.com/deixis/spine/schedule"
@@ -36,8 +38,9 @@ import (
 
 // A Server defines parameters for running a spine compatible GRPC server
 type Server struct {
-	mode uint32
-	addr string
+	mode     uint32
+	addr     string
+	inflight lnet.InFlight
 
 	opts              []grpc.ServerOption
 	registrations     []registration
@@ -185,10 +188,11 @@ func (s *Server) Serve(ctx context.Context, addr string) error {
 		s.GRPC.RegisterService(service.sd, service.ss)
 	}
 
-	// Register reflection service on gRPC server
+	// Register health and reflection services on gRPC server
+	registerHealth(s.GRPC, health.FromContext(ctx))
 	reflection.Register(s.GRPC)
 
-	lis, err := net.Listen("tcp", addr)
+	lis, err := lnet.ListenersFromContext(ctx).Listen("tcp", addr)
 	if err != nil {
 		return err
 	}
@@ -214,6 +218,19 @@ func (s *Server) Drain() {
 	s.GRPC.GracefulStop()
 }
 
+// Close immediately closes all connections, including the ones with
+// in-flight requests
+func (s *Server) Close() error {
+	atomic.StoreUint32(&s.mode, lnet.StateDrain)
+	s.GRPC.Stop()
+	return nil
+}
+
+// InFlight returns the requests being served
+func (s *Server) InFlight() []lnet.Request {
+	return s.inflight.List()
+}
+
 // isDraining checks whether the handler is draining
 func (s *Server) isDraining() bool {
 	return atomic.LoadUint32(&s.mode) == lnet.StateDrain
@@ -229,6 +246,10 @@ func (s *Server) unaryInterceptor(
 		FullMethod: info.FullMethod,
 		StartTime:  time.Now(),
 	}
+	defer s.inflight.Add(lnet.Request{
+		Name:    info.FullMethod,
+		Started: rinfo.StartTime,
+	})()
 	// TODO: Join request context with app context
 
 	var cancel func()
@@ -248,6 +269,8 @@ func (s *Server) unaryInterceptor(
 	ctx = disco.AgentWithContext(ctx, disco.AgentFromContext(s.ctx))
 	ctx = schedule.SchedulerWithContext(ctx, schedule.SchedulerFromContext(s.ctx))
 	ctx = cache.WithContext(ctx, cache.FromContext(s.ctx))
+	ctx = lock.WithContext(ctx, lock.FromContext(s.ctx))
+	ctx = scontext.BreakersWithContext(ctx, scontext.BreakersFromContext(s.ctx))
 
 	// Extract Transit and attach transit-specific services
 	ctx, err = ExtractTransit(ctx)
@@ -293,6 +316,10 @@ func (s *Server) streamInterceptor(
 		FullMethod: info.FullMethod,
 		StartTime:  time.Now(),
 	}
+	defer s.inflight.Add(lnet.Request{
+		Name:    info.FullMethod,
+		Started: rinfo.StartTime,
+	})()
 	// TODO: Join request context with app context
 
 	ctx := ss.Context()
@@ -306,6 +333,8 @@ func (s *Server) streamInterceptor(
 	ctx = disco.AgentWithContext(ctx, disco.AgentFromContext(s.ctx))
 	ctx = schedule.SchedulerWithContext(ctx, schedule.SchedulerFromContext(s.ctx))
 	ctx = cache.WithContext(ctx, cache.FromContext(s.ctx))
+	ctx = lock.WithContext(ctx, lock.FromContext(s.ctx))
+	ctx = scontext.BreakersWithContext(ctx, scontext.BreakersFromContext(s.ctx))
 
 	// Extract Transit and attach transit-specific services
 	ctx, err := ExtractTransit(ctx)
@@ -2,10 +2,13 @@ package http
 
 import (
 	"context"
+	"errors"
 	"io"
 	"net/http"
 	"net/url"
 	"strings"
+
+	scontext "github.com/deixis/spine/context"
 )
 
 // DefaultClient is the default Client and is used by Get, Head, and Post.
@@ -21,6 +24,12 @@ type Client struct {
 	// or another SPINE-compatible service. The context can potentially leak
 	// sensitive information, so do not activate it for services that you don't trust.
 	PropagateContext bool
+	// Breaker is the name of the command whose circuit breaker guards the
+	// requests (see context.Do). Requests are not guarded when it is empty.
+	//
+	// Transport errors and 5xx responses count as failures. Requests cancelled
+	// by the caller, or past the caller deadline, do not.
+	Breaker string
 }
 
 // Do sends an HTTP request with the provided http.Client and returns
@@ -40,6 +49,30 @@ func (c *Client) Do(ctx context.Context, req *http.Request) (*http.Response, err
 		}
 	}
 
+	if c.Breaker != "" {
+		done, err := scontext.BreakersFromContext(ctx).Get(c.Breaker).Allow()
+		if err != nil {
+			return nil, err
+		}
+		resp, err := c.do(ctx, req)
+		switch {
+		case err != nil && ctx.Err() != nil:
+			// The caller gave up (cancelled or past its own deadline), which
+			// says nothing about the upstream health
+			done(context.Canceled)
+		case err != nil:
+			done(err)
+		case resp.StatusCode >= 500:
+			done(errors.New(resp.Status))
+		default:
+			done(nil)
+		}
+		return resp, err
+	}
+	return c.do(ctx, req)
+}
+
+func (c *Client) do(ctx context.Context, req *http.Request) (*http.Response, error) {
 	resp, err := c.HTTP.Do(req.WithContext(ctx))
 	if err != nil {
 		select {
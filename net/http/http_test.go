@@ -7,11 +7,15 @@ import (
 	"io/ioutil"
 	"math"
 	netHttp "net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 	"time"
 
+	scontext "github.com/deixis/spine/context"
+	"github.com/deixis/spine/log"
 	"github.com/deixis/spine/net/http"
+	"github.com/deixis/spine/stats"
 	lt "github.com/deixis/spine/testing"
 )
 
@@ -253,3 +257,64 @@ func TestHTTP_Static(t *testing.T) {
 		t.Errorf("expect code %s, but got %s", expectData, string(data))
 	}
 }
+
+func TestClientBreaker(t *testing.T) {
+	upstream := httptest.NewServer(netHttp.HandlerFunc(
+		func(w netHttp.ResponseWriter, r *netHttp.Request) {
+			w.WriteHeader(netHttp.StatusServiceUnavailable)
+		},
+	))
+	defer upstream.Close()
+
+	breakers := scontext.NewBreakers(log.NopLogger(), stats.NopStats())
+	breakers.Configure("upstream", scontext.CommandConfig{VolumeThreshold: 2})
+	ctx := scontext.BreakersWithContext(context.Background(), breakers)
+
+	client := &http.Client{Breaker: "upstream"}
+	for i := 0; i < 2; i++ {
+		res, err := client.Get(ctx, upstream.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != netHttp.StatusServiceUnavailable {
+			t.Errorf("expect status 503, but got %d", res.StatusCode)
+		}
+	}
+	if _, err := client.Get(ctx, upstream.URL); err != scontext.ErrCircuitOpen {
+		t.Errorf("expect ErrCircuitOpen, but got %v", err)
+	}
+}
+
+func TestClientBreakerCallerGaveUp(t *testing.T) {
+	upstream := httptest.NewServer(netHttp.HandlerFunc(
+		func(w netHttp.ResponseWriter, r *netHttp.Request) {
+			<-r.Context().Done()
+		},
+	))
+	defer upstream.Close()
+
+	breakers := scontext.NewBreakers(log.NopLogger(), stats.NopStats())
+	breakers.Configure("upstream", scontext.CommandConfig{VolumeThreshold: 1})
+	client := &http.Client{Breaker: "upstream"}
+
+	// Cancelled by the caller
+	ctx := scontext.BreakersWithContext(context.Background(), breakers)
+	cctx, cancel := context.WithCancel(ctx)
+	time.AfterFunc(10*time.Millisecond, cancel)
+	if _, err := client.Get(cctx, upstream.URL); err != context.Canceled {
+		t.Fatalf("expect context.Canceled, but got %v", err)
+	}
+
+	// Past the caller deadline
+	dctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err := client.Get(dctx, upstream.URL); err != context.DeadlineExceeded {
+		t.Fatalf("expect context.DeadlineExceeded, but got %v", err)
+	}
+
+	s := breakers.Get("upstream").Stats()
+	if s.Failures != 0 || s.State != "closed" {
+		t.Errorf("expect caller giving up not to count as a failure, but got %+v", s)
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/deixis/spine/config"
 	scontext "github.com/deixis/spine/context"
 	"github.com/deixis/spine/disco"
+	"github.com/deixis/spine/lock"
 	"github.com/deixis/spine/log"
 	"github.com/deixis/spine/net"
 	"github.com/deixis/spine/schedule"
@@ -23,8 +24,9 @@ import (
 // A Server defines parameters for running a spine compatible HTTP server
 // The zero value for Server is a valid configuration.
 type Server struct {
-	wg    sync.WaitGroup
-	state uint32
+	wg       sync.WaitGroup
+	state    uint32
+	inflight net.InFlight
 
 	http http.Server
 
@@ -132,12 +134,16 @@ func (s *Server) Serve(ctx context.Context, addr string) error {
 		log.Bool("tls", tlsEnabled),
 	)
 
+	lis, err := net.ListenersFromContext(ctx).Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
 	atomic.StoreUint32(&s.state, net.StateUp)
-	var err error
 	if tlsEnabled {
-		err = s.http.ListenAndServeTLS(s.certFile, s.keyFile)
+		err = s.http.ServeTLS(lis, s.certFile, s.keyFile)
 	} else {
-		err = s.http.ListenAndServe()
+		err = s.http.Serve(lis)
 	}
 	atomic.StoreUint32(&s.state, net.StateDown)
 
@@ -157,6 +163,18 @@ func (s *Server) Drain() {
 	s.http.Shutdown(context.Background()) // Then close all idle connections
 }
 
+// Close immediately closes all connections, including the ones with
+// in-flight requests
+func (s *Server) Close() error {
+	atomic.StoreUint32(&s.state, net.StateDrain)
+	return s.http.Close()
+}
+
+// InFlight returns the requests being served
+func (s *Server) InFlight() []net.Request {
+	return s.inflight.List()
+}
+
 // isState checks the current server state
 func (s *Server) isState(state uint32) bool {
 	return atomic.LoadUint32(&s.state) == uint32(state)
@@ -181,6 +199,10 @@ func (s *Server) buildHandleFunc(rootctx context.Context, e Endpoint) func(
 			HTTP:   r,
 			Params: mux.Vars(r),
 		}
+		defer s.inflight.Add(net.Request{
+			Name:    e.Method() + " " + e.Path(),
+			Started: req.startTime,
+		})()
 
 		// Ensure root ctx is still valid
 		if err := rootctx.Err(); err != nil {
@@ -209,6 +231,8 @@ func (s *Server) buildHandleFunc(rootctx context.Context, e Endpoint) func(
 		ctx = disco.AgentWithContext(ctx, disco.AgentFromContext(rootctx))
 		ctx = schedule.SchedulerWithContext(ctx, schedule.SchedulerFromContext(rootctx))
 		ctx = cache.WithContext(ctx, cache.FromContext(rootctx))
+		ctx = lock.WithContext(ctx, lock.FromContext(rootctx))
+		ctx = scontext.BreakersWithContext(ctx, scontext.BreakersFromContext(rootctx))
 
 		// Decode context
 		if s.config.Request.AllowContext {
@@ -0,0 +1,210 @@
+package net
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+)
+
+const (
+	// EnvListenFDs contains the number of inherited listening sockets
+	// (systemd socket activation)
+	EnvListenFDs = "LISTEN_FDS"
+	// EnvListenPID contains the PID of the process which inherits the sockets
+	// (systemd socket activation)
+	EnvListenPID = "LISTEN_PID"
+	// EnvListenFDNames contains the colon-separated names of the inherited
+	// sockets (systemd socket activation)
+	EnvListenFDNames = "LISTEN_FDNAMES"
+	// EnvListenPPID contains the PID of the parent process which passes its
+	// sockets on restart
+	EnvListenPPID = "LISTEN_PPID"
+	// EnvReadyFD contains the file descriptor on which a restarted process
+	// notifies its parent that it is ready. Like the other variables, it is
+	// kept out of config.EnvPrefix, so it is not merged in the config tree.
+	EnvReadyFD = "LISTEN_READY_FD"
+
+	// listenFDsStart is the first inherited file descriptor
+	listenFDsStart = 3
+)
+
+var (
+	defaultListeners     *Listeners
+	defaultListenersErr  error
+	defaultListenersOnce sync.Once
+)
+
+// Listeners hands out listening sockets. Sockets inherited from a parent
+// process or from systemd socket activation are reused instead of binding new
+// ones, and sockets in use can be passed on to a child process.
+type Listeners struct {
+	mu sync.Mutex
+
+	// inherited contains the inherited listeners not yet claimed
+	inherited []*inheritedListener
+	// active contains the listeners in use by address
+	active map[string]net.Listener
+}
+
+type inheritedListener struct {
+	name string
+	l    net.Listener
+}
+
+// NewListeners returns an empty set of listeners
+func NewListeners() *Listeners {
+	return &Listeners{
+		active: map[string]net.Listener{},
+	}
+}
+
+// unsetListenEnv unsets the environment variables of inherited sockets, so
+// they are not passed on to other processes
+func unsetListenEnv() {
+	os.Unsetenv(EnvListenFDs)
+	os.Unsetenv(EnvListenPID)
+	os.Unsetenv(EnvListenFDNames)
+	os.Unsetenv(EnvListenPPID)
+}
+
+// DefaultListeners returns the process listeners. It inherits sockets on the
+// first call. When inheritance fails, the listeners are still usable, but
+// they bind new sockets.
+func DefaultListeners() (*Listeners, error) {
+	defaultListenersOnce.Do(func() {
+		defaultListeners, defaultListenersErr = InheritListeners()
+	})
+	return defaultListeners, defaultListenersErr
+}
+
+// Listen returns an inherited listener bound to addr, or binds a new one
+func (ls *Listeners) Listen(network, addr string) (net.Listener, error) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	if l, ok := ls.active[addr]; ok {
+		return nil, fmt.Errorf("listener on <%s> is already in use (%s)", addr, l.Addr())
+	}
+
+	l := ls.claim(network, addr)
+	if l == nil {
+		var err error
+		l, err = net.Listen(network, addr)
+		if err != nil {
+			return nil, err
+		}
+	}
+	ls.active[addr] = l
+	return &activeListener{Listener: l, release: func() {
+		ls.mu.Lock()
+		delete(ls.active, addr)
+		ls.mu.Unlock()
+	}}, nil
+}
+
+// Inherited returns the number of inherited listeners not yet claimed
+func (ls *Listeners) Inherited() int {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	return len(ls.inherited)
+}
+
+// Files returns duplicates of the file descriptors of the listeners in use,
+// along with their addresses. They are meant to be passed on to a child
+// process, which can find them with InheritListeners.
+func (ls *Listeners) Files() ([]*os.File, []string, error) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	var files []*os.File
+	var names []string
+	for addr, l := range ls.active {
+		fl, ok := l.(interface {
+			File() (*os.File, error)
+		})
+		if !ok {
+			continue
+		}
+		if ul, ok := l.(*net.UnixListener); ok {
+			// The socket must survive its listener in this process
+			ul.SetUnlinkOnClose(false)
+		}
+		f, err := fl.File()
+		if err != nil {
+			for _, f := range files {
+				f.Close()
+			}
+			return nil, nil, fmt.Errorf("cannot get file of listener <%s>: %w", addr, err)
+		}
+		files = append(files, f)
+		names = append(names, addr)
+	}
+	return files, names, nil
+}
+
+// claim returns the inherited listener matching addr
+func (ls *Listeners) claim(network, addr string) net.Listener {
+	for i, il := range ls.inherited {
+		if il.name == addr || sameAddr(network, addr, il.l.Addr()) {
+			ls.inherited = append(ls.inherited[:i], ls.inherited[i+1:]...)
+			return il.l
+		}
+	}
+	return nil
+}
+
+// sameAddr checks whether addr designates the listener address la
+func sameAddr(network, addr string, la net.Addr) bool {
+	if !strings.HasPrefix(la.Network(), network) && !strings.HasPrefix(network, la.Network()) {
+		return false
+	}
+
+	switch la := la.(type) {
+	case *net.TCPAddr:
+		ta, err := net.ResolveTCPAddr(network, addr)
+		if err != nil || ta.Port != la.Port {
+			return false
+		}
+		if ta.IP == nil || ta.IP.IsUnspecified() {
+			return la.IP == nil || la.IP.IsUnspecified()
+		}
+		return ta.IP.Equal(la.IP)
+	default:
+		return la.String() == addr
+	}
+}
+
+// activeListener releases its address once closed
+type activeListener struct {
+	net.Listener
+	once    sync.Once
+	release func()
+}
+
+func (l *activeListener) Close() error {
+	l.once.Do(l.release)
+	return l.Listener.Close()
+}
+
+type listenersKey struct{}
+
+var activeListenersKey = listenersKey{}
+
+// ListenersFromContext returns the `Listeners` instance associated with `ctx`,
+// or the process listeners if no existing instance could be found.
+func ListenersFromContext(ctx context.Context) *Listeners {
+	val := ctx.Value(activeListenersKey)
+	if o, ok := val.(*Listeners); ok {
+		return o
+	}
+	ls, _ := DefaultListeners()
+	return ls
+}
+
+// ListenersWithContext returns a copy of parent in which `Listeners` is stored
+func ListenersWithContext(ctx context.Context, ls *Listeners) context.Context {
+	return context.WithValue(ctx, activeListenersKey, ls)
+}
@@ -0,0 +1,33 @@
+//go:build !unix
+
+package net
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// InheritListeners returns an empty set of listeners, because sockets cannot
+// be inherited on this platform. It returns an error when sockets have been
+// passed on anyway.
+func InheritListeners() (*Listeners, error) {
+	defer unsetListenEnv()
+
+	ls := NewListeners()
+	if os.Getenv(EnvListenFDs) != "" {
+		return ls, fmt.Errorf("cannot inherit listeners: %w", errors.ErrUnsupported)
+	}
+	return ls, nil
+}
+
+// NotifyReady returns an error when the process has been started by a
+// restart, because restarts are not supported on this platform. It does
+// nothing otherwise.
+func NotifyReady() error {
+	if os.Getenv(EnvReadyFD) == "" {
+		return nil
+	}
+	os.Unsetenv(EnvReadyFD)
+	return fmt.Errorf("cannot notify parent process: %w", errors.ErrUnsupported)
+}
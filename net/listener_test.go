@@ -0,0 +1,87 @@
+//go:build unix
+
+package net_test
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"testing"
+
+	"github.com/deixis/spine/net"
+)
+
+// TestListenerInheritance tests whether a child process reuses the listening
+// socket passed on by its parent
+func TestListenerInheritance(t *testing.T) {
+	if addr := os.Getenv("TEST_INHERIT_ADDR"); addr != "" {
+		// Child process
+		ls, err := net.InheritListeners()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ls.Inherited() != 1 {
+			t.Fatalf("expect 1 inherited listener, but got %d", ls.Inherited())
+		}
+		l, err := ls.Listen("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer l.Close()
+		if ls.Inherited() != 0 {
+			t.Error("expect inherited listener to be claimed")
+		}
+		return
+	}
+
+	ls := net.NewListeners()
+	l, err := ls.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if _, err := ls.Listen("tcp", "127.0.0.1:0"); err == nil {
+		t.Error("expect address to be in use")
+	}
+
+	files, names, err := ls.Files()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || names[0] != "127.0.0.1:0" {
+		t.Fatalf("unexpected listener files %v", names)
+	}
+	defer files[0].Close()
+
+	// Inherit the socket with another name, so the address must match
+	cmd := exec.Command(os.Args[0], "-test.run=^TestListenerInheritance$")
+	cmd.Env = append(os.Environ(),
+		"TEST_INHERIT_ADDR="+l.Addr().String(),
+		net.EnvListenFDs+"=1",
+		net.EnvListenFDNames+"=inherited",
+		net.EnvListenPPID+"="+strconv.Itoa(os.Getpid()),
+	)
+	cmd.ExtraFiles = files
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Errorf("child process failed: %s\n%s", err, out)
+	}
+}
+
+// TestListenerRelease tests whether an address can be reused once its
+// listener has been closed
+func TestListenerRelease(t *testing.T) {
+	ls := net.NewListeners()
+	l, err := ls.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+
+	files, _, err := ls.Files()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Errorf("expect closed listener to be released, but got %d files", len(files))
+	}
+}
@@ -0,0 +1,69 @@
+//go:build unix
+
+package net
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// InheritListeners returns the listeners passed on by systemd (LISTEN_FDS) or
+// by a parent process on restart. The environment variables are unset, so
+// they are not passed on to other processes.
+func InheritListeners() (*Listeners, error) {
+	ls := NewListeners()
+	defer unsetListenEnv()
+
+	n, _ := strconv.Atoi(os.Getenv(EnvListenFDs))
+	if n <= 0 {
+		return ls, nil
+	}
+	pid := os.Getenv(EnvListenPID) == strconv.Itoa(os.Getpid())
+	ppid := os.Getenv(EnvListenPPID) == strconv.Itoa(os.Getppid())
+	if !pid && !ppid {
+		// Sockets meant for another process
+		return ls, nil
+	}
+
+	names := strings.Split(os.Getenv(EnvListenFDNames), ":")
+	for i := 0; i < n; i++ {
+		fd := listenFDsStart + i
+		syscall.CloseOnExec(fd)
+
+		name := ""
+		if i < len(names) {
+			name = names[i]
+		}
+		f := os.NewFile(uintptr(fd), name)
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			return ls, fmt.Errorf("cannot inherit listener from fd %d: %w", fd, err)
+		}
+		ls.inherited = append(ls.inherited, &inheritedListener{name: name, l: l})
+	}
+	return ls, nil
+}
+
+// NotifyReady notifies the parent process that this process is ready, when
+// it has been started by a restart. It does nothing otherwise.
+func NotifyReady() error {
+	v := os.Getenv(EnvReadyFD)
+	if v == "" {
+		return nil
+	}
+	os.Unsetenv(EnvReadyFD)
+
+	fd, err := strconv.Atoi(v)
+	if err != nil {
+		return fmt.Errorf("invalid %s <%s>: %w", EnvReadyFD, v, err)
+	}
+	f := os.NewFile(uintptr(fd), "ready")
+	defer f.Close()
+	_, err = f.Write([]byte{1})
+	return err
+}
@@ -4,8 +4,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/deixis/spine/log"
 )
@@ -26,6 +29,8 @@ var (
 	ErrEmptyReg = errors.New("there must be at least one registered server")
 	// ErrDraining occurs when there is an attempt to access a draining `Server`
 	ErrDraining = errors.New("server is draining")
+	// ErrDrainTimeout occurs when servers do not drain before the deadline
+	ErrDrainTimeout = errors.New("servers did not drain in time")
 )
 
 // Server is the interface to implement to be a valid server
@@ -34,23 +39,91 @@ type Server interface {
 	Drain()
 }
 
+// Tracker is implemented by servers which can report their in-flight requests
+type Tracker interface {
+	InFlight() []Request
+}
+
+// Request describes an in-flight request
+type Request struct {
+	// Name identifies the request (e.g. "GET /users/{id}")
+	Name string
+	// Started is the time on which the request has started
+	Started time.Time
+}
+
+// InFlight keeps track of in-flight requests.
+// The zero value for InFlight is ready to use.
+type InFlight struct {
+	mu  sync.Mutex
+	seq uint64
+	l   map[uint64]Request
+}
+
+// Add adds a request and returns a function to call once it completes
+func (f *InFlight) Add(r Request) (done func()) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.l == nil {
+		f.l = map[uint64]Request{}
+	}
+	f.seq++
+	id := f.seq
+	f.l[id] = r
+	return func() {
+		f.mu.Lock()
+		delete(f.l, id)
+		f.mu.Unlock()
+	}
+}
+
+// List returns the in-flight requests, oldest first
+func (f *InFlight) List() []Request {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	l := make([]Request, 0, len(f.l))
+	for _, r := range f.l {
+		l = append(l, r)
+	}
+	sort.Slice(l, func(i, j int) bool {
+		return l[i].Started.Before(l[j].Started)
+	})
+	return l
+}
+
 // Reg (registry) holds a list of H
 type Reg struct {
 	mu sync.Mutex
 
-	log   log.Logger
-	l     map[string]Server
-	drain bool
+	log       log.Logger
+	l         map[string]Server
+	listeners *Listeners
+	drain     bool
 }
 
 // NewReg builds a new registry
-func NewReg(log log.Logger) *Reg {
+func NewReg(l log.Logger) *Reg {
+	listeners, err := DefaultListeners()
+	if err != nil {
+		l.Error("server.listeners.err", "Cannot inherit listeners",
+			log.Error(err),
+		)
+	}
 	return &Reg{
-		log: log,
-		l:   map[string]Server{},
+		log:       l,
+		l:         map[string]Server{},
+		listeners: listeners,
 	}
 }
 
+// Listeners returns the listeners used by servers. Servers get them with
+// ListenersFromContext.
+func (r *Reg) Listeners() *Listeners {
+	return r.listeners
+}
+
 // Add adds the given server to the list of servers
 func (r *Reg) Add(addr string, h Server) {
 	r.mu.Lock()
@@ -65,6 +138,18 @@ func (r *Reg) Add(addr string, h Server) {
 	}
 }
 
+// Servers returns the registered servers by address
+func (r *Reg) Servers() map[string]Server {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	l := make(map[string]Server, len(r.l))
+	for addr, s := range r.l {
+		l[addr] = s
+	}
+	return l
+}
+
 // Serve starts all registered servers
 func (r *Reg) Serve(ctx context.Context) error {
 	r.mu.Lock()
@@ -74,7 +159,10 @@ func (r *Reg) Serve(ctx context.Context) error {
 		return ErrEmptyReg
 	}
 
-	r.log.Trace("server.serve.init", "Starting servers...")
+	r.log.Trace("server.serve.init", "Starting servers...",
+		log.Int("inherited", r.listeners.Inherited()),
+	)
+	ctx = ListenersWithContext(ctx, r.listeners)
 
 	wg := sync.WaitGroup{}
 	wg.Add(len(r.l))
@@ -115,40 +203,92 @@ func (r *Reg) Serve(ctx context.Context) error {
 // Drain notify all servers to enter in draining mode. It means they are no
 // longer accepting new requests, but they can finish all in-flight requests
 func (r *Reg) Drain() {
+	r.DrainContext(context.Background())
+}
+
+// DrainContext is like Drain, but it stops waiting once ctx is done.
+// Servers which have not drained by then are closed (when they implement
+// io.Closer), and their in-flight requests are logged as abandoned.
+func (r *Reg) DrainContext(ctx context.Context) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
 	// Check if we are already draining
 	if r.drain {
-		return
+		return nil
 	}
 
 	// Flag registry as draining
 	r.drain = true
-
-	// Build WG
-	l := len(r.l)
-	wg := sync.WaitGroup{}
-	wg.Add(l)
+	defer func() {
+		r.drain = false
+	}()
 
 	// Drain servers
 	r.log.Trace("server.drain.init", "Start draining",
-		log.Int("servers", l),
+		log.Int("servers", len(r.l)),
 	)
-	for _, s := range r.l {
+	done := make(map[string]chan struct{}, len(r.l))
+	for addr, s := range r.l {
 		r.log.Trace("server.drain.s", "Drain server",
 			log.Type("server", s),
 		)
+		c := make(chan struct{})
+		done[addr] = c
 		go func(s Server) {
 			s.Drain()
-			wg.Done()
+			close(c)
 		}(s)
 	}
 
-	wg.Wait()
+	var pending []string
+	for addr, c := range done {
+		select {
+		case <-c:
+		case <-ctx.Done():
+			select {
+			case <-c:
+			default:
+				pending = append(pending, addr)
+			}
+		}
+	}
+	if len(pending) == 0 {
+		r.log.Trace("server.drain.done", "All servers have been drained")
+		return nil
+	}
 
-	r.drain = false
-	r.log.Trace("server.drain.done", "All servers have been drained")
+	// Escalate to close
+	sort.Strings(pending)
+	var abandoned int
+	for _, addr := range pending {
+		s := r.l[addr]
+		if t, ok := s.(Tracker); ok {
+			for _, req := range t.InFlight() {
+				abandoned++
+				r.log.Warning("server.drain.abandon", "Abandon in-flight request",
+					log.String("addr", addr),
+					log.String("request", req.Name),
+					log.Duration("duration", time.Since(req.Started)),
+				)
+			}
+		}
+		if c, ok := s.(io.Closer); ok {
+			r.log.Warning("server.drain.close", "Close server",
+				log.String("addr", addr),
+				log.Type("server", s),
+			)
+			if err := c.Close(); err != nil {
+				r.log.Error("server.drain.close_err", "Error closing server",
+					log.String("addr", addr),
+					log.Error(err),
+				)
+			}
+		}
+	}
+	return fmt.Errorf("%w (%d servers pending, %d requests abandoned): %v",
+		ErrDrainTimeout, len(pending), abandoned, ctx.Err(),
+	)
 }
 
 func (r *Reg) register(addr string, s Server) error {
@@ -2,6 +2,7 @@ package net_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"testing"
@@ -127,6 +128,56 @@ func TestDrain(t *testing.T) {
 	}
 }
 
+// TestDrainTimeout tests whether servers which do not drain in time are
+// closed
+func TestDrainTimeout(t *testing.T) {
+	tt := lt.New(t)
+	reg := net.NewReg(tt.Logger())
+
+	h := &hungH{closed: make(chan struct{})}
+	h.inflight.Add(net.Request{Name: "GET /slow", Started: time.Now()})
+	reg.Add(fmt.Sprintf("localhost:%d", lt.NextPort()), h)
+	if err := reg.Serve(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := reg.DrainContext(ctx)
+	if !errors.Is(err, net.ErrDrainTimeout) {
+		t.Errorf("expect ErrDrainTimeout, but got %v", err)
+	}
+	select {
+	case <-h.closed:
+	default:
+		t.Error("expect server to be closed")
+	}
+}
+
+// hungH is a server which never drains
+type hungH struct {
+	inflight net.InFlight
+	closed   chan struct{}
+}
+
+func (h *hungH) Serve(ctx context.Context, addr string) error {
+	<-h.closed
+	return nil
+}
+
+func (h *hungH) Drain() {
+	<-h.closed
+}
+
+func (h *hungH) Close() error {
+	close(h.closed)
+	return nil
+}
+
+func (h *hungH) InFlight() []net.Request {
+	return h.inflight.List()
+}
+
 type dummyH struct {
 	mu sync.Mutex
 
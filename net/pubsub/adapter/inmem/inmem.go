@@ -17,8 +17,6 @@ import (
 
 const (
 	Name = "inmem"
-
-	defaultBuffer = 50
 )
 
 type Inmem struct {
@@ -34,7 +32,7 @@ type Inmem struct {
 }
 
 type Config struct {
-	Buffer int `toml:"buffer"`
+	Buffer int `toml:"buffer" default:"50"`
 }
 
 func New(tree config.Tree) (pubsub.PubSub, error) {
@@ -42,9 +40,6 @@ func New(tree config.Tree) (pubsub.PubSub, error) {
 	if err := tree.Unmarshal(config); err != nil {
 		return nil, errors.Wrap(err, "cannot unmarshal pubsub.inmem config")
 	}
-	if config.Buffer == 0 {
-		config.Buffer = defaultBuffer
-	}
 
 	return &Inmem{
 		subs:     map[string][]pubsub.MsgHandler{},
@@ -0,0 +1,179 @@
+package spine
+
+import (
+	"github.com/deixis/spine/cache"
+	"github.com/deixis/spine/disco"
+	"github.com/deixis/spine/lock"
+	"github.com/deixis/spine/log"
+	"github.com/deixis/spine/net/pubsub"
+	"github.com/deixis/spine/net/stream"
+	"github.com/deixis/spine/schedule"
+	"github.com/deixis/spine/stats"
+	"github.com/deixis/spine/tracing"
+)
+
+// Option configures an App
+type Option func(*Options)
+
+// Options configure an App. Options are set by the Option values passed to
+// New.
+//
+// A service given in Options replaces the one built from config. The app still
+// adds its own decorations (e.g. log fields, stats tags, pubsub middlewares),
+// and then the Wrap functions are applied.
+type Options struct {
+	Logger    log.Logger
+	Stats     stats.Stats
+	Tracer    tracing.Tracer
+	Disco     disco.Agent
+	Scheduler schedule.Scheduler
+	Cache     cache.Cache
+	PubSub    pubsub.PubSub
+	Stream    stream.Stream
+	Locker    lock.Locker
+
+	WrapLogger    []func(log.Logger) log.Logger
+	WrapStats     []func(stats.Stats) stats.Stats
+	WrapTracer    []func(tracing.Tracer) tracing.Tracer
+	WrapDisco     []func(disco.Agent) disco.Agent
+	WrapScheduler []func(schedule.Scheduler) schedule.Scheduler
+	WrapCache     []func(cache.Cache) cache.Cache
+	WrapPubSub    []func(pubsub.PubSub) pubsub.PubSub
+	WrapStream    []func(stream.Stream) stream.Stream
+	WrapLocker    []func(lock.Locker) lock.Locker
+}
+
+// BuildOptions returns the options resulting from o
+func BuildOptions(o ...Option) Options {
+	opts := Options{}
+	for _, o := range o {
+		o(&opts)
+	}
+	return opts
+}
+
+// WithLogger replaces the logger built from config
+func WithLogger(l log.Logger) Option {
+	return func(o *Options) {
+		o.Logger = l
+	}
+}
+
+// WithStats replaces the stats built from config
+func WithStats(s stats.Stats) Option {
+	return func(o *Options) {
+		o.Stats = s
+	}
+}
+
+// WithTracer replaces the tracer built from config
+func WithTracer(t tracing.Tracer) Option {
+	return func(o *Options) {
+		o.Tracer = t
+	}
+}
+
+// WithDisco replaces the service discovery agent built from config
+func WithDisco(a disco.Agent) Option {
+	return func(o *Options) {
+		o.Disco = a
+	}
+}
+
+// WithScheduler replaces the scheduler built from config
+func WithScheduler(s schedule.Scheduler) Option {
+	return func(o *Options) {
+		o.Scheduler = s
+	}
+}
+
+// WithCache replaces the cache built from config
+func WithCache(c cache.Cache) Option {
+	return func(o *Options) {
+		o.Cache = c
+	}
+}
+
+// WithPubSub replaces the pubsub built from config
+func WithPubSub(p pubsub.PubSub) Option {
+	return func(o *Options) {
+		o.PubSub = p
+	}
+}
+
+// WithStream replaces the stream built from config
+func WithStream(s stream.Stream) Option {
+	return func(o *Options) {
+		o.Stream = s
+	}
+}
+
+// WithLocker replaces the locker built from config
+func WithLocker(l lock.Locker) Option {
+	return func(o *Options) {
+		o.Locker = l
+	}
+}
+
+// WrapLogger decorates the logger
+func WrapLogger(f func(log.Logger) log.Logger) Option {
+	return func(o *Options) {
+		o.WrapLogger = append(o.WrapLogger, f)
+	}
+}
+
+// WrapStats decorates the stats
+func WrapStats(f func(stats.Stats) stats.Stats) Option {
+	return func(o *Options) {
+		o.WrapStats = append(o.WrapStats, f)
+	}
+}
+
+// WrapTracer decorates the tracer
+func WrapTracer(f func(tracing.Tracer) tracing.Tracer) Option {
+	return func(o *Options) {
+		o.WrapTracer = append(o.WrapTracer, f)
+	}
+}
+
+// WrapDisco decorates the service discovery agent
+func WrapDisco(f func(disco.Agent) disco.Agent) Option {
+	return func(o *Options) {
+		o.WrapDisco = append(o.WrapDisco, f)
+	}
+}
+
+// WrapScheduler decorates the scheduler
+func WrapScheduler(f func(schedule.Scheduler) schedule.Scheduler) Option {
+	return func(o *Options) {
+		o.WrapScheduler = append(o.WrapScheduler, f)
+	}
+}
+
+// WrapCache decorates the cache
+func WrapCache(f func(cache.Cache) cache.Cache) Option {
+	return func(o *Options) {
+		o.WrapCache = append(o.WrapCache, f)
+	}
+}
+
+// WrapPubSub decorates the pubsub
+func WrapPubSub(f func(pubsub.PubSub) pubsub.PubSub) Option {
+	return func(o *Options) {
+		o.WrapPubSub = append(o.WrapPubSub, f)
+	}
+}
+
+// WrapStream decorates the stream
+func WrapStream(f func(stream.Stream) stream.Stream) Option {
+	return func(o *Options) {
+		o.WrapStream = append(o.WrapStream, f)
+	}
+}
+
+// WrapLocker decorates the locker
+func WrapLocker(f func(lock.Locker) lock.Locker) Option {
+	return func(o *Options) {
+		o.WrapLocker = append(o.WrapLocker, f)
+	}
+}
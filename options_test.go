@@ -0,0 +1,44 @@
+package spine_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/deixis/spine"
+	"github.com/deixis/spine/cache"
+	"github.com/deixis/spine/cache/adapter/local"
+	"github.com/deixis/spine/config"
+	"github.com/deixis/spine/log"
+	lt "github.com/deixis/spine/testing"
+)
+
+func TestOptions(t *testing.T) {
+	c, err := local.New(config.NopTree())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wrapped int
+
+	app, err := spine.NewWithConfig("test", strings.NewReader(""), &struct{}{},
+		spine.WithLogger(lt.NewLogger(t, false)),
+		spine.WithCache(c),
+		spine.WrapLogger(func(l log.Logger) log.Logger {
+			wrapped++
+			return l
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer app.Close()
+
+	if app.Cache() != c || cache.FromContext(app) != c {
+		t.Error("expect injected cache to be used")
+	}
+	if _, ok := app.L().(*lt.Logger); !ok {
+		t.Errorf("expect injected logger to be used, but got %T", app.L())
+	}
+	if wrapped != 1 {
+		t.Errorf("expect logger to be wrapped once, but got %d", wrapped)
+	}
+}
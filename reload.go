@@ -0,0 +1,76 @@
+package spine
+
+import (
+	"context"
+
+	"github.com/deixis/spine/config"
+	store "github.com/deixis/spine/config/adapter"
+	"github.com/deixis/spine/log"
+	"github.com/deixis/spine/log/logger"
+)
+
+// configWatcher reloads all config sources each time a config store changes
+type configWatcher struct {
+	app     *App
+	sources []config.Source
+	watcher store.Watcher
+	ctx     context.Context
+	cancel  context.CancelFunc
+}
+
+func newConfigWatcher(
+	app *App, sources []config.Source, w store.Watcher,
+) *configWatcher {
+	ctx, cancel := context.WithCancel(app.ctx)
+	return &configWatcher{
+		app:     app,
+		sources: sources,
+		watcher: w,
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+// Start starts watching the config store
+func (w *configWatcher) Start() {
+	if err := w.watcher.Watch(w.ctx, w.reload); err != nil {
+		w.app.Warning("spine.config.watch_err", "Stop watching config store",
+			log.Error(err),
+		)
+	}
+}
+
+// Stop stops watching the config store
+func (w *configWatcher) Stop() {
+	w.cancel()
+}
+
+func (w *configWatcher) reload() {
+	t, err := config.LoadSources(w.sources)
+	if err != nil {
+		w.app.Warning("spine.config.reload_err", "Cannot reload config",
+			log.Error(err),
+		)
+		return
+	}
+	w.app.reloader.Set(t)
+	w.app.Trace("spine.config.reload", "Config reloaded")
+}
+
+// reloadLog applies the new log config
+func (a *App) reloadLog(t config.Tree) {
+	lc := logger.Config{}
+	if err := t.Unmarshal(&lc); err != nil {
+		a.Warning("spine.config.log_err", "Cannot reload log config",
+			log.Error(err),
+		)
+		return
+	}
+
+	if l, ok := a.log.(*logger.Logger); ok {
+		l.SetLevel(log.ParseLevel(lc.Level))
+		a.Trace("spine.config.log", "Log level changed",
+			log.String("level", lc.Level),
+		)
+	}
+}
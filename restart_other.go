@@ -0,0 +1,19 @@
+//go:build !unix
+
+package spine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// restartSignal is nil, because restarts are not supported on this platform
+var restartSignal os.Signal
+
+// Restart returns an error, because listening sockets cannot be passed on to
+// a new process on this platform
+func (a *App) Restart(ctx context.Context) error {
+	return fmt.Errorf("cannot restart: %w", errors.ErrUnsupported)
+}
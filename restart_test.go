@@ -0,0 +1,34 @@
+package spine_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/deixis/spine"
+	"github.com/deixis/spine/net"
+	lt "github.com/deixis/spine/testing"
+)
+
+// TestRestartEnv tests whether the environment passed on to a restarted
+// process stays out of its config tree
+func TestRestartEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, []byte("[app]\nfoo = \"bar\"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CONFIG_URI", "file://"+path)
+	t.Setenv(net.EnvReadyFD, "5")
+
+	app, err := spine.New("test", &struct{}{}, spine.WithLogger(lt.NewLogger(t, false)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer app.Close()
+
+	for _, key := range app.ConfigTree().Keys() {
+		if key != "app" {
+			t.Errorf("expect restart env not to be merged in config tree, but got key %s", key)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+//go:build unix
+
+package spine
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/deixis/spine/log"
+	"github.com/deixis/spine/net"
+	"github.com/pkg/errors"
+)
+
+// restartSignal is the signal which restarts the app (see App.Restart)
+var restartSignal os.Signal = syscall.SIGUSR2
+
+// Restart starts a new process of the app binary and passes it the listening
+// sockets, so connections are not dropped during a deploy. Once the new
+// process reports ready, this app shuts down gracefully.
+//
+// When the new process fails or does not become ready before ctx expires
+// (or before the restart budget, see config.Shutdown), it is killed and this
+// app keeps serving requests.
+//
+// Restart is refused while a service holds an exclusive file lock, such as
+// the local scheduler or the bolt locker, because the new process could not
+// open that file before this app shuts down.
+func (a *App) Restart(ctx context.Context) error {
+	for _, l := range a.lockedFiles {
+		if path := l.LockedFile(); path != "" {
+			return errors.Errorf("cannot restart while <%s> is locked by this process", path)
+		}
+	}
+
+	if a.config.Shutdown.Restart > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, a.config.Shutdown.Restart)
+		defer cancel()
+	}
+
+	files, names, err := a.servers.Listeners().Files()
+	if err != nil {
+		return errors.Wrap(err, "cannot pass listeners")
+	}
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+
+	// The child writes on the pipe once it is ready
+	r, w, err := os.Pipe()
+	if err != nil {
+		return errors.Wrap(err, "cannot create ready pipe")
+	}
+	defer r.Close()
+
+	exe, err := os.Executable()
+	if err != nil {
+		w.Close()
+		return errors.Wrap(err, "cannot find executable")
+	}
+	env := []string{
+		net.EnvListenFDs + "=" + strconv.Itoa(len(files)),
+		net.EnvListenFDNames + "=" + strings.Join(names, ":"),
+		net.EnvListenPPID + "=" + strconv.Itoa(os.Getpid()),
+		fmt.Sprintf("%s=%d", net.EnvReadyFD, 3+len(files)),
+	}
+	for _, kv := range os.Environ() {
+		switch strings.SplitN(kv, "=", 2)[0] {
+		case net.EnvListenFDs, net.EnvListenFDNames, net.EnvListenPID,
+			net.EnvListenPPID, net.EnvReadyFD:
+		default:
+			env = append(env, kv)
+		}
+	}
+	procFiles := []*os.File{os.Stdin, os.Stdout, os.Stderr}
+	procFiles = append(procFiles, files...)
+	procFiles = append(procFiles, w)
+
+	a.Trace("spine.restart", "Start new process...",
+		log.String("exe", exe),
+		log.Int("listeners", len(files)),
+	)
+	p, err := os.StartProcess(exe, os.Args, &os.ProcAttr{
+		Env:   env,
+		Files: procFiles,
+	})
+	w.Close() // Only the child holds the write end now
+	if err != nil {
+		return errors.Wrap(err, "cannot start new process")
+	}
+
+	readyc := make(chan error, 1)
+	go func() {
+		b := make([]byte, 1)
+		_, err := r.Read(b)
+		if err == io.EOF {
+			err = errors.New("new process exited before being ready")
+		}
+		readyc <- err
+	}()
+
+	select {
+	case err = <-readyc:
+	case <-ctx.Done():
+		err = errors.Wrap(ctx.Err(), "new process is not ready")
+	}
+	if err != nil {
+		p.Kill()
+		p.Wait()
+		return errors.Wrapf(err, "new process %d", p.Pid)
+	}
+	p.Release()
+
+	a.Trace("spine.restart.ready", "New process is ready",
+		log.Int("pid", p.Pid),
+	)
+	return a.Shutdown(context.Background())
+}
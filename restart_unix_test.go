@@ -0,0 +1,39 @@
+//go:build unix
+
+package spine_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/deixis/spine"
+	lt "github.com/deixis/spine/testing"
+)
+
+// TestRestartLockedFile tests whether a restart is refused while a bolt
+// database is locked by the app, since the new process could not open it
+func TestRestartLockedFile(t *testing.T) {
+	dir := t.TempDir()
+	db := filepath.Join(dir, "lock.db")
+	path := filepath.Join(dir, "config.toml")
+	data := fmt.Sprintf("[lock.bolt]\ndb = %q\n", db)
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CONFIG_URI", "file://"+path)
+
+	app, err := spine.New("test", &struct{}{}, spine.WithLogger(lt.NewLogger(t, false)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer app.Close()
+
+	err = app.Restart(context.Background())
+	if err == nil || !strings.Contains(err.Error(), db) {
+		t.Fatalf("expect restart to be refused because of %s, but got %v", db, err)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"math/rand"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/deixis/spine/config"
@@ -27,9 +28,7 @@ import (
 const Name = "local"
 
 const (
-	defaultDB           = "schedule.local.db"
 	defaultUpdateBuffer = 16
-	defaultWorkers      = 4
 )
 
 var (
@@ -55,9 +54,9 @@ type scheduler struct {
 // Config is the local scheduler configuration
 type Config struct {
 	// DB is the path to the database file
-	DB string `toml:"db"`
+	DB string `toml:"db" default:"schedule.local.db"`
 	// Workers is the maximum number of goroutines that process jobs in parallel
-	Workers int `toml:"workers"`
+	Workers int `toml:"workers" default:"4" validate:"min=1"`
 	// Encryption activates data encryption.
 	// It is worth noting that once a database created, it is no longer possible
 	// to change this option.
@@ -82,13 +81,6 @@ func New(tree config.Tree) (schedule.Scheduler, error) {
 	if err := tree.Unmarshal(&c); err != nil {
 		return nil, err
 	}
-
-	if c.DB == "" {
-		c.DB = defaultDB
-	}
-	if c.Workers == 0 {
-		c.Workers = defaultWorkers
-	}
 	return &scheduler{
 		config:   c,
 		handlers: make(map[string]schedule.Fn),
@@ -172,6 +164,15 @@ func (s *scheduler) Drain() {
 	s.processor.Close()
 }
 
+// LockedFile returns the path of the database file while it is open. bbolt
+// locks it exclusively, so another process cannot open it meanwhile.
+func (s *scheduler) LockedFile() string {
+	if s.storage == nil || atomic.LoadUint32(&s.storage.state) == 0 {
+		return ""
+	}
+	return s.config.DB
+}
+
 func (s *scheduler) Close() error {
 	s.storage.Close()
 	return nil
@@ -0,0 +1,116 @@
+package spine
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/deixis/spine/log"
+	"github.com/pkg/errors"
+)
+
+// ErrPhaseTimeout occurs when a shutdown phase does not complete in time
+var ErrPhaseTimeout = errors.New("shutdown phase timed out")
+
+// PhaseError reports a shutdown phase which failed or did not complete in time
+type PhaseError struct {
+	// Phase is the phase name (e.g. servers, bg, components)
+	Phase string
+	Err   error
+}
+
+func (e *PhaseError) Error() string {
+	return e.Phase + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *PhaseError) Unwrap() error {
+	return e.Err
+}
+
+// ShutdownError contains all phases which did not complete during a shutdown
+type ShutdownError struct {
+	Phases []*PhaseError
+}
+
+func (e *ShutdownError) Error() string {
+	l := make([]string, len(e.Phases))
+	for i, err := range e.Phases {
+		l[i] = err.Error()
+	}
+	return "shutdown incomplete: " + strings.Join(l, "; ")
+}
+
+// Unwrap returns the phase errors
+func (e *ShutdownError) Unwrap() []error {
+	l := make([]error, len(e.Phases))
+	for i, err := range e.Phases {
+		l[i] = err
+	}
+	return l
+}
+
+// shutdown runs the drain phases within the shutdown budget
+type shutdown struct {
+	ctx    context.Context
+	log    log.Logger
+	errors []*PhaseError
+}
+
+// phase calls f with a context which expires after timeout, or earlier when
+// the overall budget runs out. Once the budget has run out, phases are skipped.
+func (s *shutdown) phase(
+	name string, timeout time.Duration, f func(ctx context.Context) error,
+) {
+	if err := s.ctx.Err(); err != nil {
+		s.log.Warning("spine.drain.skip", "Skip shutdown phase",
+			log.String("phase", name),
+		)
+		s.errors = append(s.errors, &PhaseError{
+			Phase: name, Err: errors.Wrap(err, "skipped"),
+		})
+		return
+	}
+
+	ctx, cancel := s.ctx, func() {}
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(s.ctx, timeout)
+	}
+	defer cancel()
+
+	s.log.Trace("spine.drain."+name, "Start draining "+name+"...")
+	if err := f(ctx); err != nil {
+		s.log.Warning("spine.drain.abandon", "Shutdown phase did not complete",
+			log.String("phase", name),
+			log.Error(err),
+		)
+		s.errors = append(s.errors, &PhaseError{Phase: name, Err: err})
+	}
+}
+
+// err returns a *ShutdownError when a phase did not complete
+func (s *shutdown) err() error {
+	if len(s.errors) == 0 {
+		return nil
+	}
+	return &ShutdownError{Phases: s.errors}
+}
+
+// wait adapts a blocking drain function to a phase. When ctx expires before
+// f returns, f is abandoned.
+func wait(f func()) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		done := make(chan struct{})
+		go func() {
+			f()
+			close(done)
+		}()
+
+		select {
+		case <-done:
+			return nil
+		case <-ctx.Done():
+			return errors.Wrap(ErrPhaseTimeout, ctx.Err().Error())
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package spine_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/deixis/spine"
+	"github.com/deixis/spine/bg"
+	"github.com/deixis/spine/net"
+	lt "github.com/deixis/spine/testing"
+)
+
+func TestShutdownBudget(t *testing.T) {
+	app, err := spine.NewWithConfig("test", strings.NewReader(`
+[shutdown]
+timeout = "1s"
+servers = "10ms"
+jobs = "10ms"
+`), &struct{}{}, spine.WithLogger(lt.NewLogger(t, false)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block := make(chan struct{})
+	defer close(block)
+	app.RegisterServer(fmt.Sprintf("localhost:%d", lt.NextPort()), &hungServer{
+		block: block,
+	})
+	go app.Serve()
+	app.Ready()
+	bg.BG(app, func(ctx context.Context) { <-block })
+
+	err = app.Shutdown(context.Background())
+	var serr *spine.ShutdownError
+	if !errors.As(err, &serr) {
+		t.Fatalf("expect ShutdownError, but got %v", err)
+	}
+	var phases []string
+	for _, p := range serr.Phases {
+		phases = append(phases, p.Phase)
+	}
+	if strings.Join(phases, ",") != "servers,bg" {
+		t.Errorf("expect servers and bg phases to time out, but got %v", phases)
+	}
+	if !errors.Is(err, net.ErrDrainTimeout) || !errors.Is(err, bg.ErrDrainTimeout) {
+		t.Errorf("expect drain timeouts, but got %v", err)
+	}
+}
+
+// hungServer is a server which never drains
+type hungServer struct {
+	block chan struct{}
+}
+
+func (s *hungServer) Serve(ctx context.Context, addr string) error {
+	<-s.block
+	return nil
+}
+
+func (s *hungServer) Drain() {
+	<-s.block
+}